@@ -2,10 +2,13 @@ package azure
 
 import (
 	"context"
+	"slices"
 
 	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/golang-set/set"
 
 	"github.com/raito-io/cli-plugin-azure/azure/constants"
+	"github.com/raito-io/cli-plugin-azure/azure/sql"
 	"github.com/raito-io/cli-plugin-azure/azure/storage"
 
 	"github.com/raito-io/cli/base/util/config"
@@ -25,10 +28,13 @@ type DataSourceSyncer struct {
 func NewDataSourceSyncer() *DataSourceSyncer {
 	return &DataSourceSyncer{serviceSyncers: []AzureServiceDataObjectSyncer{
 		&storage.DataSourceSyncer{},
+		&sql.DataSourceSyncer{},
 	}}
 }
 
 func (s *DataSourceSyncer) SyncDataSource(ctx context.Context, dataSourceHandler wrappers.DataSourceObjectHandler, config *ds.DataSourceSyncConfig) error {
+	dataSourceHandler = &sharedDataObjectHandler{DataSourceObjectHandler: dataSourceHandler, added: set.NewSet[string]()}
+
 	for _, syncer := range s.serviceSyncers {
 		err := syncer.SyncDataSource(ctx, dataSourceHandler, config)
 
@@ -62,6 +68,14 @@ func (s *DataSourceSyncer) GetDataSourceMetaData(ctx context.Context, _ *config.
 					Name:            ds.File,
 					DataObjectTypes: []string{ds.File},
 				},
+				{
+					Name:            ds.Folder,
+					DataObjectTypes: []string{ds.Folder},
+				},
+				{
+					Name:            storage.Container,
+					DataObjectTypes: []string{storage.Container},
+				},
 			},
 		},
 		AccessProviderTypes: []*ds.AccessProviderType{
@@ -78,12 +92,75 @@ func (s *DataSourceSyncer) GetDataSourceMetaData(ctx context.Context, _ *config.
 	for _, syncer := range s.serviceSyncers {
 		topLevelDoTypeNames, doTypes := syncer.GetDataObjectTypes(ctx)
 
-		meta.DataObjectTypes = append(meta.DataObjectTypes, doTypes...)
+		meta.DataObjectTypes = mergeDataObjectTypes(meta.DataObjectTypes, doTypes)
 
-		meta.DataObjectTypes[0].Children = append(meta.DataObjectTypes[0].Children, topLevelDoTypeNames...)
+		for _, name := range topLevelDoTypeNames {
+			if !slices.Contains(meta.DataObjectTypes[0].Children, name) {
+				meta.DataObjectTypes[0].Children = append(meta.DataObjectTypes[0].Children, name)
+			}
+		}
 
 		meta.DataObjectTypes[0].Permissions = append(meta.DataObjectTypes[0].Permissions, syncer.GetDataSourceIAMPermissions()...)
 	}
 
 	return meta, nil
 }
+
+// mergeDataObjectTypes adds the data object types of a service syncer. The types that are shared by the service syncers, like the subscription and its resource groups,
+// are only added once, with the children and permissions of all service syncers.
+func mergeDataObjectTypes(doTypes []*ds.DataObjectType, serviceDoTypes []*ds.DataObjectType) []*ds.DataObjectType {
+	for _, serviceDoType := range serviceDoTypes {
+		i := slices.IndexFunc(doTypes, func(doType *ds.DataObjectType) bool {
+			return doType.Name == serviceDoType.Name
+		})
+
+		if i < 0 {
+			doTypes = append(doTypes, serviceDoType)
+
+			continue
+		}
+
+		for _, child := range serviceDoType.Children {
+			if !slices.Contains(doTypes[i].Children, child) {
+				doTypes[i].Children = append(doTypes[i].Children, child)
+			}
+		}
+
+		for _, permission := range serviceDoType.Permissions {
+			if !slices.ContainsFunc(doTypes[i].Permissions, func(p *ds.DataObjectTypePermission) bool { return p.Permission == permission.Permission }) {
+				doTypes[i].Permissions = append(doTypes[i].Permissions, permission)
+			}
+		}
+	}
+
+	return doTypes
+}
+
+// sharedDataObjectHandler adds the data objects that are shared by the service syncers, i.e. the subscription and its resource groups, only once
+type sharedDataObjectHandler struct {
+	wrappers.DataSourceObjectHandler
+
+	added set.Set[string]
+}
+
+func (h *sharedDataObjectHandler) AddDataObjects(dataObjects ...*ds.DataObject) error {
+	result := make([]*ds.DataObject, 0, len(dataObjects))
+
+	for _, dataObject := range dataObjects {
+		if dataObject.Type == storage.Subscription || dataObject.Type == storage.ResourceGroup {
+			if h.added.Contains(dataObject.ExternalId) {
+				continue
+			}
+
+			h.added.Add(dataObject.ExternalId)
+		}
+
+		result = append(result, dataObject)
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	return h.DataSourceObjectHandler.AddDataObjects(result...)
+}
@@ -0,0 +1,69 @@
+package azure
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/cli/base/wrappers"
+	"github.com/raito-io/golang-set/set"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/azure/sql"
+	"github.com/raito-io/cli-plugin-azure/azure/storage"
+)
+
+type dataObjectCollector struct {
+	wrappers.DataSourceObjectHandler
+
+	dataObjects []*ds.DataObject
+}
+
+func (c *dataObjectCollector) AddDataObjects(dataObjects ...*ds.DataObject) error {
+	c.dataObjects = append(c.dataObjects, dataObjects...)
+
+	return nil
+}
+
+func TestDataSourceSyncer_GetDataSourceMetaData(t *testing.T) {
+	meta, err := NewDataSourceSyncer().GetDataSourceMetaData(context.Background(), nil)
+	require.NoError(t, err)
+
+	doTypes := make(map[string]*ds.DataObjectType)
+
+	for _, doType := range meta.DataObjectTypes {
+		assert.NotContains(t, doTypes, doType.Name, "data object type %q is defined more than once", doType.Name)
+
+		doTypes[doType.Name] = doType
+	}
+
+	assert.Equal(t, []string{storage.Subscription}, doTypes[ds.Datasource].Children)
+	assert.Equal(t, []string{storage.StorageAccount, sql.Server}, doTypes[storage.ResourceGroup].Children)
+	assert.NotEmpty(t, doTypes[storage.ResourceGroup].Permissions)
+	assert.Equal(t, []string{sql.Table}, doTypes[sql.Schema].Children)
+}
+
+func TestSharedDataObjectHandler(t *testing.T) {
+	collector := &dataObjectCollector{}
+	handler := &sharedDataObjectHandler{DataSourceObjectHandler: collector, added: set.NewSet[string]()}
+
+	require.NoError(t, handler.AddDataObjects(
+		&ds.DataObject{ExternalId: "sub", Type: storage.Subscription},
+		&ds.DataObject{ExternalId: "sub/rg", Type: storage.ResourceGroup},
+		&ds.DataObject{ExternalId: "sub/rg/account", Type: storage.StorageAccount},
+	))
+
+	require.NoError(t, handler.AddDataObjects(
+		&ds.DataObject{ExternalId: "sub", Type: sql.Subscription},
+		&ds.DataObject{ExternalId: "sub/rg", Type: sql.ResourceGroup},
+		&ds.DataObject{ExternalId: "sub/rg/server", Type: sql.Server},
+	))
+
+	externalIds := make([]string, 0, len(collector.dataObjects))
+	for _, dataObject := range collector.dataObjects {
+		externalIds = append(externalIds, dataObject.ExternalId)
+	}
+
+	assert.Equal(t, []string{"sub", "sub/rg", "sub/rg/account", "sub/rg/server"}, externalIds)
+}
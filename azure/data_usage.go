@@ -2,10 +2,13 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/raito-io/cli-plugin-azure/azure/sql"
 	"github.com/raito-io/cli-plugin-azure/azure/storage"
+	"github.com/raito-io/cli-plugin-azure/global"
 	"github.com/raito-io/cli/base/data_usage"
 	"github.com/raito-io/cli/base/util/config"
 	"github.com/raito-io/cli/base/wrappers"
@@ -23,38 +26,96 @@ type DataUsageSyncer struct {
 func NewDataUsageSyncer() *DataUsageSyncer {
 	return &DataUsageSyncer{serviceSyncers: []AzureServiceDataUsageSyncer{
 		&storage.DataUsageSyncer{},
+		&sql.DataUsageSyncer{},
 	}}
 }
 
 func (s *DataUsageSyncer) SyncDataUsage(ctx context.Context, fileCreator wrappers.DataUsageStatementHandler, configParams *config.ConfigMap) error {
 	startDate, _, _ := GetDataUsageStartDate(ctx, configParams)
 	loggingThreshold := uint64(1 * 1024 * 1024)
-	maximumFileSize := uint64(2 * 1024 * 1024 * 1024) // TODO: temporary limit of ~2Gb for debugging
 	numStatements := 0
 
-	for _, syncer := range s.serviceSyncers {
-		err := syncer.SyncDataUsage(ctx, startDate, configParams, func(st data_usage.Statement) error {
-			fileSize := fileCreator.GetImportFileSize()
-			if fileSize > loggingThreshold {
-				logger.Info(fmt.Sprintf("Import file size larger than %d bytes after %d statements => ~%.1f bytes/statement", fileSize, numStatements, float32(fileSize)/float32(numStatements)))
-				loggingThreshold = 10 * loggingThreshold
+	maximumFileSizeMB := configParams.GetIntWithDefault(global.AzUsageMaxFileSize, 2048)
+	if maximumFileSizeMB <= 0 {
+		return fmt.Errorf("invalid maximum data usage file size %d, %s must be a positive number of MB", maximumFileSizeMB, global.AzUsageMaxFileSize)
+	}
+
+	maximumFileSize := uint64(maximumFileSizeMB) * 1024 * 1024
+
+	aggregator, err := newUsageAggregator(configParams.GetStringWithDefault(global.AzUsageAggregation, usageAggregationNone))
+	if err != nil {
+		return err
+	}
+
+	// writeStatement adds the statement to the import file, regardless of its size
+	writeStatement := func(st data_usage.Statement) error {
+		err := fileCreator.AddStatements([]data_usage.Statement{st})
+		if err != nil {
+			return err
+		}
+
+		numStatements += 1
+
+		return nil
+	}
+
+	checkFileSize := func() error {
+		fileSize := fileCreator.GetImportFileSize()
+		if fileSize > loggingThreshold {
+			logger.Info(fmt.Sprintf("Import file size larger than %d bytes after %d statements => ~%.1f bytes/statement", fileSize, numStatements, float32(fileSize)/float32(numStatements)))
+			loggingThreshold = 10 * loggingThreshold
+		}
+
+		if fileSize > maximumFileSize {
+			return fmt.Errorf("%w: %d bytes after %d statements", global.ErrMaxUsageFileSizeReached, maximumFileSize, numStatements)
+		}
+
+		return nil
+	}
+
+	for i, syncer := range s.serviceSyncers {
+		// A statement is either written or rejected by commit, so the syncers can checkpoint the statements that were committed.
+		// With aggregation, a committed statement can still be part of an open bucket. The open buckets are always written, even if the maximum file size is reached.
+		err = syncer.SyncDataUsage(ctx, startDate, configParams, func(st data_usage.Statement) error {
+			err2 := checkFileSize()
+			if err2 != nil {
+				return err2
 			}
 
-			if fileSize > maximumFileSize {
-				logger.Warn(fmt.Sprintf("Current data usage file size larger than %d bytes(%d statements), not adding any more data to import", maximumFileSize, numStatements))
-			} else {
-				err := fileCreator.AddStatements([]data_usage.Statement{st})
+			if aggregator == nil {
+				return writeStatement(st)
+			}
 
-				if err != nil {
-					return err
+			for _, ready := range aggregator.add(st) {
+				err2 = writeStatement(ready)
+				if err2 != nil {
+					return err2
 				}
-
-				numStatements += 1
 			}
 
 			return nil
 		})
 
+		if aggregator != nil && (err == nil || errors.Is(err, global.ErrMaxUsageFileSizeReached)) {
+			for _, st := range aggregator.flush() {
+				err2 := writeStatement(st)
+				if err2 != nil {
+					return err2
+				}
+			}
+		}
+
+		// The statements that were written are kept, the remaining usage is synced during the next run
+		if errors.Is(err, global.ErrMaxUsageFileSizeReached) {
+			logger.Warn(fmt.Sprintf("Not adding any more data usage to import: %s", err.Error()))
+
+			for _, skipped := range s.serviceSyncers[i+1:] {
+				logger.Warn(fmt.Sprintf("Skipping the data usage of %T, as the maximum data usage file size is reached. It is synced during the next run", skipped))
+			}
+
+			return nil
+		}
+
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,169 @@
+package azure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+type statementCollector struct {
+	statements []data_usage.Statement
+	// statementSize is the size of a statement in the import file
+	statementSize uint64
+}
+
+func (c *statementCollector) AddStatements(statements []data_usage.Statement) error {
+	c.statements = append(c.statements, statements...)
+
+	return nil
+}
+
+func (c *statementCollector) GetImportFileSize() uint64 {
+	return uint64(len(c.statements)) * c.statementSize
+}
+
+func TestDataUsageSyncer_SyncDataUsage_Aggregation(t *testing.T) {
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	read := func(id, user, object string, at time.Time) data_usage.Statement {
+		return data_usage.Statement{
+			ExternalId: id,
+			User:       user,
+			StartTime:  at.Unix(),
+			EndTime:    at.Unix(),
+			Success:    true,
+			AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+				Permissions:      []string{"GetBlob"},
+				GlobalPermission: data_usage.Read,
+				DataObject:       data_usage.UsageDataObjectReference{FullName: object, Type: "file"},
+			}},
+		}
+	}
+
+	statements := []data_usage.Statement{
+		read("1", "alice", "sub/rg/acct/c/a.csv", base.Add(5*time.Minute)),
+		read("2", "alice", "sub/rg/acct/c/a.csv", base.Add(45*time.Minute)),
+		read("3", "alice", "sub/rg/acct/c/a.csv", base.Add(75*time.Minute)),
+		read("4", "bob", "sub/rg/acct/c/a.csv", base.Add(10*time.Minute)),
+	}
+
+	tests := []struct {
+		name          string
+		params        map[string]string
+		statementSize uint64
+		wantIds       []string
+		wantQueries   []string
+	}{
+		{
+			name:        "No aggregation",
+			params:      map[string]string{},
+			wantIds:     []string{"1", "2", "3", "4"},
+			wantQueries: []string{"", "", "", ""},
+		},
+		{
+			name:        "Hourly",
+			params:      map[string]string{global.AzUsageAggregation: "hourly"},
+			wantIds:     []string{"1", "4", "3"},
+			wantQueries: []string{"2 requests between 2024-03-01T10:05:00Z and 2024-03-01T10:45:00Z", "", ""},
+		},
+		{
+			name:        "Daily",
+			params:      map[string]string{global.AzUsageAggregation: "daily"},
+			wantIds:     []string{"1", "4"},
+			wantQueries: []string{"3 requests between 2024-03-01T10:05:00Z and 2024-03-01T11:15:00Z", ""},
+		},
+		{
+			name:        "Maximum file size",
+			params:      map[string]string{global.AzUsageMaxFileSize: "1"},
+			wantIds:     []string{"1", "2"},
+			wantQueries: []string{"", ""},
+		},
+		{
+			// The statement of bob is rejected, the open bucket of alice is still written
+			name:          "Maximum file size with aggregation",
+			params:        map[string]string{global.AzUsageAggregation: "hourly", global.AzUsageMaxFileSize: "1"},
+			statementSize: 2 * 1024 * 1024,
+			wantIds:       []string{"1", "3"},
+			wantQueries:   []string{"2 requests between 2024-03-01T10:05:00Z and 2024-03-01T10:45:00Z", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceSyncer := NewMockAzureServiceDataUsageSyncer(t)
+			serviceSyncer.EXPECT().SyncDataUsage(mock.Anything, mock.Anything, mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, _ time.Time, _ *config.ConfigMap, commit func(data_usage.Statement) error) error {
+				for _, st := range statements {
+					if err := commit(st); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+
+			collector := &statementCollector{statementSize: 1024 * 1024}
+			if tt.statementSize > 0 {
+				collector.statementSize = tt.statementSize
+			}
+
+			syncer := &DataUsageSyncer{serviceSyncers: []AzureServiceDataUsageSyncer{serviceSyncer}}
+
+			err := syncer.SyncDataUsage(context.Background(), collector, &config.ConfigMap{Parameters: tt.params})
+			require.NoError(t, err)
+
+			ids := make([]string, 0, len(collector.statements))
+			queries := make([]string, 0, len(collector.statements))
+
+			for _, st := range collector.statements {
+				ids = append(ids, st.ExternalId)
+				queries = append(queries, st.Query)
+			}
+
+			assert.Equal(t, tt.wantIds, ids)
+			assert.Equal(t, tt.wantQueries, queries)
+		})
+	}
+}
+
+func TestDataUsageSyncer_SyncDataUsage_MaximumFileSize(t *testing.T) {
+	statement := data_usage.Statement{ExternalId: "1", AccessedDataObjects: []data_usage.UsageDataObjectItem{{DataObject: data_usage.UsageDataObjectReference{FullName: "sub/rg/acct/c/a.csv", Type: "file"}}}}
+
+	t.Run("Remaining services are skipped", func(t *testing.T) {
+		storageSyncer := NewMockAzureServiceDataUsageSyncer(t)
+		storageSyncer.EXPECT().SyncDataUsage(mock.Anything, mock.Anything, mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, _ time.Time, _ *config.ConfigMap, commit func(data_usage.Statement) error) error {
+			for {
+				if err := commit(statement); err != nil {
+					return err
+				}
+			}
+		})
+
+		// The SQL syncer isn't called once the maximum file size is reached
+		sqlSyncer := NewMockAzureServiceDataUsageSyncer(t)
+
+		collector := &statementCollector{statementSize: 1024 * 1024}
+		syncer := &DataUsageSyncer{serviceSyncers: []AzureServiceDataUsageSyncer{storageSyncer, sqlSyncer}}
+
+		err := syncer.SyncDataUsage(context.Background(), collector, &config.ConfigMap{Parameters: map[string]string{global.AzUsageMaxFileSize: "2"}})
+		require.NoError(t, err)
+
+		assert.Len(t, collector.statements, 3)
+	})
+
+	for _, maximumFileSize := range []string{"0", "-1"} {
+		t.Run("Invalid maximum file size "+maximumFileSize, func(t *testing.T) {
+			syncer := &DataUsageSyncer{serviceSyncers: []AzureServiceDataUsageSyncer{NewMockAzureServiceDataUsageSyncer(t)}}
+
+			err := syncer.SyncDataUsage(context.Background(), &statementCollector{}, &config.ConfigMap{Parameters: map[string]string{global.AzUsageMaxFileSize: maximumFileSize}})
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/cli/base/util/config"
+)
+
+const (
+	activityLogObjectIdClaim = "http://schemas.microsoft.com/identity/claims/objectidentifier"
+	// activityLogFields are the fields of the Activity Log events that are fetched
+	activityLogFields = "caller,claims,correlationId,eventDataId,eventTimestamp,httpRequest,operationName,resourceId,status,subStatus"
+)
+
+// GetActivityLogs passes every event in the Activity Log of the subscription since startDate to the handler.
+// Only the events with the final status of an operation are passed, so every operation is handled once.
+func (m *monitorService) GetActivityLogs(ctx context.Context, configMap *config.ConfigMap, startDate time.Time, handler func(entry ActivityLogEntry) error) error {
+	factory, err := createArmMonitorClientFactory(ctx, configMap.Parameters)
+	if err != nil {
+		return fmt.Errorf("could not create the client factory for AZ monitor: %w", err)
+	}
+
+	filter := fmt.Sprintf("eventTimestamp ge '%s' and eventTimestamp le '%s'", startDate.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
+
+	pager := factory.NewActivityLogsClient().NewListPager(filter, &armmonitor.ActivityLogsClientListOptions{Select: ptr.String(activityLogFields)})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("could not list the activity log: %w", err)
+		}
+
+		for _, event := range page.Value {
+			entry, final := activityLogEntry(event)
+			if !final {
+				continue
+			}
+
+			err = handler(entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// activityLogEntry converts an Activity Log event. It returns false for events of operations that did not complete yet, e.g. with status Started or Accepted.
+func activityLogEntry(event *armmonitor.EventData) (ActivityLogEntry, bool) {
+	if event == nil || event.Status == nil {
+		return ActivityLogEntry{}, false
+	}
+
+	status := ptr.ToString(event.Status.Value)
+	if !strings.EqualFold(status, "Succeeded") && !strings.EqualFold(status, "Failed") {
+		return ActivityLogEntry{}, false
+	}
+
+	entry := ActivityLogEntry{
+		EventDataId:   ptr.ToString(event.EventDataID),
+		CorrelationId: ptr.ToString(event.CorrelationID),
+		ResourceId:    ptr.ToString(event.ResourceID),
+		Status:        status,
+		Caller:        ptr.ToString(event.Caller),
+	}
+
+	if event.EventTimestamp != nil {
+		entry.EventTimestamp = *event.EventTimestamp
+	}
+
+	if event.OperationName != nil {
+		entry.OperationName = ptr.ToString(event.OperationName.Value)
+	}
+
+	if event.SubStatus != nil {
+		entry.SubStatus = ptr.ToString(event.SubStatus.Value)
+	}
+
+	if objectId, found := event.Claims[activityLogObjectIdClaim]; found {
+		entry.CallerObjectId = ptr.ToString(objectId)
+	}
+
+	if event.HTTPRequest != nil {
+		entry.CallerIpAddress = ptr.ToString(event.HTTPRequest.ClientIPAddress)
+	}
+
+	return entry, true
+}
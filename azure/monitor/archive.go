@@ -0,0 +1,231 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/cli/base"
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// archiveContainers are the containers in which the diagnostic logs per category are archived
+var archiveContainers = []struct {
+	name    string
+	enabled func(setting *ResourceDiagnosticSetting) bool
+}{
+	{name: "insights-logs-storageread", enabled: func(setting *ResourceDiagnosticSetting) bool { return setting.ReadLogsEnabled }},
+	{name: "insights-logs-storagewrite", enabled: func(setting *ResourceDiagnosticSetting) bool { return setting.WriteLogsEnabled }},
+	{name: "insights-logs-storagedelete", enabled: func(setting *ResourceDiagnosticSetting) bool { return setting.DeleteLogsEnabled }},
+}
+
+// archivedLogRecord is a single line of an archived diagnostic log blob
+type archivedLogRecord struct {
+	Time          time.Time `json:"time"`
+	ResourceId    string    `json:"resourceId"`
+	OperationName string    `json:"operationName"`
+	StatusCode    int       `json:"statusCode"`
+	StatusText    string    `json:"statusText"`
+	CorrelationId string    `json:"correlationId"`
+	CallerIp      string    `json:"callerIpAddress"`
+	DurationMs    int64     `json:"durationMs"`
+	Identity      struct {
+		Type      string `json:"type"`
+		TokenHash string `json:"tokenHash"`
+		Requester struct {
+			ObjectId string `json:"objectId"`
+			AppId    string `json:"appId"`
+			TenantId string `json:"tenantId"`
+		} `json:"requester"`
+	} `json:"identity"`
+	Properties struct {
+		ObjectKey        string `json:"objectKey"`
+		UserAgent        string `json:"userAgentHeader"`
+		RequestBodySize  int64  `json:"requestBodySize"`
+		ResponseBodySize int64  `json:"responseBodySize"`
+		ServerLatencyMs  int64  `json:"serverLatencyMs"`
+	} `json:"properties"`
+}
+
+func (r *archivedLogRecord) toLogEntry() LogEntry {
+	return LogEntry{
+		TimeGenerated:      r.Time,
+		OperationName:      r.OperationName,
+		ObjectKey:          r.Properties.ObjectKey,
+		RequesterObjectId:  r.Identity.Requester.ObjectId,
+		RequesterAppId:     r.Identity.Requester.AppId,
+		RequesterTenantId:  r.Identity.Requester.TenantId,
+		AuthenticationType: r.Identity.Type,
+		CorrelationId:      r.CorrelationId,
+		ResourceId:         r.ResourceId,
+		MetricResponseType: ResponseTypeFromStatusCode(r.StatusCode),
+		StatusCode:         strconv.Itoa(r.StatusCode),
+		StatusText:         r.StatusText,
+		AuthenticationHash: r.Identity.TokenHash,
+		CallerIpAddress:    r.CallerIp,
+		UserAgentHeader:    r.Properties.UserAgent,
+		RequestBodySize:    r.Properties.RequestBodySize,
+		ResponseBodySize:   r.Properties.ResponseBodySize,
+		DurationMs:         r.DurationMs,
+		ServerLatencyMs:    r.Properties.ServerLatencyMs,
+	}
+}
+
+// GetArchivedLogs reads the diagnostic logs of the resource that are archived to a storage account since startDate and passes every entry to the handler.
+func (m *monitorService) GetArchivedLogs(ctx context.Context, configMap *config.ConfigMap, setting *ResourceDiagnosticSetting, startDate time.Time, handler func(entry LogEntry) error) error {
+	_, archiveAccount, found := ParseResourceId(setting.StorageAccountID, "storageAccounts")
+	if !found {
+		return fmt.Errorf("invalid archive storage account %q", setting.StorageAccountID)
+	}
+
+	cred, err := global.CreateADClientSecretCredential(ctx, configMap.Parameters)
+	if err != nil {
+		return fmt.Errorf("could not create a credential from a secret: %w", err)
+	}
+
+	// Blobs are stored as resourceId=/SUBSCRIPTIONS/<id>/RESOURCEGROUPS/<group>/.../y=<year>/m=<month>/d=<day>/h=<hour>/m=00/PT1H.json
+	prefix := fmt.Sprintf("resourceId=/%s/", strings.ToUpper(strings.Trim(setting.Resource, "/")))
+
+	for _, archiveContainer := range archiveContainers {
+		if !archiveContainer.enabled(setting) {
+			continue
+		}
+
+		client, err2 := container.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/%s", archiveAccount, archiveContainer.name), cred, nil)
+		if err2 != nil {
+			return err2
+		}
+
+		err2 = readArchivedLogs(ctx, client, prefix, startDate, handler)
+		if err2 != nil {
+			return fmt.Errorf("reading archived logs in %s/%s: %w", archiveAccount, archiveContainer.name, err2)
+		}
+	}
+
+	return nil
+}
+
+func readArchivedLogs(ctx context.Context, client *container.Client, prefix string, startDate time.Time, handler func(entry LogEntry) error) error {
+	// Only the blobs of the days since the start date are listed, instead of all archived logs of the resource
+	for _, dayPrefix := range archiveDayPrefixes(prefix, startDate, time.Now()) {
+		pager := client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &dayPrefix})
+
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, blobItem := range page.Segment.BlobItems {
+				name := ptr.ToString(blobItem.Name)
+
+				// Every blob contains the logs of a single hour, so blobs of hours before the start date can be skipped
+				if hour, ok := parseArchiveBlobHour(name); ok && hour.Add(time.Hour).Before(startDate) {
+					continue
+				}
+
+				resp, err2 := client.NewBlobClient(name).DownloadStream(ctx, nil)
+				if err2 != nil {
+					return err2
+				}
+
+				err2 = ParseArchivedLogs(resp.Body, startDate, handler)
+				resp.Body.Close()
+
+				if err2 != nil {
+					return fmt.Errorf("parsing %s: %w", name, err2)
+				}
+
+				base.Logger().Debug(fmt.Sprintf("Processed archived log blob %s", name))
+			}
+		}
+	}
+
+	return nil
+}
+
+// archiveDayPrefixes returns the blob prefixes of the archived logs of the resource for every day from the start date until now (UTC), e.g. <prefix>y=2024/m=01/d=31/
+func archiveDayPrefixes(prefix string, startDate time.Time, now time.Time) []string {
+	var result []string
+
+	day := startDate.UTC().Truncate(24 * time.Hour)
+
+	for !day.After(now.UTC()) {
+		result = append(result, fmt.Sprintf("%sy=%04d/m=%02d/d=%02d/", prefix, day.Year(), day.Month(), day.Day()))
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return result
+}
+
+// ParseArchivedLogs parses an archived diagnostic log blob, which contains a JSON record per line, and passes every entry since startDate to the handler.
+func ParseArchivedLogs(r io.Reader, startDate time.Time, handler func(entry LogEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var record archivedLogRecord
+
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			return err
+		}
+
+		if record.Time.Before(startDate) {
+			continue
+		}
+
+		err = handler(record.toLogEntry())
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseArchiveBlobHour returns the hour of which an archived log blob contains the logs, based on its name.
+func parseArchiveBlobHour(name string) (time.Time, bool) {
+	values := make(map[string]int)
+
+	for _, part := range strings.Split(name, "/") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+
+		if _, exists := values[key]; exists {
+			// The second "m=" is the minute, which is always 00
+			continue
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+
+		values[key] = number
+	}
+
+	for _, key := range []string{"y", "m", "d", "h"} {
+		if _, found := values[key]; !found {
+			return time.Time{}, false
+		}
+	}
+
+	return time.Date(values["y"], time.Month(values["m"]), values["d"], values["h"], 0, 0, 0, time.UTC), true
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArchivedLogs(t *testing.T) {
+	f, err := os.Open("testdata/PT1H.json")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var entries []LogEntry
+
+	err = ParseArchivedLogs(f, time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), func(entry LogEntry) error {
+		entries = append(entries, entry)
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []LogEntry{
+		{
+			TimeGenerated:      time.Date(2024, 3, 1, 9, 58, 12, 472810200, time.UTC),
+			OperationName:      "GetBlob",
+			ObjectKey:          "/raitodata/sales/2024/orders.csv",
+			RequesterObjectId:  "22222222-2222-2222-2222-222222222222",
+			RequesterAppId:     "11111111-1111-1111-1111-111111111111",
+			RequesterTenantId:  "33333333-3333-3333-3333-333333333333",
+			AuthenticationType: "OAuth",
+			CorrelationId:      "b2a5c1e0-001e-0066-2f1a-6b1c2d000000",
+			ResourceId:         "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/raito/providers/Microsoft.Storage/storageAccounts/raitodata/blobServices/default",
+			MetricResponseType: "Success",
+			StatusCode:         "200",
+			StatusText:         "Success",
+			CallerIpAddress:    "10.0.0.4:51234",
+			UserAgentHeader:    "azsdk-go-azblob/v1.6.0",
+			ResponseBodySize:   1024,
+			DurationMs:         12,
+		},
+		{
+			TimeGenerated:      time.Date(2024, 3, 1, 9, 59, 1, 0, time.UTC),
+			OperationName:      "GetBlob",
+			ObjectKey:          "/raitodata/sales/2024/secret.csv",
+			RequesterObjectId:  "44444444-4444-4444-4444-444444444444",
+			AuthenticationType: "OAuth",
+			CorrelationId:      "b2a5c1e0-001e-0066-2f1a-6b1c2d000001",
+			ResourceId:         "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/raito/providers/Microsoft.Storage/storageAccounts/raitodata/blobServices/default",
+			MetricResponseType: "AuthorizationError",
+			StatusCode:         "403",
+			StatusText:         "AuthorizationPermissionMismatch",
+			CallerIpAddress:    "10.0.0.5:51235",
+			DurationMs:         3,
+		},
+	}, entries)
+}
+
+func TestParseArchiveBlobHour(t *testing.T) {
+	hour, ok := parseArchiveBlobHour("resourceId=/SUBSCRIPTIONS/0000/RESOURCEGROUPS/RAITO/PROVIDERS/MICROSOFT.STORAGE/STORAGEACCOUNTS/RAITODATA/BLOBSERVICES/DEFAULT/y=2024/m=03/d=01/h=09/m=00/PT1H.json")
+
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), hour)
+
+	_, ok = parseArchiveBlobHour("unexpected/PT1H.json")
+	assert.False(t, ok)
+}
+
+func TestArchiveDayPrefixes(t *testing.T) {
+	prefix := "resourceId=/SUBSCRIPTIONS/SUB/RESOURCEGROUPS/RG/PROVIDERS/MICROSOFT.STORAGE/STORAGEACCOUNTS/SA/BLOBSERVICES/DEFAULT/"
+
+	startDate := time.Date(2024, 1, 30, 22, 15, 0, 0, time.UTC)
+	now := time.Date(2024, 2, 1, 3, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{
+		prefix + "y=2024/m=01/d=30/",
+		prefix + "y=2024/m=01/d=31/",
+		prefix + "y=2024/m=02/d=01/",
+	}, archiveDayPrefixes(prefix, startDate, now))
+
+	assert.Empty(t, archiveDayPrefixes(prefix, now.Add(48*time.Hour), now))
+}
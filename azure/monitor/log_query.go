@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+	"github.com/raito-io/cli/base"
+)
+
+const (
+	// initialLogQuerySlice is the time slice that is queried at once, as long as the results stay within the limits of Log Analytics
+	initialLogQuerySlice = 24 * time.Hour
+	// minimumLogQuerySlice is the smallest time slice. If the results of a slice this small are still too large, the query fails.
+	minimumLogQuerySlice = time.Minute
+)
+
+// LogQueryTimeRange contains the placeholders for the time slice that can be used in a log query template
+type LogQueryTimeRange struct {
+	// TimeRange is a predicate that filters TimeGenerated on the time slice
+	TimeRange string
+	// StartTime and EndTime are datetime literals of the start (inclusive) and end (exclusive) of the time slice
+	StartTime string
+	EndTime   string
+}
+
+// TimeRangePlaceholders keeps the time range placeholders in a rendered template, so they can be filled in for every time slice.
+var TimeRangePlaceholders = LogQueryTimeRange{
+	TimeRange: "{{.TimeRange}}",
+	StartTime: "{{.StartTime}}",
+	EndTime:   "{{.EndTime}}",
+}
+
+// logQueryFunc executes the query over a single time slice
+type logQueryFunc func(ctx context.Context, query string, interval azquery.TimeInterval) (azquery.Results, error)
+
+// queryInTimeSlices executes the query for consecutive time slices between start and end and passes every row, decoded into an entry of type T, to the handler.
+// When the results of a slice exceed the limits of Log Analytics, the slice is halved and queried again. After a complete slice, the next slice grows again.
+func queryInTimeSlices[T any](ctx context.Context, query string, start, end time.Time, queryFn logQueryFunc, handler func(entry T) error) error {
+	slice := initialLogQuerySlice
+
+	for sliceStart := start; sliceStart.Before(end); {
+		sliceEnd := sliceStart.Add(slice)
+		if sliceEnd.After(end) {
+			sliceEnd = end
+		}
+
+		sliceQuery, err := timeSliceQuery(query, sliceStart, sliceEnd)
+		if err != nil {
+			return err
+		}
+
+		results, err := queryFn(ctx, sliceQuery, azquery.NewTimeInterval(sliceStart.UTC(), sliceEnd.UTC()))
+		if err == nil && results.Error != nil {
+			err = results.Error
+		}
+
+		if err != nil {
+			if !isResultTooLargeError(err) {
+				return err
+			}
+
+			if slice <= minimumLogQuerySlice {
+				return fmt.Errorf("results between %s and %s exceed the limits of Log Analytics: %w", sliceStart, sliceEnd, err)
+			}
+
+			slice /= 2
+
+			base.Logger().Debug(fmt.Sprintf("Results of log query are too large, retrying with time slices of %s", slice))
+
+			continue
+		}
+
+		for _, table := range results.Tables {
+			for _, row := range table.Rows {
+				var entry T
+
+				err = DecodeRow(row, table.Columns, &entry)
+				if err != nil {
+					return fmt.Errorf("decode log entry: %w", err)
+				}
+
+				err = handler(entry)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		sliceStart = sliceEnd
+
+		if slice < initialLogQuerySlice {
+			slice *= 2
+		}
+	}
+
+	return nil
+}
+
+// timeSliceQuery restricts the query to the time slice. Time range placeholders in the query are filled in, otherwise a filter on TimeGenerated is appended.
+// The filter on TimeGenerated makes sure rows on the border of two slices are only returned once.
+func timeSliceQuery(query string, start, end time.Time) (string, error) {
+	startTime := fmt.Sprintf("datetime(%s)", start.UTC().Format(time.RFC3339Nano))
+	endTime := fmt.Sprintf("datetime(%s)", end.UTC().Format(time.RFC3339Nano))
+	timeRange := fmt.Sprintf("TimeGenerated >= %s and TimeGenerated < %s", startTime, endTime)
+
+	if !strings.Contains(query, "{{") {
+		return fmt.Sprintf("%s | where %s", query, timeRange), nil
+	}
+
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("parse log query template: %w", err)
+	}
+
+	var sliceQuery strings.Builder
+
+	err = tmpl.Execute(&sliceQuery, LogQueryTimeRange{TimeRange: timeRange, StartTime: startTime, EndTime: endTime})
+	if err != nil {
+		return "", fmt.Errorf("render log query template: %w", err)
+	}
+
+	return sliceQuery.String(), nil
+}
+
+// isResultTooLargeError returns true if the error indicates that the results were truncated or rejected because of their size
+func isResultTooLargeError(err error) bool {
+	var errorInfo *azquery.ErrorInfo
+	if errors.As(err, &errorInfo) {
+		return errorInfo.Code == "PartialError" || strings.Contains(errorInfo.Error(), "E_QUERY_RESULT_SET_TOO_LARGE")
+	}
+
+	var responseError *azcore.ResponseError
+	if errors.As(err, &responseError) {
+		return strings.Contains(responseError.Error(), "ResponsePayloadTooLarge") || strings.Contains(responseError.Error(), "E_QUERY_RESULT_SET_TOO_LARGE")
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryInTimeSlices(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+
+	var partialError azquery.ErrorInfo
+	require.NoError(t, json.Unmarshal([]byte(`{"code":"PartialError","message":"too many rows"}`), &partialError))
+
+	var intervals []azquery.TimeInterval
+
+	queryFn := func(_ context.Context, _ string, interval azquery.TimeInterval) (azquery.Results, error) {
+		intervals = append(intervals, interval)
+
+		sliceStart, sliceEnd, err := interval.Values()
+		require.NoError(t, err)
+
+		// Slices longer than 12 hours return too many results
+		if sliceEnd.Sub(sliceStart) > 12*time.Hour {
+			return azquery.Results{Error: &partialError}, nil
+		}
+
+		return azquery.Results{Tables: []*azquery.Table{{
+			Columns: []*azquery.Column{{Name: ptr.String("TimeGenerated")}},
+			Rows:    []azquery.Row{{sliceStart.Format(time.RFC3339)}},
+		}}}, nil
+	}
+
+	var entries []LogEntry
+
+	err := queryInTimeSlices(context.Background(), "StorageBlobLogs", start, end, queryFn, func(entry LogEntry) error {
+		entries = append(entries, entry)
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []LogEntry{
+		{TimeGenerated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{TimeGenerated: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{TimeGenerated: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{TimeGenerated: time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)},
+	}, entries)
+	assert.Equal(t, []azquery.TimeInterval{
+		azquery.NewTimeInterval(start, start.Add(24*time.Hour)),
+		azquery.NewTimeInterval(start, start.Add(12*time.Hour)),
+		azquery.NewTimeInterval(start.Add(12*time.Hour), start.Add(36*time.Hour)),
+		azquery.NewTimeInterval(start.Add(12*time.Hour), start.Add(24*time.Hour)),
+		azquery.NewTimeInterval(start.Add(24*time.Hour), start.Add(48*time.Hour)),
+		azquery.NewTimeInterval(start.Add(24*time.Hour), start.Add(36*time.Hour)),
+		azquery.NewTimeInterval(start.Add(36*time.Hour), start.Add(48*time.Hour)),
+	}, intervals)
+}
+
+func TestTimeSliceQuery(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "Filter is appended",
+			query: "StorageBlobLogs",
+			want:  "StorageBlobLogs | where TimeGenerated >= datetime(2024-01-01T00:00:00Z) and TimeGenerated < datetime(2024-01-01T01:00:00Z)",
+		},
+		{
+			name:  "Time range placeholder",
+			query: "StorageBlobLogs | where {{.TimeRange}} | project TimeGenerated",
+			want:  "StorageBlobLogs | where TimeGenerated >= datetime(2024-01-01T00:00:00Z) and TimeGenerated < datetime(2024-01-01T01:00:00Z) | project TimeGenerated",
+		},
+		{
+			name:  "Start and end placeholders",
+			query: "MyLogs | where Timestamp between ({{.StartTime}} .. {{.EndTime}})",
+			want:  "MyLogs | where Timestamp between (datetime(2024-01-01T00:00:00Z) .. datetime(2024-01-01T01:00:00Z))",
+		},
+		{
+			name:    "Unknown placeholder",
+			query:   "StorageBlobLogs | where {{.Unknown}}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timeSliceQuery(tt.query, start, end)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
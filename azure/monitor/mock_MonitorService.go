@@ -25,34 +25,173 @@ func (_m *MockMonitorService) EXPECT() *MockMonitorService_Expecter {
 	return &MockMonitorService_Expecter{mock: &_m.Mock}
 }
 
-// GetLogs provides a mock function with given fields: ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName
-func (_m *MockMonitorService) GetLogs(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup string, nameSpace string, resourceType string, resourceName string) ([]LogEntry, error) {
-	ret := _m.Called(ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName)
+// EnableLogs provides a mock function with given fields: ctx, configMap, resourceGroup, nameSpace, resourceType, resourceName, workspaceID
+func (_m *MockMonitorService) EnableLogs(ctx context.Context, configMap *config.ConfigMap, resourceGroup string, nameSpace string, resourceType string, resourceName string, workspaceID string) error {
+	ret := _m.Called(ctx, configMap, resourceGroup, nameSpace, resourceType, resourceName, workspaceID)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetLogs")
+		panic("no return value specified for EnableLogs")
 	}
 
-	var r0 []LogEntry
-	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, *config.ConfigMap, string, time.Time, string, string, string, string) ([]LogEntry, error)); ok {
-		return rf(ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *config.ConfigMap, string, string, string, string, string) error); ok {
+		r0 = rf(ctx, configMap, resourceGroup, nameSpace, resourceType, resourceName, workspaceID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockMonitorService_EnableLogs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'EnableLogs'
+type MockMonitorService_EnableLogs_Call struct {
+	*mock.Call
+}
+
+// EnableLogs is a helper method to define mock.On call
+//   - ctx context.Context
+//   - configMap *config.ConfigMap
+//   - resourceGroup string
+//   - nameSpace string
+//   - resourceType string
+//   - resourceName string
+//   - workspaceID string
+func (_e *MockMonitorService_Expecter) EnableLogs(ctx interface{}, configMap interface{}, resourceGroup interface{}, nameSpace interface{}, resourceType interface{}, resourceName interface{}, workspaceID interface{}) *MockMonitorService_EnableLogs_Call {
+	return &MockMonitorService_EnableLogs_Call{Call: _e.mock.On("EnableLogs", ctx, configMap, resourceGroup, nameSpace, resourceType, resourceName, workspaceID)}
+}
+
+func (_c *MockMonitorService_EnableLogs_Call) Run(run func(ctx context.Context, configMap *config.ConfigMap, resourceGroup string, nameSpace string, resourceType string, resourceName string, workspaceID string)) *MockMonitorService_EnableLogs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*config.ConfigMap), args[2].(string), args[3].(string), args[4].(string), args[5].(string), args[6].(string))
+	})
+	return _c
+}
+
+func (_c *MockMonitorService_EnableLogs_Call) Return(_a0 error) *MockMonitorService_EnableLogs_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockMonitorService_EnableLogs_Call) RunAndReturn(run func(context.Context, *config.ConfigMap, string, string, string, string, string) error) *MockMonitorService_EnableLogs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetActivityLogs provides a mock function with given fields: ctx, configMap, startDate, handler
+func (_m *MockMonitorService) GetActivityLogs(ctx context.Context, configMap *config.ConfigMap, startDate time.Time, handler func(ActivityLogEntry) error) error {
+	ret := _m.Called(ctx, configMap, startDate, handler)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetActivityLogs")
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, *config.ConfigMap, string, time.Time, string, string, string, string) []LogEntry); ok {
-		r0 = rf(ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *config.ConfigMap, time.Time, func(ActivityLogEntry) error) error); ok {
+		r0 = rf(ctx, configMap, startDate, handler)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]LogEntry)
-		}
+		r0 = ret.Error(0)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, *config.ConfigMap, string, time.Time, string, string, string, string) error); ok {
-		r1 = rf(ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName)
+	return r0
+}
+
+// MockMonitorService_GetActivityLogs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetActivityLogs'
+type MockMonitorService_GetActivityLogs_Call struct {
+	*mock.Call
+}
+
+// GetActivityLogs is a helper method to define mock.On call
+//   - ctx context.Context
+//   - configMap *config.ConfigMap
+//   - startDate time.Time
+//   - handler func(ActivityLogEntry) error
+func (_e *MockMonitorService_Expecter) GetActivityLogs(ctx interface{}, configMap interface{}, startDate interface{}, handler interface{}) *MockMonitorService_GetActivityLogs_Call {
+	return &MockMonitorService_GetActivityLogs_Call{Call: _e.mock.On("GetActivityLogs", ctx, configMap, startDate, handler)}
+}
+
+func (_c *MockMonitorService_GetActivityLogs_Call) Run(run func(ctx context.Context, configMap *config.ConfigMap, startDate time.Time, handler func(ActivityLogEntry) error)) *MockMonitorService_GetActivityLogs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*config.ConfigMap), args[2].(time.Time), args[3].(func(ActivityLogEntry) error))
+	})
+	return _c
+}
+
+func (_c *MockMonitorService_GetActivityLogs_Call) Return(_a0 error) *MockMonitorService_GetActivityLogs_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockMonitorService_GetActivityLogs_Call) RunAndReturn(run func(context.Context, *config.ConfigMap, time.Time, func(ActivityLogEntry) error) error) *MockMonitorService_GetActivityLogs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetArchivedLogs provides a mock function with given fields: ctx, configMap, setting, startDate, handler
+func (_m *MockMonitorService) GetArchivedLogs(ctx context.Context, configMap *config.ConfigMap, setting *ResourceDiagnosticSetting, startDate time.Time, handler func(LogEntry) error) error {
+	ret := _m.Called(ctx, configMap, setting, startDate, handler)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetArchivedLogs")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *config.ConfigMap, *ResourceDiagnosticSetting, time.Time, func(LogEntry) error) error); ok {
+		r0 = rf(ctx, configMap, setting, startDate, handler)
 	} else {
-		r1 = ret.Error(1)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1
+	return r0
+}
+
+// MockMonitorService_GetArchivedLogs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetArchivedLogs'
+type MockMonitorService_GetArchivedLogs_Call struct {
+	*mock.Call
+}
+
+// GetArchivedLogs is a helper method to define mock.On call
+//   - ctx context.Context
+//   - configMap *config.ConfigMap
+//   - setting *ResourceDiagnosticSetting
+//   - startDate time.Time
+//   - handler func(LogEntry) error
+func (_e *MockMonitorService_Expecter) GetArchivedLogs(ctx interface{}, configMap interface{}, setting interface{}, startDate interface{}, handler interface{}) *MockMonitorService_GetArchivedLogs_Call {
+	return &MockMonitorService_GetArchivedLogs_Call{Call: _e.mock.On("GetArchivedLogs", ctx, configMap, setting, startDate, handler)}
+}
+
+func (_c *MockMonitorService_GetArchivedLogs_Call) Run(run func(ctx context.Context, configMap *config.ConfigMap, setting *ResourceDiagnosticSetting, startDate time.Time, handler func(LogEntry) error)) *MockMonitorService_GetArchivedLogs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*config.ConfigMap), args[2].(*ResourceDiagnosticSetting), args[3].(time.Time), args[4].(func(LogEntry) error))
+	})
+	return _c
+}
+
+func (_c *MockMonitorService_GetArchivedLogs_Call) Return(_a0 error) *MockMonitorService_GetArchivedLogs_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockMonitorService_GetArchivedLogs_Call) RunAndReturn(run func(context.Context, *config.ConfigMap, *ResourceDiagnosticSetting, time.Time, func(LogEntry) error) error) *MockMonitorService_GetArchivedLogs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetLogs provides a mock function with given fields: ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName, handler
+func (_m *MockMonitorService) GetLogs(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup string, nameSpace string, resourceType string, resourceName string, handler func(LogEntry) error) error {
+	ret := _m.Called(ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName, handler)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetLogs")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *config.ConfigMap, string, time.Time, string, string, string, string, func(LogEntry) error) error); ok {
+		r0 = rf(ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName, handler)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
 }
 
 // MockMonitorService_GetLogs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetLogs'
@@ -69,23 +208,24 @@ type MockMonitorService_GetLogs_Call struct {
 //   - nameSpace string
 //   - resourceType string
 //   - resourceName string
-func (_e *MockMonitorService_Expecter) GetLogs(ctx interface{}, configMap interface{}, query interface{}, startDate interface{}, resourceGroup interface{}, nameSpace interface{}, resourceType interface{}, resourceName interface{}) *MockMonitorService_GetLogs_Call {
-	return &MockMonitorService_GetLogs_Call{Call: _e.mock.On("GetLogs", ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName)}
+//   - handler func(LogEntry) error
+func (_e *MockMonitorService_Expecter) GetLogs(ctx interface{}, configMap interface{}, query interface{}, startDate interface{}, resourceGroup interface{}, nameSpace interface{}, resourceType interface{}, resourceName interface{}, handler interface{}) *MockMonitorService_GetLogs_Call {
+	return &MockMonitorService_GetLogs_Call{Call: _e.mock.On("GetLogs", ctx, configMap, query, startDate, resourceGroup, nameSpace, resourceType, resourceName, handler)}
 }
 
-func (_c *MockMonitorService_GetLogs_Call) Run(run func(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup string, nameSpace string, resourceType string, resourceName string)) *MockMonitorService_GetLogs_Call {
+func (_c *MockMonitorService_GetLogs_Call) Run(run func(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup string, nameSpace string, resourceType string, resourceName string, handler func(LogEntry) error)) *MockMonitorService_GetLogs_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(*config.ConfigMap), args[2].(string), args[3].(time.Time), args[4].(string), args[5].(string), args[6].(string), args[7].(string))
+		run(args[0].(context.Context), args[1].(*config.ConfigMap), args[2].(string), args[3].(time.Time), args[4].(string), args[5].(string), args[6].(string), args[7].(string), args[8].(func(LogEntry) error))
 	})
 	return _c
 }
 
-func (_c *MockMonitorService_GetLogs_Call) Return(_a0 []LogEntry, _a1 error) *MockMonitorService_GetLogs_Call {
-	_c.Call.Return(_a0, _a1)
+func (_c *MockMonitorService_GetLogs_Call) Return(_a0 error) *MockMonitorService_GetLogs_Call {
+	_c.Call.Return(_a0)
 	return _c
 }
 
-func (_c *MockMonitorService_GetLogs_Call) RunAndReturn(run func(context.Context, *config.ConfigMap, string, time.Time, string, string, string, string) ([]LogEntry, error)) *MockMonitorService_GetLogs_Call {
+func (_c *MockMonitorService_GetLogs_Call) RunAndReturn(run func(context.Context, *config.ConfigMap, string, time.Time, string, string, string, string, func(LogEntry) error) error) *MockMonitorService_GetLogs_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -153,6 +293,57 @@ func (_c *MockMonitorService_GetResourceDiagnosticSetting_Call) RunAndReturn(run
 	return _c
 }
 
+// GetWorkspaceLogs provides a mock function with given fields: ctx, configMap, workspaceID, query, startDate, handler
+func (_m *MockMonitorService) GetWorkspaceLogs(ctx context.Context, configMap *config.ConfigMap, workspaceID string, query string, startDate time.Time, handler func(LogEntry) error) error {
+	ret := _m.Called(ctx, configMap, workspaceID, query, startDate, handler)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetWorkspaceLogs")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *config.ConfigMap, string, string, time.Time, func(LogEntry) error) error); ok {
+		r0 = rf(ctx, configMap, workspaceID, query, startDate, handler)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockMonitorService_GetWorkspaceLogs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetWorkspaceLogs'
+type MockMonitorService_GetWorkspaceLogs_Call struct {
+	*mock.Call
+}
+
+// GetWorkspaceLogs is a helper method to define mock.On call
+//   - ctx context.Context
+//   - configMap *config.ConfigMap
+//   - workspaceID string
+//   - query string
+//   - startDate time.Time
+//   - handler func(LogEntry) error
+func (_e *MockMonitorService_Expecter) GetWorkspaceLogs(ctx interface{}, configMap interface{}, workspaceID interface{}, query interface{}, startDate interface{}, handler interface{}) *MockMonitorService_GetWorkspaceLogs_Call {
+	return &MockMonitorService_GetWorkspaceLogs_Call{Call: _e.mock.On("GetWorkspaceLogs", ctx, configMap, workspaceID, query, startDate, handler)}
+}
+
+func (_c *MockMonitorService_GetWorkspaceLogs_Call) Run(run func(ctx context.Context, configMap *config.ConfigMap, workspaceID string, query string, startDate time.Time, handler func(LogEntry) error)) *MockMonitorService_GetWorkspaceLogs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*config.ConfigMap), args[2].(string), args[3].(string), args[4].(time.Time), args[5].(func(LogEntry) error))
+	})
+	return _c
+}
+
+func (_c *MockMonitorService_GetWorkspaceLogs_Call) Return(_a0 error) *MockMonitorService_GetWorkspaceLogs_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockMonitorService_GetWorkspaceLogs_Call) RunAndReturn(run func(context.Context, *config.ConfigMap, string, string, time.Time, func(LogEntry) error) error) *MockMonitorService_GetWorkspaceLogs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // HasLogsEnabled provides a mock function with given fields: ctx, configMap, resourceGroup, nameSpace, resourceType, resourceName
 func (_m *MockMonitorService) HasLogsEnabled(ctx context.Context, configMap *config.ConfigMap, resourceGroup string, nameSpace string, resourceType string, resourceName string) (bool, error) {
 	ret := _m.Called(ctx, configMap, resourceGroup, nameSpace, resourceType, resourceName)
@@ -3,41 +3,116 @@ package monitor
 import (
 	"reflect"
 	"strings"
-
-	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+	"time"
 )
 
 type ResourceDiagnosticSetting struct {
-	Resource        string `json:"resource"`
-	WorkspaceID     string `json:"workspace_id"`
-	ReadLogsEnabled bool   `json:"read_logs_enabled"`
+	Resource          string `json:"resource"`
+	WorkspaceID       string `json:"workspace_id"`
+	StorageAccountID  string `json:"storage_account_id"`
+	ReadLogsEnabled   bool   `json:"read_logs_enabled"`
+	WriteLogsEnabled  bool   `json:"write_logs_enabled"`
+	DeleteLogsEnabled bool   `json:"delete_logs_enabled"`
 }
 
+// LogEntry is a single request in the storage logs. Rows of Log Analytics queries are decoded into it by DecodeRow.
 type LogEntry struct {
-	TimeGenerated      string
-	OperationName      string
-	ObjectKey          string
-	RequesterObjectId  string
-	AuthenticationType string
-	CorrelationId      string
-}
-
-func (l LogEntry) FromRow(row azquery.Row, columns []*azquery.Column) LogEntry {
-	structValue := reflect.ValueOf(&l).Elem()
-	structType := structValue.Type()
-
-	for i := 0; i < structValue.NumField(); i++ {
-		field := structValue.Field(i)
-		fieldType := structType.Field(i)
-		fieldName := fieldType.Name
-
-		for j, col := range columns {
-			if strings.EqualFold(fieldName, *col.Name) {
-				field.Set(reflect.ValueOf(row[j]))
-				break
-			}
-		}
+	TimeGenerated      time.Time `kusto:"TimeGenerated"`
+	OperationName      string    `kusto:"OperationName"`
+	ObjectKey          string    `kusto:"ObjectKey"`
+	RequesterObjectId  string    `kusto:"RequesterObjectId"`
+	RequesterAppId     string    `kusto:"RequesterAppId"`
+	RequesterTenantId  string    `kusto:"RequesterTenantId"`
+	AuthenticationType string    `kusto:"AuthenticationType"`
+	CorrelationId      string    `kusto:"CorrelationId"`
+	ResourceId         string    `kusto:"ResourceId"`
+	MetricResponseType string    `kusto:"MetricResponseType"`
+	StatusCode         string    `kusto:"StatusCode"`
+	StatusText         string    `kusto:"StatusText"`
+	AuthenticationHash string    `kusto:"AuthenticationHash"`
+	CallerIpAddress    string    `kusto:"CallerIpAddress"`
+	UserAgentHeader    string    `kusto:"UserAgentHeader"`
+	RequestBodySize    int64     `kusto:"RequestBodySize"`
+	ResponseBodySize   int64     `kusto:"ResponseBodySize"`
+	DurationMs         int64     `kusto:"DurationMs"`
+	ServerLatencyMs    int64     `kusto:"ServerLatencyMs"`
+}
+
+// ResponseTypeFromStatusCode returns the MetricResponseType of the storage logs that corresponds with the HTTP status code, for logs that don't contain it.
+func ResponseTypeFromStatusCode(statusCode int) string {
+	switch {
+	case statusCode < 400:
+		return "Success"
+	case statusCode == 401 || statusCode == 403:
+		return "AuthorizationError"
+	case statusCode == 408:
+		return "ClientTimeoutError"
+	case statusCode < 500:
+		return "ClientOtherError"
+	default:
+		return "ServerOtherError"
+	}
+}
+
+// SqlAuditEntry is a single record of the SQL Security Audit Events that Azure SQL auditing sends to the AzureDiagnostics table.
+// Rows of Log Analytics queries are decoded into it by DecodeRow.
+type SqlAuditEntry struct {
+	TimeGenerated         time.Time `kusto:"TimeGenerated"`
+	ResourceId            string    `kusto:"ResourceId"`
+	EventId               string    `kusto:"event_id_g"`
+	ActionId              string    `kusto:"action_id_s"`
+	ActionName            string    `kusto:"action_name_s"`
+	Succeeded             bool      `kusto:"succeeded_s"`
+	ServerName            string    `kusto:"LogicalServerName_s"`
+	DatabaseName          string    `kusto:"database_name_s"`
+	SchemaName            string    `kusto:"schema_name_s"`
+	ObjectName            string    `kusto:"object_name_s"`
+	Statement             string    `kusto:"statement_s"`
+	ServerPrincipalName   string    `kusto:"server_principal_name_s"`
+	DatabasePrincipalName string    `kusto:"database_principal_name_s"`
+	AdditionalInformation string    `kusto:"additional_information_s"`
+	AffectedRows          int64     `kusto:"affected_rows_d"`
+	ResponseRows          int64     `kusto:"response_rows_d"`
+	DurationMilliseconds  int64     `kusto:"duration_milliseconds_d"`
+}
+
+// ActivityLogEntry is a single management operation in the Activity Log of the subscription
+type ActivityLogEntry struct {
+	EventTimestamp  time.Time
+	EventDataId     string
+	CorrelationId   string
+	OperationName   string
+	ResourceId      string
+	Status          string
+	SubStatus       string
+	Caller          string
+	CallerObjectId  string
+	CallerIpAddress string
+}
+
+// LogEntryColumns returns the result columns that are decoded into the fields of LogEntry
+func LogEntryColumns() []string {
+	return kustoColumns(reflect.TypeOf(LogEntry{}))
+}
+
+// SqlAuditEntryColumns returns the result columns that are decoded into the fields of SqlAuditEntry
+func SqlAuditEntryColumns() []string {
+	return kustoColumns(reflect.TypeOf(SqlAuditEntry{}))
+}
+
+func kustoColumns(structType reflect.Type) []string {
+	columns := make([]string, 0, structType.NumField())
+
+	for i := 0; i < structType.NumField(); i++ {
+		columns = append(columns, structType.Field(i).Tag.Get(kustoTag))
 	}
 
-	return l
+	return columns
+}
+
+// IsLogEntryColumn returns true if the result column is decoded into a field of LogEntry. Columns are matched case-insensitively.
+func IsLogEntryColumn(column string) bool {
+	_, found := kustoFields(reflect.TypeOf(LogEntry{}))[strings.ToLower(column)]
+
+	return found
 }
@@ -7,24 +7,39 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/aws/smithy-go/ptr"
 	"github.com/raito-io/cli-plugin-azure/global"
 	"github.com/raito-io/cli/base"
 	"github.com/raito-io/cli/base/util/config"
 )
 
+const usageDiagnosticSettingName = "raito-usage-logs"
+
+// usageLogCategories are the log categories of a storage service that contain the requests used for data usage
+var usageLogCategories = []string{"StorageRead", "StorageWrite", "StorageDelete"}
+
 //go:generate go run github.com/vektra/mockery/v2 --name=MonitorService --with-expecter --inpackage
 type MonitorService interface {
 	HasLogsEnabled(ctx context.Context, configMap *config.ConfigMap, resourceGroup, nameSpace, resourceType, resourceName string) (bool, error)
 	GetResourceDiagnosticSetting(ctx context.Context, configMap *config.ConfigMap, resourceGroup, nameSpace, resourceType, resourceName string) (*ResourceDiagnosticSetting, error)
-	GetLogs(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup, nameSpace, resourceType, resourceName string) ([]LogEntry, error)
+	EnableLogs(ctx context.Context, configMap *config.ConfigMap, resourceGroup, nameSpace, resourceType, resourceName, workspaceID string) error
+	GetLogs(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup, nameSpace, resourceType, resourceName string, handler func(entry LogEntry) error) error
+	GetWorkspaceLogs(ctx context.Context, configMap *config.ConfigMap, workspaceID string, query string, startDate time.Time, handler func(entry LogEntry) error) error
+	GetArchivedLogs(ctx context.Context, configMap *config.ConfigMap, setting *ResourceDiagnosticSetting, startDate time.Time, handler func(entry LogEntry) error) error
+	GetActivityLogs(ctx context.Context, configMap *config.ConfigMap, startDate time.Time, handler func(entry ActivityLogEntry) error) error
 }
 
 type monitorService struct {
 	resourceDiagSettings map[string]*ResourceDiagnosticSetting
+	workspaceCustomerIds map[string]string
 }
 
 func NewMonitorService() MonitorService {
-	return &monitorService{resourceDiagSettings: make(map[string]*ResourceDiagnosticSetting)}
+	return &monitorService{
+		resourceDiagSettings: make(map[string]*ResourceDiagnosticSetting),
+		workspaceCustomerIds: make(map[string]string),
+	}
 }
 
 func (m *monitorService) HasLogsEnabled(ctx context.Context, configMap *config.ConfigMap, resourceGroup, nameSpace, resourceType, resourceName string) (bool, error) {
@@ -37,7 +52,7 @@ func (m *monitorService) HasLogsEnabled(ctx context.Context, configMap *config.C
 		return false, nil
 	}
 
-	return setting.ReadLogsEnabled, nil
+	return setting.ReadLogsEnabled || setting.WriteLogsEnabled || setting.DeleteLogsEnabled, nil
 }
 
 func (m *monitorService) GetResourceDiagnosticSetting(ctx context.Context, configMap *config.ConfigMap, resourceGroup, nameSpace, resourceType, resourceName string) (*ResourceDiagnosticSetting, error) {
@@ -61,16 +76,20 @@ func (m *monitorService) GetResourceDiagnosticSetting(ctx context.Context, confi
 		}
 
 		for _, v := range page.Value {
-			if v.Properties.WorkspaceID == nil {
+			if v.Properties.WorkspaceID == nil && v.Properties.StorageAccountID == nil {
 				continue
 			}
 
-			split := strings.Split(*v.Properties.WorkspaceID, "/")
+			// Querying a workspace is preferred over reading logs that are archived to a storage account
+			if existing, found := m.resourceDiagSettings[resourceURI]; found && existing.WorkspaceID != "" && v.Properties.WorkspaceID == nil {
+				continue
+			}
 
 			setting := ResourceDiagnosticSetting{
-				WorkspaceID:     split[len(split)-1],
-				Resource:        resourceURI,
-				ReadLogsEnabled: false,
+				WorkspaceID:      ptr.ToString(v.Properties.WorkspaceID),
+				StorageAccountID: ptr.ToString(v.Properties.StorageAccountID),
+				Resource:         resourceURI,
+				ReadLogsEnabled:  false,
 			}
 
 			for _, log := range v.Properties.Logs {
@@ -78,10 +97,16 @@ func (m *monitorService) GetResourceDiagnosticSetting(ctx context.Context, confi
 					continue
 				}
 
-				// category for azure blob storage is "StorageRead" we assume here that all other services will have read in their category, to be verified!
-				if strings.Contains(strings.ToLower(*log.Category), "read") {
+				// categories for azure blob storage are "StorageRead", "StorageWrite" and "StorageDelete" we assume here that all other services will have read, write and delete in their category, to be verified!
+				category := strings.ToLower(ptr.ToString(log.Category))
+
+				switch {
+				case strings.Contains(category, "read"):
 					setting.ReadLogsEnabled = true
-					break
+				case strings.Contains(category, "write"):
+					setting.WriteLogsEnabled = true
+				case strings.Contains(category, "delete"):
+					setting.DeleteLogsEnabled = true
 				}
 			}
 
@@ -92,34 +117,68 @@ func (m *monitorService) GetResourceDiagnosticSetting(ctx context.Context, confi
 	return m.resourceDiagSettings[resourceURI], nil
 }
 
-func (m *monitorService) GetLogs(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup, nameSpace, resourceType, resourceName string) ([]LogEntry, error) {
-	client, err := createAzQueryLogsClient(ctx, configMap.Parameters)
+// EnableLogs creates a diagnostic setting on the resource that sends its read, write and delete logs to the Log Analytics workspace with the given resource ID
+func (m *monitorService) EnableLogs(ctx context.Context, configMap *config.ConfigMap, resourceGroup, nameSpace, resourceType, resourceName, workspaceID string) error {
+	resourceURI := getResourceUri(configMap.GetString(global.AzSubscriptionId), resourceGroup, nameSpace, resourceType, resourceName)
 
+	client, err := createDiagnosticsSettingsClient(ctx, configMap.Parameters)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	interval := azquery.NewTimeInterval(startDate, time.Now())
+	logs := make([]*armmonitor.LogSettings, 0, len(usageLogCategories))
+	for _, category := range usageLogCategories {
+		logs = append(logs, &armmonitor.LogSettings{Category: ptr.String(category), Enabled: ptr.Bool(true)})
+	}
 
-	resp, err := client.QueryResource(ctx, getResourceUri(configMap.GetString(global.AzSubscriptionId), resourceGroup, nameSpace, resourceType, resourceName), azquery.Body{
-		Query:    &query,
-		Timespan: &interval,
+	_, err = client.CreateOrUpdate(ctx, strings.TrimSuffix(resourceURI, "/"), usageDiagnosticSettingName, armmonitor.DiagnosticSettingsResource{
+		Properties: &armmonitor.DiagnosticSettings{
+			WorkspaceID: ptr.String(workspaceID),
+			Logs:        logs,
+		},
 	}, nil)
+	if err != nil {
+		return fmt.Errorf("could not create diagnostic setting on %s: %w", resourceURI, err)
+	}
+
+	m.resourceDiagSettings[resourceURI] = &ResourceDiagnosticSetting{
+		Resource:          resourceURI,
+		WorkspaceID:       workspaceID,
+		ReadLogsEnabled:   true,
+		WriteLogsEnabled:  true,
+		DeleteLogsEnabled: true,
+	}
+
+	return nil
+}
+
+// GetLogs executes the query on the logs of the resource since startDate and passes every resulting row to the handler.
+// The time window is queried in slices so large windows stay within the limits of Log Analytics.
+func (m *monitorService) GetLogs(ctx context.Context, configMap *config.ConfigMap, query string, startDate time.Time, resourceGroup, nameSpace, resourceType, resourceName string, handler func(entry LogEntry) error) error {
+	client, err := createAzQueryLogsClient(ctx, configMap.Parameters)
 
 	if err != nil {
-		base.Logger().Error(err.Error())
-		return nil, err
+		return err
 	}
 
-	entries := make([]LogEntry, 0)
+	resourceURI := getResourceUri(configMap.GetString(global.AzSubscriptionId), resourceGroup, nameSpace, resourceType, resourceName)
 
-	for _, table := range resp.Tables {
-		for _, row := range table.Rows {
-			entries = append(entries, LogEntry{}.FromRow(row, table.Columns))
-		}
+	queryFn := func(ctx context.Context, query string, interval azquery.TimeInterval) (azquery.Results, error) {
+		resp, err := client.QueryResource(ctx, resourceURI, azquery.Body{
+			Query:    &query,
+			Timespan: &interval,
+		}, nil)
+
+		return resp.Results, err
+	}
+
+	err = queryInTimeSlices(ctx, query, startDate, time.Now(), queryFn, handler)
+	if err != nil {
+		base.Logger().Error(err.Error())
+		return err
 	}
 
-	return entries, nil
+	return nil
 }
 
 func getResourceUri(subscription, resourceGroup, nameSpace, resourceType, resourceName string) string {
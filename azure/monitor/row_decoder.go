@@ -0,0 +1,272 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+)
+
+const kustoTag = "kusto"
+
+var (
+	ErrInvalidDecodeTarget = errors.New("decode target must be a non-nil pointer to a struct")
+	ErrColumnTypeMismatch  = errors.New("column type mismatch")
+
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// DecodeRow decodes a row of a Log Analytics query result into the struct that target points to.
+// Fields are matched case-insensitively with the columns by their `kusto` tag, or by their name if they have no tag. Fields tagged with `kusto:"-"` are skipped.
+// Columns without a matching field are ignored, as queries can project more columns than needed. Null values leave the field untouched.
+func DecodeRow(row azquery.Row, columns []*azquery.Column, target any) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Pointer || targetValue.IsNil() || targetValue.Elem().Kind() != reflect.Struct {
+		return ErrInvalidDecodeTarget
+	}
+
+	structValue := targetValue.Elem()
+	fields := kustoFields(structValue.Type())
+
+	for i, column := range columns {
+		if column == nil || column.Name == nil || i >= len(row) || row[i] == nil {
+			continue
+		}
+
+		fieldIdx, found := fields[strings.ToLower(*column.Name)]
+		if !found {
+			continue
+		}
+
+		var columnType azquery.LogsColumnType
+		if column.Type != nil {
+			columnType = *column.Type
+		}
+
+		err := decodeValue(row[i], columnType, structValue.Field(fieldIdx))
+		if err != nil {
+			return fmt.Errorf("decode column %q: %w", *column.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// kustoFields returns the index of the exported fields of the struct type, keyed by their lowercase column name.
+func kustoFields(structType reflect.Type) map[string]int {
+	fields := make(map[string]int, structType.NumField())
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, found := field.Tag.Lookup(kustoTag); found {
+			if tag == "-" {
+				continue
+			}
+
+			name = tag
+		}
+
+		fields[strings.ToLower(name)] = i
+	}
+
+	return fields
+}
+
+// decodeValue converts the JSON decoded value of a column into the type of the field.
+func decodeValue(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	if field.Type() == timeType {
+		return decodeDatetime(value, columnType, field)
+	}
+
+	switch field.Kind() { //nolint:exhaustive
+	case reflect.String:
+		return decodeString(value, columnType, field)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return decodeInt(value, columnType, field)
+	case reflect.Float32, reflect.Float64:
+		return decodeFloat(value, columnType, field)
+	case reflect.Bool:
+		return decodeBool(value, columnType, field)
+	case reflect.Map, reflect.Slice, reflect.Struct, reflect.Interface:
+		return decodeDynamic(value, columnType, field)
+	default:
+		return fmt.Errorf("%w: unsupported field type %s", ErrColumnTypeMismatch, field.Type())
+	}
+}
+
+func decodeDatetime(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	s, ok := value.(string)
+	if !ok {
+		return mismatchError(value, columnType, field)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("%w: invalid datetime %q: %s", ErrColumnTypeMismatch, s, err.Error())
+	}
+
+	field.Set(reflect.ValueOf(t))
+
+	return nil
+}
+
+func decodeString(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	switch v := value.(type) {
+	case string:
+		field.SetString(v)
+	case float64:
+		field.SetString(strconv.FormatFloat(v, 'f', -1, 64))
+	case json.Number:
+		field.SetString(v.String())
+	case bool:
+		field.SetString(strconv.FormatBool(v))
+	case map[string]any, []any:
+		// Dynamic values are kept as their JSON representation
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrColumnTypeMismatch, err.Error())
+		}
+
+		field.SetString(string(raw))
+	default:
+		return mismatchError(value, columnType, field)
+	}
+
+	return nil
+}
+
+func decodeInt(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	var i int64
+
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v > math.MaxInt64 {
+			return mismatchError(value, columnType, field)
+		}
+
+		i = int64(v)
+	case json.Number:
+		parsed, err := v.Int64()
+		if err != nil {
+			return mismatchError(value, columnType, field)
+		}
+
+		i = parsed
+	case string:
+		// Decimal values and numbers in dynamic or string columns are returned as strings
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return mismatchError(value, columnType, field)
+		}
+
+		i = parsed
+	default:
+		return mismatchError(value, columnType, field)
+	}
+
+	if field.OverflowInt(i) {
+		return fmt.Errorf("%w: %d overflows %s", ErrColumnTypeMismatch, i, field.Type())
+	}
+
+	field.SetInt(i)
+
+	return nil
+}
+
+func decodeFloat(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	var f float64
+
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return mismatchError(value, columnType, field)
+		}
+
+		f = parsed
+	case string:
+		// Special values like NaN and decimal values are returned as strings
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return mismatchError(value, columnType, field)
+		}
+
+		f = parsed
+	default:
+		return mismatchError(value, columnType, field)
+	}
+
+	field.SetFloat(f)
+
+	return nil
+}
+
+func decodeBool(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	switch v := value.(type) {
+	case bool:
+		field.SetBool(v)
+	case float64:
+		// Older API versions return bool columns as 0 or 1
+		if v != 0 && v != 1 {
+			return mismatchError(value, columnType, field)
+		}
+
+		field.SetBool(v == 1)
+	case string:
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return mismatchError(value, columnType, field)
+		}
+
+		field.SetBool(parsed)
+	default:
+		return mismatchError(value, columnType, field)
+	}
+
+	return nil
+}
+
+// decodeDynamic decodes a dynamic column into a map, slice, struct or interface field.
+// Dynamic values are returned either as JSON encoded string or as already decoded JSON value.
+func decodeDynamic(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	var raw []byte
+
+	if s, ok := value.(string); ok && columnType != azquery.LogsColumnTypeString && json.Valid([]byte(s)) {
+		raw = []byte(s)
+	} else {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrColumnTypeMismatch, err.Error())
+		}
+
+		raw = encoded
+	}
+
+	err := json.Unmarshal(raw, field.Addr().Interface())
+	if err != nil {
+		return fmt.Errorf("%w: cannot decode %s into %s: %s", ErrColumnTypeMismatch, raw, field.Type(), err.Error())
+	}
+
+	return nil
+}
+
+func mismatchError(value any, columnType azquery.LogsColumnType, field reflect.Value) error {
+	if columnType == "" {
+		columnType = "unknown"
+	}
+
+	return fmt.Errorf("%w: cannot convert %s value %v (%T) to %s", ErrColumnTypeMismatch, columnType, value, value, field.Type())
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type decodeTarget struct {
+	Time       time.Time      `kusto:"TimeGenerated"`
+	Status     int            `kusto:"StatusCode"`
+	StatusText string         `kusto:"StatusCode_Text"`
+	Duration   float64        `kusto:"DurationMs"`
+	Success    bool           `kusto:"Success"`
+	Properties map[string]any `kusto:"Properties"`
+	Tags       []string       `kusto:"Tags"`
+	Skipped    string         `kusto:"-"`
+	Untagged   string
+}
+
+func column(name string, columnType azquery.LogsColumnType) *azquery.Column {
+	return &azquery.Column{Name: ptr.String(name), Type: &columnType}
+}
+
+func TestDecodeRow(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []*azquery.Column
+		row     azquery.Row
+		want    decodeTarget
+		wantErr bool
+	}{
+		{
+			name:    "Datetime",
+			columns: []*azquery.Column{column("TimeGenerated", azquery.LogsColumnTypeDatetime)},
+			row:     azquery.Row{"2024-01-02T03:04:05.1234567Z"},
+			want:    decodeTarget{Time: time.Date(2024, 1, 2, 3, 4, 5, 123456700, time.UTC)},
+		},
+		{
+			name:    "Columns are matched case-insensitively",
+			columns: []*azquery.Column{column("timegenerated", azquery.LogsColumnTypeDatetime), column("STATUSCODE", azquery.LogsColumnTypeLong)},
+			row:     azquery.Row{"2024-01-02T03:04:05Z", float64(404)},
+			want:    decodeTarget{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Status: 404},
+		},
+		{
+			name:    "Long",
+			columns: []*azquery.Column{column("StatusCode", azquery.LogsColumnTypeLong)},
+			row:     azquery.Row{float64(403)},
+			want:    decodeTarget{Status: 403},
+		},
+		{
+			name:    "Long into string",
+			columns: []*azquery.Column{column("StatusCode_Text", azquery.LogsColumnTypeLong)},
+			row:     azquery.Row{float64(200)},
+			want:    decodeTarget{StatusText: "200"},
+		},
+		{
+			name:    "Real",
+			columns: []*azquery.Column{column("DurationMs", azquery.LogsColumnTypeReal)},
+			row:     azquery.Row{12.5},
+			want:    decodeTarget{Duration: 12.5},
+		},
+		{
+			name:    "Bool",
+			columns: []*azquery.Column{column("Success", azquery.LogsColumnTypeBool)},
+			row:     azquery.Row{true},
+			want:    decodeTarget{Success: true},
+		},
+		{
+			name:    "Dynamic as JSON string",
+			columns: []*azquery.Column{column("Properties", azquery.LogsColumnTypeDynamic), column("Tags", azquery.LogsColumnTypeDynamic)},
+			row:     azquery.Row{`{"key":"value"}`, `["a","b"]`},
+			want:    decodeTarget{Properties: map[string]any{"key": "value"}, Tags: []string{"a", "b"}},
+		},
+		{
+			name:    "Dynamic as decoded value",
+			columns: []*azquery.Column{column("Properties", azquery.LogsColumnTypeDynamic)},
+			row:     azquery.Row{map[string]any{"key": float64(1)}},
+			want:    decodeTarget{Properties: map[string]any{"key": float64(1)}},
+		},
+		{
+			name:    "Null values and unknown columns are ignored",
+			columns: []*azquery.Column{column("StatusCode", azquery.LogsColumnTypeLong), column("Unknown", azquery.LogsColumnTypeString), column("Untagged", azquery.LogsColumnTypeString)},
+			row:     azquery.Row{nil, "ignored", "value"},
+			want:    decodeTarget{Untagged: "value"},
+		},
+		{
+			name:    "Skipped field",
+			columns: []*azquery.Column{column("Skipped", azquery.LogsColumnTypeString)},
+			row:     azquery.Row{"value"},
+			want:    decodeTarget{},
+		},
+		{
+			name:    "String into long",
+			columns: []*azquery.Column{column("StatusCode", azquery.LogsColumnTypeString)},
+			row:     azquery.Row{"not a number"},
+			wantErr: true,
+		},
+		{
+			name:    "Real into long",
+			columns: []*azquery.Column{column("StatusCode", azquery.LogsColumnTypeReal)},
+			row:     azquery.Row{1.5},
+			wantErr: true,
+		},
+		{
+			name:    "Long into datetime",
+			columns: []*azquery.Column{column("TimeGenerated", azquery.LogsColumnTypeLong)},
+			row:     azquery.Row{float64(1)},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid datetime",
+			columns: []*azquery.Column{column("TimeGenerated", azquery.LogsColumnTypeDatetime)},
+			row:     azquery.Row{"yesterday"},
+			wantErr: true,
+		},
+		{
+			name:    "String into bool",
+			columns: []*azquery.Column{column("Success", azquery.LogsColumnTypeString)},
+			row:     azquery.Row{"maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "Dynamic into wrong type",
+			columns: []*azquery.Column{column("Tags", azquery.LogsColumnTypeDynamic)},
+			row:     azquery.Row{`{"key":"value"}`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got decodeTarget
+
+			err := DecodeRow(tt.row, tt.columns, &got)
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrColumnTypeMismatch)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDecodeRow_InvalidTarget(t *testing.T) {
+	columns := []*azquery.Column{column("StatusCode", azquery.LogsColumnTypeLong)}
+	row := azquery.Row{float64(200)}
+
+	var entry LogEntry
+
+	assert.ErrorIs(t, DecodeRow(row, columns, entry), ErrInvalidDecodeTarget)
+	assert.ErrorIs(t, DecodeRow(row, columns, (*LogEntry)(nil)), ErrInvalidDecodeTarget)
+
+	require.NoError(t, DecodeRow(row, columns, &entry))
+	assert.Equal(t, LogEntry{StatusCode: "200"}, entry)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/operationalinsights/armoperationalinsights"
 	"github.com/raito-io/cli-plugin-azure/global"
 )
 
@@ -39,3 +40,13 @@ func createAzQueryLogsClient(ctx context.Context, params map[string]string) (*az
 
 	return azquery.NewLogsClient(cred, nil)
 }
+
+func createWorkspacesClient(ctx context.Context, params map[string]string, subscriptionId string) (*armoperationalinsights.WorkspacesClient, error) {
+	cred, err := global.CreateADClientSecretCredential(ctx, params)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not create a credential from a secret: %w", err)
+	}
+
+	return armoperationalinsights.NewWorkspacesClient(subscriptionId, cred, nil)
+}
@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+	"github.com/raito-io/cli/base"
+	"github.com/raito-io/cli/base/util/config"
+)
+
+// GetWorkspaceLogs executes the query on the Log Analytics workspace with the given resource ID since startDate and passes every resulting row to the handler.
+func (m *monitorService) GetWorkspaceLogs(ctx context.Context, configMap *config.ConfigMap, workspaceID string, query string, startDate time.Time, handler func(entry LogEntry) error) error {
+	return queryWorkspace(ctx, m, configMap, workspaceID, query, startDate, handler)
+}
+
+// QueryWorkspace executes the query on the Log Analytics workspace with the given resource ID since startDate and passes every resulting row, decoded into an entry of type T, to the handler.
+// It is used for other tables than the storage logs, e.g. the SQL auditing records in SqlAuditEntry.
+func QueryWorkspace[T any](ctx context.Context, configMap *config.ConfigMap, workspaceID string, query string, startDate time.Time, handler func(entry T) error) error {
+	m := &monitorService{
+		resourceDiagSettings: make(map[string]*ResourceDiagnosticSetting),
+		workspaceCustomerIds: make(map[string]string),
+	}
+
+	return queryWorkspace(ctx, m, configMap, workspaceID, query, startDate, handler)
+}
+
+// queryWorkspace executes the query on a Log Analytics workspace in time slices and decodes the resulting rows into entries of type T
+func queryWorkspace[T any](ctx context.Context, m *monitorService, configMap *config.ConfigMap, workspaceID string, query string, startDate time.Time, handler func(entry T) error) error {
+	customerId, err := m.getWorkspaceCustomerId(ctx, configMap, workspaceID)
+	if err != nil {
+		return fmt.Errorf("could not resolve the ID of workspace %q: %w", workspaceID, err)
+	}
+
+	client, err := createAzQueryLogsClient(ctx, configMap.Parameters)
+	if err != nil {
+		return err
+	}
+
+	queryFn := func(ctx context.Context, query string, interval azquery.TimeInterval) (azquery.Results, error) {
+		resp, err := client.QueryWorkspace(ctx, customerId, azquery.Body{
+			Query:    &query,
+			Timespan: &interval,
+		}, nil)
+
+		return resp.Results, err
+	}
+
+	err = queryInTimeSlices(ctx, query, startDate, time.Now(), queryFn, handler)
+	if err != nil {
+		base.Logger().Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// getWorkspaceCustomerId returns the ID that is used to query the workspace, which differs from its resource ID.
+func (m *monitorService) getWorkspaceCustomerId(ctx context.Context, configMap *config.ConfigMap, workspaceID string) (string, error) {
+	if customerId, found := m.workspaceCustomerIds[workspaceID]; found {
+		return customerId, nil
+	}
+
+	resourceId, err := arm.ParseResourceID(workspaceID)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := createWorkspacesClient(ctx, configMap.Parameters, resourceId.SubscriptionID)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Get(ctx, resourceId.ResourceGroupName, resourceId.Name, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Properties == nil || resp.Properties.CustomerID == nil || *resp.Properties.CustomerID == "" {
+		return "", fmt.Errorf("no customer ID found for workspace %q", workspaceID)
+	}
+
+	m.workspaceCustomerIds[workspaceID] = *resp.Properties.CustomerID
+
+	return *resp.Properties.CustomerID, nil
+}
+
+// ParseResourceId returns the resource group and the name of the resource in an Azure resource ID of the given type (e.g. "storageAccounts").
+func ParseResourceId(resourceId string, resourceType string) (string, string, bool) {
+	parts := strings.Split(strings.Trim(resourceId, "/"), "/")
+
+	resourceGroup := ""
+	resourceName := ""
+
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "resourcegroups") {
+			resourceGroup = parts[i+1]
+		} else if strings.EqualFold(parts[i], resourceType) && resourceName == "" {
+			resourceName = parts[i+1]
+		}
+	}
+
+	return resourceGroup, resourceName, resourceGroup != "" && resourceName != ""
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResourceId(t *testing.T) {
+	tests := []struct {
+		name              string
+		resourceId        string
+		resourceType      string
+		wantResourceGroup string
+		wantName          string
+		wantFound         bool
+	}{
+		{
+			name:              "Blob service",
+			resourceId:        "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account/blobServices/default",
+			resourceType:      "storageAccounts",
+			wantResourceGroup: "rg",
+			wantName:          "account",
+			wantFound:         true,
+		},
+		{
+			name:              "Upper case _ResourceId",
+			resourceId:        "/SUBSCRIPTIONS/SUB/RESOURCEGROUPS/RG/PROVIDERS/MICROSOFT.STORAGE/STORAGEACCOUNTS/ACCOUNT",
+			resourceType:      "storageAccounts",
+			wantResourceGroup: "RG",
+			wantName:          "ACCOUNT",
+			wantFound:         true,
+		},
+		{
+			name:         "Other resource type",
+			resourceId:   "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Sql/servers/server",
+			resourceType: "storageAccounts",
+		},
+		{
+			name:         "Without resource group",
+			resourceId:   "/subscriptions/sub/providers/Microsoft.Storage/storageAccounts/account",
+			resourceType: "storageAccounts",
+		},
+		{
+			name:         "Truncated after the resource type",
+			resourceId:   "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts",
+			resourceType: "storageAccounts",
+		},
+		{
+			name:         "Empty",
+			resourceType: "storageAccounts",
+		},
+		{
+			name:         "Not a resource ID",
+			resourceId:   "account/container/blob",
+			resourceType: "storageAccounts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resourceGroup, name, found := ParseResourceId(tt.resourceId, tt.resourceType)
+
+			assert.Equal(t, tt.wantFound, found)
+
+			if tt.wantFound {
+				assert.Equal(t, tt.wantResourceGroup, resourceGroup)
+				assert.Equal(t, tt.wantName, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package sql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+)
+
+// auditObjectActions maps the action IDs of audit records on a single object to the kind of usage they represent
+var auditObjectActions = map[string]data_usage.ActionType{
+	"SL": data_usage.Read,
+	"IN": data_usage.Write,
+	"UP": data_usage.Write,
+	"DL": data_usage.Write,
+}
+
+// auditBatchActions are the action IDs of completed batches and remote procedure calls, of which the statement is analyzed
+var auditBatchActions = []string{"BCM", "RCM"}
+
+// auditQuery returns the query on the SQL Security Audit Events in the AzureDiagnostics table of a Log Analytics workspace
+func auditQuery() string {
+	actionIds := make([]string, 0, len(auditObjectActions)+len(auditBatchActions))
+	for actionId := range auditObjectActions {
+		actionIds = append(actionIds, fmt.Sprintf("%q", actionId))
+	}
+
+	for _, actionId := range auditBatchActions {
+		actionIds = append(actionIds, fmt.Sprintf("%q", actionId))
+	}
+
+	sort.Strings(actionIds)
+
+	return fmt.Sprintf("AzureDiagnostics | where Category == \"SQLSecurityAuditEvents\" and action_id_s in (%s) and isnotempty(statement_s) | project %s", strings.Join(actionIds, ", "), strings.Join(monitor.SqlAuditEntryColumns(), ", "))
+}
+
+// auditEntryToStatement converts an audit record into a data usage statement. It returns nil if the record doesn't represent usage of a table or database.
+// The data objects are named <subscription>/<resource group>/<server>/<database>/<schema>/<table>, like the SQL data objects of the data source.
+// AzureDiagnostics converts resource IDs to upper case, so the resource group and server are looked up in the known servers. Unknown servers are reported in lower case.
+func auditEntryToStatement(subscriptionId string, servers map[string]sqlServer, entry monitor.SqlAuditEntry) *data_usage.Statement {
+	resourceGroup, server, found := monitor.ParseResourceId(entry.ResourceId, "servers")
+	if !found || entry.DatabaseName == "" || systemDatabases[strings.ToLower(entry.DatabaseName)] {
+		return nil
+	}
+
+	if entry.ServerName != "" {
+		server = entry.ServerName
+	}
+
+	serverFullName := fmt.Sprintf("%s/%s/%s", subscriptionId, strings.ToLower(resourceGroup), strings.ToLower(server))
+	if known, found := servers[sqlServerKey(resourceGroup, server)]; found {
+		serverFullName = fmt.Sprintf("%s/%s/%s", subscriptionId, known.resourceGroup, known.name)
+	}
+
+	databaseFullName := fmt.Sprintf("%s/%s", serverFullName, entry.DatabaseName)
+
+	var accessedDataObjects []data_usage.UsageDataObjectItem
+
+	tableItem := func(database, schema, table string, action data_usage.ActionType) data_usage.UsageDataObjectItem {
+		return data_usage.UsageDataObjectItem{
+			DataObject: data_usage.UsageDataObjectReference{
+				FullName: fmt.Sprintf("%s/%s/%s/%s", serverFullName, database, schema, table),
+				Type:     Table,
+			},
+			Permissions:      []string{entry.ActionName},
+			GlobalPermission: action,
+		}
+	}
+
+	if action, found := auditObjectActions[entry.ActionId]; found {
+		if entry.ObjectName == "" || entry.SchemaName == "" || systemSchemas[strings.ToLower(entry.SchemaName)] {
+			return nil
+		}
+
+		accessedDataObjects = append(accessedDataObjects, tableItem(entry.DatabaseName, entry.SchemaName, entry.ObjectName, action))
+	} else {
+		parsed := parseStatement(entry.Statement)
+		if parsed.action == data_usage.UnknownAction {
+			return nil
+		}
+
+		for _, table := range parsed.tables {
+			database := table.database
+			if database == "" {
+				database = entry.DatabaseName
+			}
+
+			action := data_usage.Read
+			if table.target {
+				action = parsed.action
+			}
+
+			accessedDataObjects = append(accessedDataObjects, tableItem(database, table.schema, table.name, action))
+		}
+
+		if len(accessedDataObjects) == 0 {
+			accessedDataObjects = append(accessedDataObjects, data_usage.UsageDataObjectItem{
+				DataObject: data_usage.UsageDataObjectReference{
+					FullName: databaseFullName,
+					Type:     Database,
+				},
+				Permissions:      []string{entry.ActionName},
+				GlobalPermission: parsed.action,
+			})
+		}
+	}
+
+	user := entry.ServerPrincipalName
+	if user == "" {
+		user = entry.DatabasePrincipalName
+	}
+
+	// Audit records are written when the statement completes
+	var startTime, endTime int64
+	if !entry.TimeGenerated.IsZero() {
+		startTime = entry.TimeGenerated.Add(-time.Duration(entry.DurationMilliseconds) * time.Millisecond).Unix()
+		endTime = entry.TimeGenerated.Unix()
+	}
+
+	rows := entry.ResponseRows
+	if rows == 0 {
+		rows = entry.AffectedRows
+	}
+
+	statement := &data_usage.Statement{
+		ExternalId:          entry.EventId,
+		AccessedDataObjects: accessedDataObjects,
+		User:                user,
+		Success:             entry.Succeeded,
+		Query:               entry.Statement,
+		StartTime:           startTime,
+		EndTime:             endTime,
+		Rows:                int(rows),
+	}
+
+	if !statement.Success {
+		statement.Error = entry.AdditionalInformation
+		if statement.Error == "" {
+			statement.Error = "Statement failed"
+		}
+	}
+
+	return statement
+}
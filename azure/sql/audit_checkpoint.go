@@ -0,0 +1,128 @@
+package sql
+
+import (
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const (
+	auditCheckpointStateName = "sql-audit-checkpoint"
+
+	// auditCheckpointOverlap is the window before the checkpoint that is queried again, as audit records are not ingested in order and can arrive after later records were handled already
+	auditCheckpointOverlap = 30 * time.Minute
+)
+
+// auditWorkspaceCheckpoint is the high-water mark of the audit records in a workspace that were handled in previous syncs
+type auditWorkspaceCheckpoint struct {
+	LastTimeGenerated time.Time `json:"lastTimeGenerated"`
+	// EventIds are the audit records in the overlap window before LastTimeGenerated that were handled already, with their timestamp
+	EventIds map[string]time.Time `json:"eventIds,omitempty"`
+}
+
+// auditCheckpoint keeps track of the audit records that were handled per workspace, so the next sync only queries the records since the checkpoint.
+// Records that were handled before are skipped, so the overlap window never results in duplicate statements.
+type auditCheckpoint struct {
+	path string
+	key  string
+
+	// start is the time from which the audit records of the workspace need to be synced
+	start time.Time
+	// previous are the records that were handled in previous syncs
+	previous map[string]time.Time
+
+	Workspaces map[string]*auditWorkspaceCheckpoint `json:"workspaces"`
+}
+
+// loadAuditCheckpoint reads the checkpoint of the workspace. Without a checkpoint, the audit records are synced from startDate.
+func loadAuditCheckpoint(configParams *config.ConfigMap, workspaceID string, startDate time.Time) (*auditCheckpoint, error) {
+	path, err := global.StateFilePath(configParams.Parameters, auditCheckpointStateName)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &auditCheckpoint{
+		path:  path,
+		key:   strings.ToLower(workspaceID),
+		start: startDate,
+	}
+
+	err = global.LoadState(path, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpoint.Workspaces == nil {
+		checkpoint.Workspaces = make(map[string]*auditWorkspaceCheckpoint)
+	}
+
+	if workspace, found := checkpoint.Workspaces[checkpoint.key]; found {
+		checkpoint.start = workspace.LastTimeGenerated.Add(-auditCheckpointOverlap)
+		checkpoint.previous = maps.Clone(workspace.EventIds)
+
+		if windowStart := global.DataUsageWindowStart(configParams); checkpoint.start.Before(windowStart) {
+			checkpoint.start = windowStart
+		}
+	}
+
+	return checkpoint, nil
+}
+
+// handle passes the record to the handler if it was not handled in a previous sync and records it in the checkpoint.
+// The record is only recorded if the handler succeeds, so records that were rejected (e.g. because the maximum file size is reached) are handled again in the next sync.
+func (c *auditCheckpoint) handle(entry monitor.SqlAuditEntry, handler func(entry monitor.SqlAuditEntry) error) error {
+	if entry.TimeGenerated.IsZero() || entry.EventId == "" {
+		// Records without a timestamp or ID can't be checkpointed
+		return handler(entry)
+	}
+
+	if entry.TimeGenerated.Before(c.start) {
+		return nil
+	}
+
+	if _, handled := c.previous[entry.EventId]; handled {
+		return nil
+	}
+
+	err := handler(entry)
+	if err != nil {
+		return err
+	}
+
+	workspace := c.Workspaces[c.key]
+	if workspace == nil {
+		workspace = &auditWorkspaceCheckpoint{LastTimeGenerated: entry.TimeGenerated}
+		c.Workspaces[c.key] = workspace
+	}
+
+	if workspace.EventIds == nil {
+		workspace.EventIds = make(map[string]time.Time)
+	}
+
+	workspace.EventIds[entry.EventId] = entry.TimeGenerated
+
+	if entry.TimeGenerated.After(workspace.LastTimeGenerated) {
+		workspace.LastTimeGenerated = entry.TimeGenerated
+	}
+
+	return nil
+}
+
+// save persists the checkpoint. It should only be called once the handled records are written, so failed syncs are retried from the previous checkpoint.
+// Records before the overlap window are not queried anymore, so they are removed from the checkpoint.
+func (c *auditCheckpoint) save() error {
+	for _, workspace := range c.Workspaces {
+		overlapStart := workspace.LastTimeGenerated.Add(-auditCheckpointOverlap)
+
+		maps.DeleteFunc(workspace.EventIds, func(_ string, timeGenerated time.Time) bool {
+			return timeGenerated.Before(overlapStart)
+		})
+	}
+
+	return global.SaveState(c.path, c)
+}
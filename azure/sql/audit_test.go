@@ -0,0 +1,201 @@
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const testServerResourceId = "/SUBSCRIPTIONS/SUB/RESOURCEGROUPS/MYGROUP/PROVIDERS/MICROSOFT.SQL/SERVERS/MYSERVER/DATABASES/SALES"
+
+func TestAuditEntryToStatement(t *testing.T) {
+	t.Run("Batch", func(t *testing.T) {
+		statement := auditEntryToStatement("sub", nil, monitor.SqlAuditEntry{
+			TimeGenerated:        time.Date(2024, 1, 1, 10, 0, 1, 0, time.UTC),
+			ResourceId:           testServerResourceId,
+			EventId:              "event",
+			ActionId:             "BCM",
+			ActionName:           "BATCH COMPLETED",
+			Succeeded:            true,
+			ServerName:           "myserver",
+			DatabaseName:         "Sales",
+			Statement:            "INSERT INTO dbo.Archive SELECT * FROM dbo.Orders",
+			ServerPrincipalName:  "alice@example.com",
+			AffectedRows:         12,
+			DurationMilliseconds: 1000,
+		})
+
+		require.NotNil(t, statement)
+		assert.Equal(t, data_usage.Statement{
+			ExternalId: "event",
+			AccessedDataObjects: []data_usage.UsageDataObjectItem{
+				{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/mygroup/myserver/Sales/dbo/Archive", Type: Table},
+					Permissions:      []string{"BATCH COMPLETED"},
+					GlobalPermission: data_usage.Write,
+				},
+				{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/mygroup/myserver/Sales/dbo/Orders", Type: Table},
+					Permissions:      []string{"BATCH COMPLETED"},
+					GlobalPermission: data_usage.Read,
+				},
+			},
+			User:      "alice@example.com",
+			Success:   true,
+			Query:     "INSERT INTO dbo.Archive SELECT * FROM dbo.Orders",
+			StartTime: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC).Unix(),
+			EndTime:   time.Date(2024, 1, 1, 10, 0, 1, 0, time.UTC).Unix(),
+			Rows:      12,
+		}, *statement)
+	})
+
+	t.Run("Single object", func(t *testing.T) {
+		statement := auditEntryToStatement("sub", nil, monitor.SqlAuditEntry{
+			TimeGenerated:         time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+			ResourceId:            testServerResourceId,
+			ActionId:              "SL",
+			ActionName:            "SELECT",
+			DatabaseName:          "Sales",
+			SchemaName:            "sales",
+			ObjectName:            "Orders",
+			Statement:             "SELECT * FROM Orders",
+			DatabasePrincipalName: "reporting",
+			AdditionalInformation: "<permission_denied/>",
+		})
+
+		require.NotNil(t, statement)
+		assert.Equal(t, []data_usage.UsageDataObjectItem{
+			{
+				DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/mygroup/myserver/Sales/sales/Orders", Type: Table},
+				Permissions:      []string{"SELECT"},
+				GlobalPermission: data_usage.Read,
+			},
+		}, statement.AccessedDataObjects)
+		assert.Equal(t, "reporting", statement.User)
+		assert.False(t, statement.Success)
+		assert.Equal(t, "<permission_denied/>", statement.Error)
+	})
+
+	t.Run("Statement without tables", func(t *testing.T) {
+		statement := auditEntryToStatement("sub", nil, monitor.SqlAuditEntry{
+			ResourceId:   testServerResourceId,
+			ActionId:     "BCM",
+			ActionName:   "BATCH COMPLETED",
+			Succeeded:    true,
+			DatabaseName: "Sales",
+			Statement:    "GRANT SELECT TO reporting",
+		})
+
+		require.NotNil(t, statement)
+		assert.Equal(t, []data_usage.UsageDataObjectItem{
+			{
+				DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/mygroup/myserver/Sales", Type: Database},
+				Permissions:      []string{"BATCH COMPLETED"},
+				GlobalPermission: data_usage.Admin,
+			},
+		}, statement.AccessedDataObjects)
+	})
+
+	t.Run("Known server", func(t *testing.T) {
+		servers := map[string]sqlServer{sqlServerKey("mygroup", "myserver"): {resourceGroup: "MyGroup", name: "myserver"}}
+
+		statement := auditEntryToStatement("sub", servers, monitor.SqlAuditEntry{ResourceId: testServerResourceId, ActionId: "BCM", DatabaseName: "Sales", Statement: "SELECT * FROM Orders", Succeeded: true})
+
+		require.NotNil(t, statement)
+		assert.Equal(t, "sub/MyGroup/myserver/Sales/dbo/Orders", statement.AccessedDataObjects[0].DataObject.FullName)
+	})
+
+	t.Run("Ignored", func(t *testing.T) {
+		assert.Nil(t, auditEntryToStatement("sub", nil, monitor.SqlAuditEntry{ResourceId: testServerResourceId, ActionId: "BCM", DatabaseName: "Sales", Statement: "SET NOCOUNT ON"}))
+		assert.Nil(t, auditEntryToStatement("sub", nil, monitor.SqlAuditEntry{ResourceId: testServerResourceId, ActionId: "SL", DatabaseName: "Sales", SchemaName: "sys", ObjectName: "tables"}))
+		assert.Nil(t, auditEntryToStatement("sub", nil, monitor.SqlAuditEntry{ResourceId: "/subscriptions/sub/resourceGroups/rg", ActionId: "BCM", DatabaseName: "Sales", Statement: "SELECT 1"}))
+		assert.Nil(t, auditEntryToStatement("sub", nil, monitor.SqlAuditEntry{ResourceId: testServerResourceId, ActionId: "BCM", DatabaseName: "master", Statement: "SELECT * FROM dbo.Orders"}))
+	})
+}
+
+func TestSyncAuditUsage(t *testing.T) {
+	configParams := &config.ConfigMap{Parameters: map[string]string{global.AzSubscriptionId: "sub", global.AzStateDirectory: t.TempDir()}}
+	now := time.Now().UTC().Truncate(time.Second)
+	startDate := now.Add(-3 * time.Hour)
+
+	servers := map[string]sqlServer{sqlServerKey("mygroup", "myserver"): {resourceGroup: "MyGroup", name: "myserver"}}
+
+	record := func(eventId string, statement string, timeGenerated time.Time) monitor.SqlAuditEntry {
+		return monitor.SqlAuditEntry{TimeGenerated: timeGenerated, EventId: eventId, ResourceId: testServerResourceId, ActionId: "BCM", DatabaseName: "Sales", Statement: statement, Succeeded: true}
+	}
+
+	sync := func(wantStart time.Time, records []monitor.SqlAuditEntry, commit func(st data_usage.Statement) error) error {
+		queryFn := func(_ context.Context, _ *config.ConfigMap, workspaceID string, query string, start time.Time, handler func(monitor.SqlAuditEntry) error) error {
+			assert.Equal(t, "workspace", workspaceID)
+			assert.Equal(t, auditQuery(), query)
+			assert.True(t, wantStart.Equal(start), "start %s, want %s", start, wantStart)
+
+			for _, r := range records {
+				err := handler(r)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		return syncAuditUsage(context.Background(), queryFn, "workspace", startDate, servers, configParams, commit)
+	}
+
+	var ids []string
+
+	collect := func(st data_usage.Statement) error {
+		ids = append(ids, st.ExternalId)
+
+		return nil
+	}
+
+	// Without a checkpoint, the records are synced from the start date
+	err := sync(startDate, []monitor.SqlAuditEntry{
+		record("e1", "SELECT * FROM dbo.Orders", now.Add(-2*time.Hour)),
+		record("e2", "SET NOCOUNT ON", now.Add(-90*time.Minute)),
+		record("e3", "SELECT * FROM dbo.Customers", now.Add(-time.Hour)),
+	}, collect)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e1", "e3"}, ids)
+
+	// The next sync queries the overlap window before the checkpoint again and only commits the records that were not handled yet
+	ids = nil
+
+	err = sync(now.Add(-time.Hour-auditCheckpointOverlap), []monitor.SqlAuditEntry{
+		record("late", "SELECT * FROM dbo.Orders", now.Add(-80*time.Minute)),
+		record("e3", "SELECT * FROM dbo.Customers", now.Add(-time.Hour)),
+		record("e4", "DELETE FROM dbo.Orders", now.Add(-30*time.Minute)),
+		record("e5", "SELECT * FROM dbo.Orders", now.Add(-20*time.Minute)),
+	}, func(st data_usage.Statement) error {
+		if st.ExternalId == "e5" {
+			return global.ErrMaxUsageFileSizeReached
+		}
+
+		return collect(st)
+	})
+
+	// The checkpoint is saved up to the statements that were written when the maximum file size is reached
+	require.ErrorIs(t, err, global.ErrMaxUsageFileSizeReached)
+	assert.Equal(t, []string{"late", "e4"}, ids)
+
+	ids = nil
+
+	err = sync(now.Add(-30*time.Minute-auditCheckpointOverlap), []monitor.SqlAuditEntry{
+		record("e4", "DELETE FROM dbo.Orders", now.Add(-30*time.Minute)),
+		record("e5", "SELECT * FROM dbo.Orders", now.Add(-20*time.Minute)),
+	}, collect)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e5"}, ids)
+}
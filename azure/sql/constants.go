@@ -0,0 +1,16 @@
+package sql
+
+const (
+	AzApiNamespace = "Microsoft.Sql"
+
+	// Subscription and ResourceGroup are the same data object types as the ones of the storage data objects
+	Subscription  = "subscription"
+	ResourceGroup = "resourcegroup"
+	Server        = "sqlserver"
+	Database      = "sqldatabase"
+	Schema        = "schema"
+	Table         = "table"
+
+	// defaultSchema is the schema of tables that are referenced without a schema
+	defaultSchema = "dbo"
+)
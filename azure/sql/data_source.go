@@ -0,0 +1,300 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/sql/armsql"
+	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/cli/base/wrappers"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// DataSourceSyncer adds the Azure SQL servers with their databases, schemas and tables to the data source, so the SQL audit usage refers to known data objects.
+// The schemas and tables are listed through Azure Resource Manager, no connection to the databases is made.
+// They are only synced when the SQL audit usage is enabled, as listing them requires read access to the SQL servers.
+type DataSourceSyncer struct {
+	config *ds.DataSourceSyncConfig
+}
+
+func (s *DataSourceSyncer) SyncDataSource(ctx context.Context, dataSourceHandler wrappers.DataSourceObjectHandler, config *ds.DataSourceSyncConfig) error {
+	s.config = config
+	configMap := config.GetConfigMap()
+	subscriptionId := configMap.GetString(global.AzSubscriptionId)
+
+	if configMap.GetStringWithDefault(global.AzSqlAuditWorkspace, "") == "" {
+		logger.Debug(fmt.Sprintf("No workspace configured in %s, skipping the SQL data objects", global.AzSqlAuditWorkspace))
+
+		return nil
+	}
+
+	clientFactory, err := createSqlClientFactory(ctx, configMap.Parameters)
+	if err != nil {
+		return err
+	}
+
+	servers, err := getSqlServers(ctx, clientFactory)
+	if err != nil {
+		// Azure SQL is optional, the storage data objects are still synced
+		logger.Warn(fmt.Sprintf("Unable to list the Azure SQL servers, skipping the SQL data objects: %s", err.Error()))
+
+		return nil
+	}
+
+	if len(servers) == 0 {
+		return nil
+	}
+
+	if s.shouldHandle(subscriptionId) {
+		err = dataSourceHandler.AddDataObjects(&ds.DataObject{
+			ExternalId:       subscriptionId,
+			Name:             fmt.Sprintf("subscription-%s", subscriptionId),
+			FullName:         subscriptionId,
+			Type:             Subscription,
+			ParentExternalId: "",
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	addedResourceGroups := make(map[string]bool)
+
+	for _, server := range servers {
+		resourceGroup := fmt.Sprintf("%s/%s", subscriptionId, server.resourceGroup)
+		if !s.shouldGoInto(resourceGroup) {
+			continue
+		}
+
+		if !addedResourceGroups[resourceGroup] && s.shouldHandle(resourceGroup) {
+			addedResourceGroups[resourceGroup] = true
+
+			err = dataSourceHandler.AddDataObjects(&ds.DataObject{
+				ExternalId:       resourceGroup,
+				Name:             server.resourceGroup,
+				FullName:         resourceGroup,
+				Type:             ResourceGroup,
+				ParentExternalId: subscriptionId,
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err = s.syncServer(ctx, clientFactory, resourceGroup, server, dataSourceHandler)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Failed to sync SQL server '%s/%s': %s", resourceGroup, server.name, err.Error()))
+		}
+	}
+
+	return nil
+}
+
+func (s *DataSourceSyncer) syncServer(ctx context.Context, clientFactory *armsql.ClientFactory, parent string, server sqlServer, dataSourceHandler wrappers.DataSourceObjectHandler) error {
+	serverFullName := fmt.Sprintf("%s/%s", parent, server.name)
+	if !s.shouldGoInto(serverFullName) {
+		return nil
+	}
+
+	logger.Info(fmt.Sprintf("Processing SQL server %s", server.name))
+
+	err := s.addDataObject(dataSourceHandler, serverFullName, server.name, Server, parent)
+	if err != nil {
+		return err
+	}
+
+	pager := clientFactory.NewDatabasesClient().NewListByServerPager(server.resourceGroup, server.name, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, database := range page.Value {
+			if systemDatabases[strings.ToLower(*database.Name)] {
+				continue
+			}
+
+			err = s.syncDatabase(ctx, clientFactory, serverFullName, server, *database.Name, dataSourceHandler)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *DataSourceSyncer) syncDatabase(ctx context.Context, clientFactory *armsql.ClientFactory, parent string, server sqlServer, database string, dataSourceHandler wrappers.DataSourceObjectHandler) error {
+	databaseFullName := fmt.Sprintf("%s/%s", parent, database)
+	if !s.shouldGoInto(databaseFullName) {
+		return nil
+	}
+
+	err := s.addDataObject(dataSourceHandler, databaseFullName, database, Database, parent)
+	if err != nil {
+		return err
+	}
+
+	pager := clientFactory.NewDatabaseSchemasClient().NewListByDatabasePager(server.resourceGroup, server.name, database, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, schema := range page.Value {
+			if systemSchemas[strings.ToLower(*schema.Name)] {
+				continue
+			}
+
+			err = s.syncSchema(ctx, clientFactory, databaseFullName, server, database, *schema.Name, dataSourceHandler)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *DataSourceSyncer) syncSchema(ctx context.Context, clientFactory *armsql.ClientFactory, parent string, server sqlServer, database string, schema string, dataSourceHandler wrappers.DataSourceObjectHandler) error {
+	schemaFullName := fmt.Sprintf("%s/%s", parent, schema)
+	if !s.shouldGoInto(schemaFullName) {
+		return nil
+	}
+
+	err := s.addDataObject(dataSourceHandler, schemaFullName, schema, Schema, parent)
+	if err != nil {
+		return err
+	}
+
+	pager := clientFactory.NewDatabaseTablesClient().NewListBySchemaPager(server.resourceGroup, server.name, database, schema, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, table := range page.Value {
+			err = s.addDataObject(dataSourceHandler, fmt.Sprintf("%s/%s", schemaFullName, *table.Name), *table.Name, Table, schemaFullName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *DataSourceSyncer) addDataObject(dataSourceHandler wrappers.DataSourceObjectHandler, fullName string, name string, doType string, parent string) error {
+	if !s.shouldHandle(fullName) {
+		return nil
+	}
+
+	return dataSourceHandler.AddDataObjects(&ds.DataObject{
+		ExternalId:       fullName,
+		Name:             name,
+		FullName:         fullName,
+		Type:             doType,
+		ParentExternalId: parent,
+	})
+}
+
+func (s *DataSourceSyncer) GetDataObjectTypes(_ context.Context) ([]string, []*ds.DataObjectType) {
+	logger.Debug("Returning meta data for Azure SQL data source")
+
+	return []string{Subscription}, []*ds.DataObjectType{
+		{
+			Name:     Subscription,
+			Type:     Subscription,
+			Children: []string{ResourceGroup},
+		},
+		{
+			Name:     ResourceGroup,
+			Type:     ResourceGroup,
+			Children: []string{Server},
+		},
+		{
+			Name:        Server,
+			Type:        Server,
+			Permissions: []*ds.DataObjectTypePermission{},
+			Children:    []string{Database},
+		},
+		{
+			Name:        Database,
+			Type:        Database,
+			Permissions: []*ds.DataObjectTypePermission{},
+			Actions:     batchActions(),
+			Children:    []string{Schema},
+		},
+		{
+			Name:        Schema,
+			Type:        Schema,
+			Permissions: []*ds.DataObjectTypePermission{},
+			Children:    []string{Table},
+		},
+		{
+			Name:        Table,
+			Type:        Table,
+			Permissions: []*ds.DataObjectTypePermission{},
+			Actions:     tableActions(),
+			Children:    []string{},
+		},
+	}
+}
+
+func (s *DataSourceSyncer) GetDataSourceIAMPermissions() []*ds.DataObjectTypePermission {
+	return []*ds.DataObjectTypePermission{}
+}
+
+// batchActions are the actions of the audit records of completed batches and remote procedure calls, which can read, write or administer the objects
+func batchActions() []*ds.DataObjectTypeAction {
+	return []*ds.DataObjectTypeAction{
+		{
+			Action:        "BATCH COMPLETED",
+			GlobalActions: []string{ds.Read, ds.Write, ds.Admin},
+		},
+		{
+			Action:        "RPC COMPLETED",
+			GlobalActions: []string{ds.Read, ds.Write, ds.Admin},
+		},
+	}
+}
+
+// tableActions are the actions of the audit records on a single table, together with the batch actions
+func tableActions() []*ds.DataObjectTypeAction {
+	return append([]*ds.DataObjectTypeAction{
+		{
+			Action:        "SELECT",
+			GlobalActions: []string{ds.Read},
+		},
+		{
+			Action:        "INSERT",
+			GlobalActions: []string{ds.Write},
+		},
+		{
+			Action:        "UPDATE",
+			GlobalActions: []string{ds.Write},
+		},
+		{
+			Action:        "DELETE",
+			GlobalActions: []string{ds.Write},
+		},
+	}, batchActions()...)
+}
+
+func (s *DataSourceSyncer) shouldHandle(fullName string) bool {
+	return global.ShouldHandleDataObject(s.config, fullName)
+}
+
+func (s *DataSourceSyncer) shouldGoInto(fullName string) bool {
+	return global.ShouldGoIntoDataObject(s.config, fullName)
+}
@@ -0,0 +1,36 @@
+package sql
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/raito-io/cli/base/wrappers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+type dataObjectCollector struct {
+	wrappers.DataSourceObjectHandler
+
+	dataObjects []*ds.DataObject
+}
+
+func (c *dataObjectCollector) AddDataObjects(dataObjects ...*ds.DataObject) error {
+	c.dataObjects = append(c.dataObjects, dataObjects...)
+
+	return nil
+}
+
+func TestDataSourceSyncer_SyncDataSource_WithoutAuditWorkspace(t *testing.T) {
+	handler := &dataObjectCollector{}
+
+	syncer := &DataSourceSyncer{}
+	err := syncer.SyncDataSource(context.Background(), handler, &ds.DataSourceSyncConfig{ConfigMap: &config.ConfigMap{Parameters: map[string]string{global.AzSubscriptionId: "sub"}}})
+	require.NoError(t, err)
+
+	assert.Empty(t, handler.dataObjects)
+}
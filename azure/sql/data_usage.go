@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// auditLogQueryFunc executes the query on the audit records in the workspace since startDate, e.g. monitor.QueryWorkspace
+type auditLogQueryFunc func(ctx context.Context, configMap *config.ConfigMap, workspaceID string, query string, startDate time.Time, handler func(entry monitor.SqlAuditEntry) error) error
+
+// DataUsageSyncer reads the usage of Azure SQL databases from their auditing records in a Log Analytics workspace.
+// Audit logs that are written to .xel files in a storage account are not supported.
+type DataUsageSyncer struct {
+}
+
+func (s *DataUsageSyncer) SyncDataUsage(ctx context.Context, startDate time.Time, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
+	workspaceID := configParams.GetStringWithDefault(global.AzSqlAuditWorkspace, "")
+	if workspaceID == "" {
+		logger.Debug(fmt.Sprintf("No workspace configured in %s, skipping SQL audit usage", global.AzSqlAuditWorkspace))
+
+		return nil
+	}
+
+	servers := make(map[string]sqlServer)
+
+	clientFactory, err := createSqlClientFactory(ctx, configParams.Parameters)
+	if err != nil {
+		return err
+	}
+
+	serverList, err := getSqlServers(ctx, clientFactory)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Unable to list the Azure SQL servers, reporting the SQL usage with lower case resource group names: %s", err.Error()))
+	}
+
+	for _, server := range serverList {
+		servers[sqlServerKey(server.resourceGroup, server.name)] = server
+	}
+
+	return syncAuditUsage(ctx, monitor.QueryWorkspace[monitor.SqlAuditEntry], workspaceID, startDate, servers, configParams, commit)
+}
+
+// syncAuditUsage commits the statements of the audit records since the checkpoint of the workspace.
+// The checkpoint is saved when all records are handled, or when the maximum file size is reached so the next sync continues after the statements that were written.
+func syncAuditUsage(ctx context.Context, queryFn auditLogQueryFunc, workspaceID string, startDate time.Time, servers map[string]sqlServer, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
+	subscriptionId := configParams.GetString(global.AzSubscriptionId)
+
+	checkpoint, err := loadAuditCheckpoint(configParams, workspaceID, startDate)
+	if err != nil {
+		return err
+	}
+
+	err = queryFn(ctx, configParams, workspaceID, auditQuery(), checkpoint.start, func(entry monitor.SqlAuditEntry) error {
+		return checkpoint.handle(entry, func(entry monitor.SqlAuditEntry) error {
+			statement := auditEntryToStatement(subscriptionId, servers, entry)
+			if statement == nil {
+				return nil
+			}
+
+			return commit(*statement)
+		})
+	})
+
+	if err != nil && !errors.Is(err, global.ErrMaxUsageFileSizeReached) {
+		return fmt.Errorf("read SQL audit logs from workspace %q: %w", workspaceID, err)
+	}
+
+	errSave := checkpoint.save()
+	if errSave != nil {
+		return errSave
+	}
+
+	return err
+}
@@ -0,0 +1,295 @@
+package sql
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/raito-io/cli/base/data_usage"
+)
+
+// statementActions maps the keyword that starts a T-SQL statement to the kind of usage it represents
+var statementActions = map[string]data_usage.ActionType{
+	"select":   data_usage.Read,
+	"insert":   data_usage.Write,
+	"update":   data_usage.Write,
+	"delete":   data_usage.Write,
+	"merge":    data_usage.Write,
+	"truncate": data_usage.Write,
+	"bulk":     data_usage.Write,
+	"create":   data_usage.Admin,
+	"alter":    data_usage.Admin,
+	"drop":     data_usage.Admin,
+	"grant":    data_usage.Admin,
+	"revoke":   data_usage.Admin,
+	"deny":     data_usage.Admin,
+}
+
+// targetKeywords are the keywords that are followed by the table a statement modifies
+var targetKeywords = map[string]bool{"into": true, "update": true, "merge": true, "table": true}
+
+// sourceKeywords are the keywords that are followed by a table a statement reads from
+var sourceKeywords = map[string]bool{"from": true, "join": true, "using": true}
+
+// systemSchemas contain the catalog views, which are not reported as usage
+var systemSchemas = map[string]bool{"sys": true, "information_schema": true}
+
+// systemDatabases are not reported as data objects or usage
+var systemDatabases = map[string]bool{"master": true}
+
+// tableReference is a table that is referenced in a statement
+type tableReference struct {
+	// database is empty for tables in the database the statement was executed in
+	database string
+	schema   string
+	name     string
+	// target is true if the statement modifies the table, rather than reading from it
+	target bool
+}
+
+// sqlToken is a word, a (quoted) identifier or a single punctuation character of a statement
+type sqlToken struct {
+	value string
+	// identifier is true for words and quoted identifiers
+	identifier bool
+	// quoted is true for identifiers between brackets or double quotes, which are never keywords
+	quoted bool
+	depth  int
+}
+
+func (t sqlToken) keyword() string {
+	if !t.identifier || t.quoted {
+		return ""
+	}
+
+	return strings.ToLower(t.value)
+}
+
+// parsedStatement is the result of the best-effort analysis of a T-SQL batch
+type parsedStatement struct {
+	action data_usage.ActionType
+	tables []tableReference
+}
+
+// parseStatement determines the kind of usage and the referenced tables of a T-SQL batch.
+// This is not a full parser: tables are recognized by the keywords that precede them, which covers the common DML and DDL statements.
+// Temporary tables, table variables, common table expressions and catalog views are ignored.
+func parseStatement(statement string) parsedStatement {
+	tokens := tokenizeStatement(statement)
+
+	var parsed parsedStatement
+
+	// Common table expressions are defined as <name> AS (
+	cteNames := make(map[string]bool)
+
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].identifier && tokens[i+1].keyword() == "as" && tokens[i+2].value == "(" {
+			cteNames[strings.ToLower(tokens[i].value)] = true
+		}
+	}
+
+	seen := make(map[tableReference]bool)
+
+	addTable := func(i int, target bool) int {
+		table, next, found := readTableName(tokens, i)
+
+		// Table-valued functions are called like FROM <function>(...)
+		if !target && next < len(tokens) && tokens[next].value == "(" {
+			return next
+		}
+
+		if !found || cteNames[strings.ToLower(table.name)] || systemSchemas[strings.ToLower(table.schema)] {
+			return next
+		}
+
+		table.target = target
+
+		if !seen[table] {
+			seen[table] = true
+			parsed.tables = append(parsed.tables, table)
+		}
+
+		return next
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		keyword := tokens[i].keyword()
+
+		if action, found := statementActions[keyword]; found && tokens[i].depth == 0 && parsed.action == data_usage.UnknownAction {
+			parsed.action = action
+		}
+
+		switch {
+		case keyword == "insert" && i+1 < len(tokens) && tokens[i+1].keyword() != "into":
+			// INSERT <table> without INTO
+			i = addTable(i+1, true) - 1
+		case keyword == "delete":
+			// DELETE [FROM] <table>
+			next := i + 1
+			if next < len(tokens) && tokens[next].keyword() == "from" {
+				next++
+			}
+
+			i = addTable(next, true) - 1
+		case targetKeywords[keyword]:
+			i = addTable(i+1, true) - 1
+		case sourceKeywords[keyword]:
+			i = addTable(i+1, false) - 1
+
+			// FROM <table> [AS] [alias], <table> ...
+			for i+1 < len(tokens) {
+				next := i + 1
+				if tokens[next].keyword() == "as" {
+					next++
+				}
+
+				if next < len(tokens) && tokens[next].identifier && !isKeyword(tokens[next]) {
+					next++
+				}
+
+				if next >= len(tokens) || tokens[next].value != "," || keyword != "from" {
+					break
+				}
+
+				i = addTable(next+1, false) - 1
+			}
+		}
+	}
+
+	return parsed
+}
+
+// readTableName reads a (multipart) table name at position i and returns the position after it.
+// Names with a server part (linked servers) are not supported.
+func readTableName(tokens []sqlToken, i int) (tableReference, int, bool) {
+	var parts []string
+
+	for i < len(tokens) && tokens[i].identifier && (tokens[i].quoted || !isKeyword(tokens[i])) {
+		parts = append(parts, tokens[i].value)
+		i++
+
+		if i+1 < len(tokens) && tokens[i].value == "." {
+			i++
+		} else {
+			break
+		}
+	}
+
+	if len(parts) == 0 || len(parts) > 3 {
+		return tableReference{}, i, false
+	}
+
+	name := parts[len(parts)-1]
+	if strings.HasPrefix(name, "#") || strings.HasPrefix(name, "@") {
+		return tableReference{}, i, false
+	}
+
+	table := tableReference{name: name, schema: defaultSchema}
+
+	if len(parts) >= 2 && parts[len(parts)-2] != "" {
+		table.schema = parts[len(parts)-2]
+	}
+
+	if len(parts) == 3 {
+		table.database = parts[0]
+	}
+
+	return table, i, true
+}
+
+// isKeyword returns true if the unquoted token is a keyword that can follow a table name
+func isKeyword(token sqlToken) bool {
+	switch token.keyword() {
+	case "as", "where", "set", "select", "values", "on", "join", "inner", "left", "right", "full", "outer", "cross", "group", "order", "having", "with", "from", "into",
+		"union", "except", "intersect", "using", "when", "output", "option", "default", "top", "go", "exec", "execute", "insert", "update", "delete", "merge", "begin", "end":
+		return true
+	}
+
+	return false
+}
+
+// tokenizeStatement splits a T-SQL batch in tokens. Comments and string literals are skipped.
+func tokenizeStatement(statement string) []sqlToken {
+	var tokens []sqlToken
+
+	runes := []rune(statement)
+	depth := 0
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			rest := string(runes[i+2:])
+
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				return tokens
+			}
+
+			i += 2 + utf8.RuneCountInString(rest[:end]) + 2
+		case r == '\'':
+			i = skipQuoted(runes, i, '\'')
+		case r == '[' || r == '"':
+			closing := ']'
+			if r == '"' {
+				closing = '"'
+			}
+
+			end := skipQuoted(runes, i, closing)
+			value := strings.ReplaceAll(string(runes[i+1:max(i+1, end-1)]), string(closing)+string(closing), string(closing))
+			tokens = append(tokens, sqlToken{value: value, identifier: true, quoted: true, depth: depth})
+			i = end
+		case isIdentifierRune(r):
+			start := i
+			for i < len(runes) && isIdentifierRune(runes[i]) {
+				i++
+			}
+
+			tokens = append(tokens, sqlToken{value: string(runes[start:i]), identifier: true, depth: depth})
+		default:
+			if r == ')' && depth > 0 {
+				depth--
+			}
+
+			tokens = append(tokens, sqlToken{value: string(r), depth: depth})
+
+			if r == '(' {
+				depth++
+			}
+
+			i++
+		}
+	}
+
+	return tokens
+}
+
+// skipQuoted returns the position after the quoted value that starts at i. Doubled closing characters are escapes.
+func skipQuoted(runes []rune, i int, closing rune) int {
+	for i++; i < len(runes); i++ {
+		if runes[i] != closing {
+			continue
+		}
+
+		if i+1 < len(runes) && runes[i+1] == closing {
+			i++
+
+			continue
+		}
+
+		return i + 1
+	}
+
+	return len(runes)
+}
+
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '#' || r == '@' || r == '$'
+}
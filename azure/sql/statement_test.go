@@ -0,0 +1,91 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		name       string
+		statement  string
+		wantAction data_usage.ActionType
+		wantTables []tableReference
+	}{
+		{
+			name:       "Select",
+			statement:  "SELECT * FROM sales.Orders o JOIN [sales].[Order Lines] AS l ON o.Id = l.OrderId WHERE o.Status = 'from x'",
+			wantAction: data_usage.Read,
+			wantTables: []tableReference{{schema: "sales", name: "Orders"}, {schema: "sales", name: "Order Lines"}},
+		},
+		{
+			name:       "Default schema and comma separated tables",
+			statement:  "select a.x, b.y from Customers a, dbo.Regions b",
+			wantAction: data_usage.Read,
+			wantTables: []tableReference{{schema: "dbo", name: "Customers"}, {schema: "dbo", name: "Regions"}},
+		},
+		{
+			name:       "Other database",
+			statement:  "SELECT * FROM Archive.sales.Orders",
+			wantAction: data_usage.Read,
+			wantTables: []tableReference{{database: "Archive", schema: "sales", name: "Orders"}},
+		},
+		{
+			name:       "Insert select",
+			statement:  "SET NOCOUNT ON; INSERT INTO sales.Archive (Id) SELECT Id FROM sales.Orders",
+			wantAction: data_usage.Write,
+			wantTables: []tableReference{{schema: "sales", name: "Archive", target: true}, {schema: "sales", name: "Orders"}},
+		},
+		{
+			name:       "Update",
+			statement:  "UPDATE sales.Orders SET Status = 1 -- FROM dbo.Ignored",
+			wantAction: data_usage.Write,
+			wantTables: []tableReference{{schema: "sales", name: "Orders", target: true}},
+		},
+		{
+			name:       "Delete",
+			statement:  "/* cleanup from dbo.Ignored */ DELETE FROM sales.Orders WHERE Id IN (SELECT Id FROM #expired)",
+			wantAction: data_usage.Write,
+			wantTables: []tableReference{{schema: "sales", name: "Orders", target: true}},
+		},
+		{
+			name:       "Common table expression",
+			statement:  "WITH recent AS (SELECT * FROM sales.Orders) SELECT * FROM recent CROSS APPLY dbo.Split(recent.Tags)",
+			wantAction: data_usage.Read,
+			wantTables: []tableReference{{schema: "sales", name: "Orders"}},
+		},
+		{
+			name:       "Truncate",
+			statement:  "TRUNCATE TABLE staging.Load",
+			wantAction: data_usage.Write,
+			wantTables: []tableReference{{schema: "staging", name: "Load", target: true}},
+		},
+		{
+			name:       "Create table",
+			statement:  "CREATE TABLE dbo.Events (Id int)",
+			wantAction: data_usage.Admin,
+			wantTables: []tableReference{{schema: "dbo", name: "Events", target: true}},
+		},
+		{
+			name:       "Catalog views",
+			statement:  "SELECT name FROM sys.tables",
+			wantAction: data_usage.Read,
+		},
+		{
+			name:       "No usage",
+			statement:  "SET NOCOUNT ON",
+			wantAction: data_usage.UnknownAction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parseStatement(tt.statement)
+
+			assert.Equal(t, tt.wantAction, parsed.action)
+			assert.Equal(t, tt.wantTables, parsed.tables)
+		})
+	}
+}
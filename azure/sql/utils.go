@@ -0,0 +1,64 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/sql/armsql"
+	"github.com/hashicorp/go-hclog"
+	"github.com/raito-io/cli/base"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+var logger hclog.Logger
+
+func init() {
+	logger = base.Logger()
+}
+
+// sqlServer is a logical Azure SQL server
+type sqlServer struct {
+	resourceGroup string
+	name          string
+}
+
+func createSqlClientFactory(ctx context.Context, params map[string]string) (*armsql.ClientFactory, error) {
+	cred, err := global.CreateADClientSecretCredential(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a credential from a secret: %w", err)
+	}
+
+	return armsql.NewClientFactory(params[global.AzSubscriptionId], cred, nil)
+}
+
+func getSqlServers(ctx context.Context, clientFactory *armsql.ClientFactory) ([]sqlServer, error) {
+	var servers []sqlServer
+
+	pager := clientFactory.NewServersClient().NewListPager(nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range page.Value {
+			resourceId, err := arm.ParseResourceID(*v.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			servers = append(servers, sqlServer{resourceGroup: resourceId.ResourceGroupName, name: *v.Name})
+		}
+	}
+
+	return servers, nil
+}
+
+// sqlServerKey is the case-insensitive key of a server, as resource IDs in the AzureDiagnostics table are in upper case
+func sqlServerKey(resourceGroup, server string) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s", resourceGroup, server))
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/filesystem"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/cli/base/access_provider/sync_from_target"
+	"github.com/raito-io/cli/base/access_provider/types"
+	"github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/golang-set/set"
+
+	"github.com/raito-io/cli-plugin-azure/azure/constants"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// importFileACLs passes an access provider to the handler for each set of permissions granted through named entries in the ACL of a file.
+// Only the containers, folders and files that are synced as data objects are visited, within the same folder depth and file limits as the data source sync.
+// Only the ACL of files with an extended ACL (a '+' in their permissions) is read. Entries that Raito applied, on the file itself or through a grant on a directory above it, are skipped.
+func importFileACLs(ctx context.Context, config *data_source.DataSourceSyncConfig, handler func(ap *sync_from_target.AccessProvider) error) error {
+	params := config.GetConfigMap().Parameters
+	subscriptionId := params[global.AzSubscriptionId]
+
+	storageAccounts, err := getStorageAccounts(ctx, subscriptionId, params)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadACLState(params)
+	if err != nil {
+		return err
+	}
+
+	for resourceGroup, accounts := range storageAccounts {
+		for _, account := range accounts {
+			parent := fmt.Sprintf("%s/%s/%s", subscriptionId, resourceGroup, account)
+			if !global.ShouldGoIntoDataObject(config, parent) {
+				continue
+			}
+
+			err = importStorageAccountFileACLs(ctx, config, state, parent, account, handler)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Unable to import the file ACLs of storage account %s: %s", parent, err.Error()))
+			}
+		}
+	}
+
+	return nil
+}
+
+func importStorageAccountFileACLs(ctx context.Context, config *data_source.DataSourceSyncConfig, state *aclState, parent string, account string, handler func(ap *sync_from_target.AccessProvider) error) error {
+	client, err := createDataLakeServiceClient(ctx, account, config.GetConfigMap().Parameters)
+	if err != nil {
+		return err
+	}
+
+	pager := client.NewListFileSystemsPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, fs := range page.ListFileSystemsSegmentResponse.FileSystemItems {
+			if !global.ShouldGoIntoDataObject(config, fmt.Sprintf("%s/%s", parent, *fs.Name)) {
+				continue
+			}
+
+			errFs := importFileSystemACLs(ctx, config, state, client.NewFileSystemClient(*fs.Name), parent, account, *fs.Name, handler)
+			if errFs != nil {
+				logger.Warn(fmt.Sprintf("Unable to import the file ACLs of file system '%s/%s': %s", parent, *fs.Name, errFs.Error()))
+			}
+		}
+	}
+
+	return nil
+}
+
+func importFileSystemACLs(ctx context.Context, config *data_source.DataSourceSyncConfig, state *aclState, client *filesystem.Client, parent string, account string, fileSystem string, handler func(ap *sync_from_target.AccessProvider) error) error {
+	storageContainer := fmt.Sprintf("%s/%s", parent, fileSystem)
+
+	directory := ""
+	if prefix, f := strings.CutPrefix(config.DataObjectParent, storageContainer); f && config.DataObjectParent != "" {
+		directory = prefix
+	}
+
+	goInto := func(name string) bool {
+		return global.ShouldGoIntoDataObject(config, fmt.Sprintf("%s/%s", storageContainer, name))
+	}
+
+	return listPaths(ctx, client, directory, newDataObjectLimits(config.GetConfigMap()), goInto, func(p *filesystem.Path) error {
+		fullName := fmt.Sprintf("%s/%s", storageContainer, *p.Name)
+
+		if ptr.ToBool(p.IsDirectory) || !strings.HasSuffix(ptr.ToString(p.Permissions), "+") || !global.ShouldHandleDataObject(config, fullName) {
+			return nil
+		}
+
+		resp, err := client.NewFileClient(*p.Name).GetAccessControl(ctx, nil)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to read the ACL of file '%s': %s", fullName, err.Error()))
+
+			return nil
+		}
+
+		entries, err := ParseACL(ptr.ToString(resp.ACL))
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to parse the ACL of file '%s': %s", fullName, err.Error()))
+
+			return nil
+		}
+
+		item := ACLAssignedItem{StorageAccount: account, Container: fileSystem, Path: *p.Name, Type: ACLItemFile}
+
+		managed := inheritedAssignees(item, state)
+		for assignee := range state.entries(item) {
+			managed.Add(assignee)
+		}
+
+		for _, ap := range fileACLAccessProviders(fullName, entries, managed) {
+			err = handler(ap)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// fileACLAccessProviders groups the named access entries in the ACL of a file per effective permission set and returns an access provider for each group.
+// Entries of managed assignees and entries without effective permissions are skipped.
+func fileACLAccessProviders(fullName string, entries []ACLEntry, managed set.Set[ACLAssignee]) []*sync_from_target.AccessProvider {
+	mask := NewACLPermissionSet(Read, Write, Execute)
+
+	for _, entry := range entries {
+		if !entry.Default && entry.Type == "mask" {
+			mask = entry.Permissions
+		}
+	}
+
+	apMap := make(map[ACLPermissionSet]*sync_from_target.AccessProvider)
+
+	for _, entry := range entries {
+		if entry.Default || !entry.IsNamed() || managed.Contains(entry.Assignee()) {
+			continue
+		}
+
+		permissions := entry.Permissions.And(mask)
+		if permissions == 0 {
+			continue
+		}
+
+		if _, f := apMap[permissions]; !f {
+			permissionNames := make([]string, 0, 3)
+
+			for _, permission := range []ACLPermission{Read, Write, Execute} {
+				if permissions.Contains(permission) {
+					permissionNames = append(permissionNames, permission.String())
+				}
+			}
+
+			apName := fmt.Sprintf("file-%s-%s", path.Base(fullName), strings.Join(permissionNames, "-"))
+
+			apMap[permissions] = &sync_from_target.AccessProvider{
+				ExternalId: fmt.Sprintf("%s:%s", fullName, permissions.String()),
+				Name:       apName,
+				NamingHint: apName,
+				ActualName: apName,
+				Action:     types.Grant,
+				Type:       ptr.String(constants.RoleAssignments),
+				Who: &sync_from_target.WhoItem{
+					Users:  []string{},
+					Groups: []string{},
+				},
+				What: []sync_from_target.WhatItem{{
+					Permissions: permissionNames,
+					DataObject: &data_source.DataObjectReference{
+						Type:     File,
+						FullName: fullName,
+					},
+				}},
+			}
+		}
+
+		if entry.Type == "group" {
+			apMap[permissions].Who.Groups = append(apMap[permissions].Who.Groups, entry.Qualifier)
+		} else {
+			apMap[permissions].Who.Users = append(apMap[permissions].Who.Users, entry.Qualifier)
+		}
+	}
+
+	result := make([]*sync_from_target.AccessProvider, 0, len(apMap))
+	for _, ap := range apMap {
+		result = append(result, ap)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExternalId < result[j].ExternalId
+	})
+
+	return result
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/raito-io/golang-set/set"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileACLAccessProviders(t *testing.T) {
+	entries, err := ParseACL("user::rw-,user:u1:r--,user:u2:rw-,group:g1:r--,user:u3:r-x,user:raito:r--,user:u4:-w-,group::r--,mask::r-x,other::---")
+	require.NoError(t, err)
+
+	aps := fileACLAccessProviders("sub/rg/sa/data/exports/report.csv", entries, set.NewSet[ACLAssignee]("user:raito"))
+
+	require.Len(t, aps, 2)
+
+	assert.Equal(t, "sub/rg/sa/data/exports/report.csv:r--", aps[0].ExternalId)
+	assert.Equal(t, "file-report.csv-Read", aps[0].Name)
+	assert.Equal(t, []string{"u1", "u2"}, aps[0].Who.Users)
+	assert.Equal(t, []string{"g1"}, aps[0].Who.Groups)
+	assert.Equal(t, []string{"Read"}, aps[0].What[0].Permissions)
+	assert.Equal(t, File, aps[0].What[0].DataObject.Type)
+	assert.Equal(t, "sub/rg/sa/data/exports/report.csv", aps[0].What[0].DataObject.FullName)
+
+	assert.Equal(t, "sub/rg/sa/data/exports/report.csv:r-x", aps[1].ExternalId)
+	assert.Equal(t, "file-report.csv-Read-Execute", aps[1].Name)
+	assert.Equal(t, []string{"u3"}, aps[1].Who.Users)
+	assert.Equal(t, []string{"Read", "Execute"}, aps[1].What[0].Permissions)
+}
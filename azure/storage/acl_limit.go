@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/raito-io/golang-set/set"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const (
+	// maxACLEntries is the maximum number of entries in an access ACL and in a default ACL, including the owning user, owning group, mask and other.
+	maxACLEntries = 32
+
+	// Above this number of entries, the group advisor starts suggesting to use groups instead of individual users.
+	aclAdvisorEntryThreshold = maxACLEntries * 3 / 4
+)
+
+// aclEntryCount is the number of access and default entries of an ACL
+type aclEntryCount struct {
+	access      int
+	defaultACL  int
+	accessMask  bool
+	defaultMask bool
+	accessOnly  bool
+}
+
+func (c *aclEntryCount) add() {
+	if c.accessOnly {
+		if !c.accessMask {
+			c.access++
+			c.accessMask = true
+		}
+
+		c.access++
+
+		return
+	}
+
+	if c.defaultACL == 0 {
+		// A default ACL always contains the entries of the owning user, the owning group and other
+		c.defaultACL = 3
+	}
+
+	// A named entry requires a mask entry
+	if !c.accessMask {
+		c.access++
+		c.accessMask = true
+	}
+
+	if !c.defaultMask {
+		c.defaultACL++
+		c.defaultMask = true
+	}
+
+	c.access++
+	c.defaultACL++
+}
+
+func (c *aclEntryCount) fits() bool {
+	return c.access <= maxACLEntries && c.defaultACL <= maxACLEntries
+}
+
+func (c *aclEntryCount) max() int {
+	if c.defaultACL > c.access {
+		return c.defaultACL
+	}
+
+	return c.access
+}
+
+// aclLimitValidator verifies that the ACL changes for an item don't exceed the maximum number of ACL entries.
+// Access providers that would push an ACL over the limit fail, the changes of other access providers are still applied.
+type aclLimitValidator struct {
+	reader   *aclReader
+	apGroups map[string][]string
+	// items are the items with ACL changes in this sync. The ACLs of the items below a directory are validated as well, as the recursive changes on the directory are applied on them too.
+	items           []ACLAssignedItem
+	groupAdvisor    bool
+	feedbackHandler global.AccessProviderFeedbackHandler
+}
+
+func newACLLimitValidator(configMap *config.ConfigMap, reader *aclReader, apGroups map[string][]string, items []ACLAssignedItem, feedbackHandler global.AccessProviderFeedbackHandler) *aclLimitValidator {
+	return &aclLimitValidator{
+		reader:          reader,
+		apGroups:        apGroups,
+		items:           items,
+		groupAdvisor:    configMap.GetBoolWithDefault(global.AzAclGroupAdvisor, false),
+		feedbackHandler: feedbackHandler,
+	}
+}
+
+// validate returns the changes for the item that can be applied without exceeding the ACL entry limit.
+// Besides the item itself, the items below it with ACL changes in this sync are validated. Other paths below the item are not read,
+// if their ACL exceeds the limit the recursive operation reports them as failed paths.
+func (v *aclLimitValidator) validate(ctx context.Context, item ACLAssignedItem, changes map[ACLAssignee]ACLPermissionChangesWithAP) map[ACLAssignee]ACLPermissionChangesWithAP {
+	currentEntries, err := v.reader.get(ctx, item)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Unable to read the current ACL of %s/%s/%s, skipping ACL entry limit validation: %s", item.StorageAccount, item.Container, item.Path, err.Error()))
+
+		return changes
+	}
+
+	targets := []aclLimitTarget{{entries: currentEntries, withDefault: item.HasDefaultACL()}}
+
+	for _, descendant := range v.descendants(item) {
+		entries, err2 := v.reader.get(ctx, descendant)
+		if err2 != nil {
+			logger.Debug(fmt.Sprintf("Unable to read the current ACL of %s, skipping ACL entry limit validation for it: %s", aclItemKey(descendant), err2.Error()))
+
+			continue
+		}
+
+		targets = append(targets, aclLimitTarget{entries: entries, withDefault: descendant.HasDefaultACL()})
+	}
+
+	result, offendingAPs, count := applyACLEntryLimit(targets, changes)
+
+	for _, apId := range offendingAPs.Slice() {
+		message := fmt.Sprintf("Unable to grant access on %s/%s/%s: the ACL would exceed the maximum of %d entries", item.StorageAccount, item.Container, item.Path, maxACLEntries)
+		if len(targets) > 1 {
+			message = fmt.Sprintf("Unable to grant access on %s/%s/%s: the ACL of this item or of one of the items below it would exceed the maximum of %d entries", item.StorageAccount, item.Container, item.Path, maxACLEntries)
+		}
+
+		logger.Error(fmt.Sprintf("%s for access provider %q", message, apId))
+		v.feedbackHandler.Error(message, apId)
+
+		if v.groupAdvisor {
+			v.advise(item, apId, changes, maxACLEntries)
+		}
+	}
+
+	if v.groupAdvisor && count.max() > aclAdvisorEntryThreshold {
+		apIds := set.NewSet[string]()
+		for _, change := range result {
+			apIds.Add(change.APIds...)
+		}
+
+		apIds.RemoveAll(offendingAPs.Slice()...)
+
+		for _, apId := range apIds.Slice() {
+			v.advise(item, apId, result, count.max())
+		}
+	}
+
+	return result
+}
+
+// descendants returns the items below the directory with ACL changes in this sync
+func (v *aclLimitValidator) descendants(item ACLAssignedItem) []ACLAssignedItem {
+	if !item.HasDefaultACL() {
+		return nil
+	}
+
+	var result []ACLAssignedItem
+
+	for _, other := range v.items {
+		if other != item && other.StorageAccount == item.StorageAccount && other.Container == item.Container && isSameOrParentPath(item, other.Path) {
+			result = append(result, other)
+		}
+	}
+
+	return result
+}
+
+// advise suggests to replace the user entries of an access provider by its groups.
+func (v *aclLimitValidator) advise(item ACLAssignedItem, apId string, changes map[ACLAssignee]ACLPermissionChangesWithAP, usedEntries int) {
+	userEntries := 0
+
+	for assignee, change := range changes {
+		if _, toRemove := change.ChangeSet(); toRemove || !strings.HasPrefix(string(assignee), "user:") {
+			continue
+		}
+
+		for _, id := range change.APIds {
+			if id == apId {
+				userEntries++
+
+				break
+			}
+		}
+	}
+
+	if userEntries < 2 {
+		return
+	}
+
+	suggestion := "consider granting access to a group containing these users instead"
+	if groups := v.apGroups[apId]; len(groups) > 0 {
+		suggestion = fmt.Sprintf("consider granting access only to its groups (%s) and adding the users to these groups instead", strings.Join(groups, ", "))
+	}
+
+	v.feedbackHandler.Warning(fmt.Sprintf("The ACL of %s/%s/%s uses %d of the maximum %d entries and this access provider adds %d user entries: %s", item.StorageAccount, item.Container, item.Path, usedEntries, maxACLEntries, userEntries, suggestion), apId)
+}
+
+// aclLimitTarget is an ACL on which the changes are applied
+type aclLimitTarget struct {
+	entries []ACLEntry
+	// withDefault is false for files, on which new entries are only added to the access ACL
+	withDefault bool
+}
+
+// applyACLEntryLimit returns the changes that can be applied on top of the current ACLs of the targets without exceeding the maximum number of entries on any of them.
+// Access providers are handled in a stable order and either all or none of their new entries are accepted. Access providers with an entry that doesn't fit anymore are returned as offending.
+// Entries that an offending access provider shares with an accepted access provider are still applied. The returned count is the one of the first target.
+func applyACLEntryLimit(targets []aclLimitTarget, changes map[ACLAssignee]ACLPermissionChangesWithAP) (map[ACLAssignee]ACLPermissionChangesWithAP, set.Set[string], aclEntryCount) {
+	counts := make([]aclEntryCount, len(targets))
+	existing := make([]set.Set[ACLAssignee], len(targets))
+
+	for i, target := range targets {
+		counts[i], existing[i] = countACLEntries(target.entries, changes, target.withDefault)
+	}
+
+	// newEntries returns the targets on which the assignee doesn't have an entry yet
+	newEntries := func(assignee ACLAssignee) []int {
+		var result []int
+
+		for i := range targets {
+			if !existing[i].Contains(assignee) {
+				result = append(result, i)
+			}
+		}
+
+		return result
+	}
+
+	apAssignees := make(map[string][]ACLAssignee)
+
+	for assignee, change := range changes {
+		if _, toRemove := change.ChangeSet(); toRemove || len(newEntries(assignee)) == 0 {
+			continue
+		}
+
+		for _, apId := range set.NewSet(change.APIds...).Slice() {
+			apAssignees[apId] = append(apAssignees[apId], assignee)
+		}
+	}
+
+	apIds := make([]string, 0, len(apAssignees))
+	for apId := range apAssignees {
+		apIds = append(apIds, apId)
+	}
+
+	sort.Strings(apIds)
+
+	accepted := set.NewSet[ACLAssignee]()
+	offendingAPs := set.NewSet[string]()
+
+	for _, apId := range apIds {
+		next := append([]aclEntryCount{}, counts...)
+		var added []ACLAssignee
+
+		for _, assignee := range apAssignees[apId] {
+			if accepted.Contains(assignee) {
+				continue
+			}
+
+			for _, i := range newEntries(assignee) {
+				next[i].add()
+			}
+
+			added = append(added, assignee)
+		}
+
+		fits := true
+
+		for i := range next {
+			if !next[i].fits() {
+				fits = false
+
+				break
+			}
+		}
+
+		if fits {
+			counts = next
+			accepted.Add(added...)
+		} else {
+			offendingAPs.Add(apId)
+		}
+	}
+
+	if len(offendingAPs) == 0 {
+		return changes, offendingAPs, counts[0]
+	}
+
+	result := make(map[ACLAssignee]ACLPermissionChangesWithAP, len(changes))
+
+	for assignee, change := range changes {
+		_, toRemove := change.ChangeSet()
+
+		if toRemove || len(newEntries(assignee)) == 0 || accepted.Contains(assignee) {
+			result[assignee] = change
+		}
+	}
+
+	return result, offendingAPs, counts[0]
+}
+
+// countACLEntries counts the entries of the current ACL after the removals in changes are applied. It also returns the assignees that already have an entry.
+func countACLEntries(currentEntries []ACLEntry, changes map[ACLAssignee]ACLPermissionChangesWithAP, withDefault bool) (aclEntryCount, set.Set[ACLAssignee]) {
+	count := aclEntryCount{accessOnly: !withDefault}
+	existing := set.NewSet[ACLAssignee]()
+
+	for _, entry := range currentEntries {
+		if entry.IsNamed() {
+			if change, found := changes[entry.Assignee()]; found {
+				if _, toRemove := change.ChangeSet(); toRemove {
+					continue
+				}
+			}
+
+			existing.Add(entry.Assignee())
+		}
+
+		if entry.Default {
+			count.defaultACL++
+			count.defaultMask = count.defaultMask || entry.Type == "mask"
+		} else {
+			count.access++
+			count.accessMask = count.accessMask || entry.Type == "mask"
+		}
+	}
+
+	return count, existing
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyACLEntryLimit(t *testing.T) {
+	baseEntries := []ACLEntry{
+		{Type: "user", Permissions: NewACLPermissionSet(Read, Write, Execute)},
+		{Type: "group", Permissions: NewACLPermissionSet(Read, Execute)},
+		{Type: "other"},
+	}
+
+	namedEntries := func(n int) []ACLEntry {
+		entries := append([]ACLEntry{}, baseEntries...)
+		entries = append(entries, ACLEntry{Type: "mask", Permissions: NewACLPermissionSet(Read, Write, Execute)})
+
+		for i := 0; i < n; i++ {
+			entries = append(entries, ACLEntry{Type: "user", Qualifier: fmt.Sprintf("existing%02d", i), Permissions: NewACLPermissionSet(Read)})
+		}
+
+		return entries
+	}
+
+	added := func(apIds ...string) ACLPermissionChangesWithAP {
+		return ACLPermissionChangesWithAP{ACLPermissionChanges: ACLPermissionChanges{Added: NewACLPermissionSet(Read)}, APIds: apIds}
+	}
+
+	removed := func(apIds ...string) ACLPermissionChangesWithAP {
+		return ACLPermissionChangesWithAP{ACLPermissionChanges: ACLPermissionChanges{Removed: NewACLPermissionSet(Read)}, APIds: apIds}
+	}
+
+	t.Run("Within limit", func(t *testing.T) {
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:a":  added("ap1"),
+			"group:b": added("ap2"),
+		}
+
+		result, offending, count := applyACLEntryLimit([]aclLimitTarget{{entries: baseEntries, withDefault: true}}, changes)
+
+		assert.Equal(t, changes, result)
+		assert.Empty(t, offending)
+		assert.Equal(t, 6, count.access)
+		assert.Equal(t, 6, count.defaultACL)
+	})
+
+	t.Run("Exceeding limit fails offending access provider only", func(t *testing.T) {
+		// 4 base entries + 27 named entries leaves room for 1 new entry in the access ACL
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:a": added("ap1"),
+			"user:b": added("ap2"),
+			"user:c": added("ap2"),
+		}
+
+		result, offending, count := applyACLEntryLimit([]aclLimitTarget{{entries: namedEntries(27), withDefault: true}}, changes)
+
+		assert.Equal(t, map[ACLAssignee]ACLPermissionChangesWithAP{"user:a": added("ap1")}, result)
+		assert.ElementsMatch(t, []string{"ap2"}, offending.Slice())
+		assert.Equal(t, 32, count.access)
+	})
+
+	t.Run("Removals make room for new entries", func(t *testing.T) {
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:existing00": removed("ap1"),
+			"user:a":          added("ap1"),
+			"user:b":          added("ap2"),
+		}
+
+		result, offending, count := applyACLEntryLimit([]aclLimitTarget{{entries: namedEntries(27), withDefault: true}}, changes)
+
+		assert.Equal(t, changes, result)
+		assert.Empty(t, offending)
+		assert.Equal(t, 32, count.access)
+	})
+
+	t.Run("Existing entries don't count as new", func(t *testing.T) {
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:existing00": added("ap1"),
+		}
+
+		result, offending, count := applyACLEntryLimit([]aclLimitTarget{{entries: namedEntries(28), withDefault: true}}, changes)
+
+		assert.Equal(t, changes, result)
+		assert.Empty(t, offending)
+		assert.Equal(t, 32, count.access)
+	})
+
+	t.Run("Files have no default ACL", func(t *testing.T) {
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:a": added("ap1"),
+		}
+
+		result, offending, count := applyACLEntryLimit([]aclLimitTarget{{entries: baseEntries, withDefault: false}}, changes)
+
+		assert.Equal(t, changes, result)
+		assert.Empty(t, offending)
+		assert.Equal(t, 5, count.access)
+		assert.Equal(t, 0, count.defaultACL)
+	})
+
+	t.Run("Entries shared with an offending access provider are kept", func(t *testing.T) {
+		// Room for 1 new entry: ap1 adds user:a, ap2 needs user:a and user:b and fails, ap3 only needs user:a
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:a": added("ap1", "ap2", "ap3"),
+			"user:b": added("ap2"),
+		}
+
+		result, offending, count := applyACLEntryLimit([]aclLimitTarget{{entries: namedEntries(27), withDefault: true}}, changes)
+
+		assert.Equal(t, map[ACLAssignee]ACLPermissionChangesWithAP{"user:a": added("ap1", "ap2", "ap3")}, result)
+		assert.ElementsMatch(t, []string{"ap2"}, offending.Slice())
+		assert.Equal(t, 32, count.access)
+	})
+
+	t.Run("Access providers are accepted or rejected as a whole", func(t *testing.T) {
+		// Room for 1 new entry: ap1 needs 2 entries and fails, ap2 still fits
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:a": added("ap1"),
+			"user:b": added("ap1"),
+			"user:c": added("ap2"),
+		}
+
+		result, offending, count := applyACLEntryLimit([]aclLimitTarget{{entries: namedEntries(27), withDefault: true}}, changes)
+
+		assert.Equal(t, map[ACLAssignee]ACLPermissionChangesWithAP{"user:c": added("ap2")}, result)
+		assert.ElementsMatch(t, []string{"ap1"}, offending.Slice())
+		assert.Equal(t, 32, count.access)
+	})
+
+	t.Run("Items below the directory are validated as well", func(t *testing.T) {
+		// The directory has room, the file below it with 28 named entries only has room for 0 new entries
+		changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+			"user:a":          added("ap1"),
+			"user:existing00": added("ap2"),
+		}
+
+		targets := []aclLimitTarget{
+			{entries: baseEntries, withDefault: true},
+			{entries: namedEntries(28), withDefault: false},
+		}
+
+		result, offending, count := applyACLEntryLimit(targets, changes)
+
+		assert.Equal(t, map[ACLAssignee]ACLPermissionChangesWithAP{"user:existing00": added("ap2")}, result)
+		assert.ElementsMatch(t, []string{"ap1"}, offending.Slice())
+		assert.Equal(t, 5, count.access)
+	})
+}
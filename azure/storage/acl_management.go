@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"fmt"
+	"strings"
+)
+
 //go:generate go run github.com/raito-io/enumer -type=ACLPermission
 type ACLPermission uint8
 
@@ -56,6 +61,28 @@ func (s ACLPermissionSet) String() string {
 	return string(result)
 }
 
+// ParseACLPermissionSet parses the short form of a permission set (e.g. "r-x").
+func ParseACLPermissionSet(s string) (ACLPermissionSet, error) {
+	if len(s) != 3 {
+		return 0, fmt.Errorf("invalid ACL permissions %q", s)
+	}
+
+	set := ACLPermissionSet(0)
+	permissions := []ACLPermission{Read, Write, Execute}
+
+	for i, c := range []byte(s) {
+		switch c {
+		case "rwx"[i]:
+			set = set.Add(permissions[i])
+		case '-':
+		default:
+			return 0, fmt.Errorf("invalid ACL permissions %q", s)
+		}
+	}
+
+	return set, nil
+}
+
 type ACLPermissionChanges struct {
 	Added   ACLPermissionSet
 	Removed ACLPermissionSet
@@ -105,10 +132,92 @@ func (s *ACLPermissionChanges) ChangeSet() (ACLPermissionSet, bool) {
 
 type ACLAssignee string
 
+// ACLEntry is a single entry of an access or default ACL. The qualifier is empty for the owning user and group, the mask and other.
+type ACLEntry struct {
+	Default     bool
+	Type        string
+	Qualifier   string
+	Permissions ACLPermissionSet
+}
+
+// Assignee returns the assignee of a named user or group entry
+func (e ACLEntry) Assignee() ACLAssignee {
+	return ACLAssignee(fmt.Sprintf("%s:%s", e.Type, e.Qualifier))
+}
+
+func (e ACLEntry) String() string {
+	entry := fmt.Sprintf("%s:%s:%s", e.Type, e.Qualifier, e.Permissions)
+	if e.Default {
+		entry = "default:" + entry
+	}
+
+	return entry
+}
+
+// IsNamed returns true if the entry is a named user or group entry
+func (e ACLEntry) IsNamed() bool {
+	return e.Qualifier != "" && (e.Type == "user" || e.Type == "group")
+}
+
+// ParseACL parses an ACL string as returned by the service (e.g. "user::rwx,user:<id>:r-x,default:group::r-x").
+func ParseACL(acl string) ([]ACLEntry, error) {
+	if acl == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(acl, ",")
+	entries := make([]ACLEntry, 0, len(parts))
+
+	for _, part := range parts {
+		entry := ACLEntry{}
+
+		fields := strings.Split(part, ":")
+		if fields[0] == "default" {
+			entry.Default = true
+			fields = fields[1:]
+		}
+
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid ACL entry %q", part)
+		}
+
+		permissions, err := ParseACLPermissionSet(fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Type = fields[0]
+		entry.Qualifier = fields[1]
+		entry.Permissions = permissions
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+type ACLItemType string
+
+const (
+	// ACLItemDirectory is a directory on which ACLs are applied recursively, including the default ACL
+	ACLItemDirectory ACLItemType = "directory"
+	// ACLItemFile is a single file, which only has an access ACL
+	ACLItemFile ACLItemType = "file"
+	// ACLItemTraversal is a parent directory of a granted file, which only needs execute permissions in its access ACL
+	ACLItemTraversal ACLItemType = "traversal"
+)
+
 type ACLAssignedItem struct {
 	StorageAccount string
 	Container      string
-	Path           string
+	// Path is the path of the item in the container, "" for the root directory ("/") of the container
+	Path string
+	Type ACLItemType
+}
+
+// HasDefaultACL returns true if the ACLs on the item are applied recursively, including the default ACL
+func (i ACLAssignedItem) HasDefaultACL() bool {
+	return i.Type != ACLItemFile && i.Type != ACLItemTraversal
 }
 
 type ACLAssignment struct {
@@ -1,6 +1,9 @@
 package storage
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestACLPermissionSet_String(t *testing.T) {
 	tests := []struct {
@@ -57,3 +60,52 @@ func TestACLPermissionSet_String(t *testing.T) {
 		})
 	}
 }
+
+func TestParseACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		acl     string
+		want    []ACLEntry
+		wantErr bool
+	}{
+		{
+			name: "Empty ACL",
+			acl:  "",
+			want: nil,
+		},
+		{
+			name: "Access and default entries",
+			acl:  "user::rwx,user:1234:r-x,group::r--,mask::r-x,other::---,default:group:5678:rw-",
+			want: []ACLEntry{
+				{Type: "user", Permissions: NewACLPermissionSet(Read, Write, Execute)},
+				{Type: "user", Qualifier: "1234", Permissions: NewACLPermissionSet(Read, Execute)},
+				{Type: "group", Permissions: NewACLPermissionSet(Read)},
+				{Type: "mask", Permissions: NewACLPermissionSet(Read, Execute)},
+				{Type: "other", Permissions: NewACLPermissionSet()},
+				{Default: true, Type: "group", Qualifier: "5678", Permissions: NewACLPermissionSet(Read, Write)},
+			},
+		},
+		{
+			name:    "Invalid permissions",
+			acl:     "user::rwz",
+			wantErr: true,
+		},
+		{
+			name:    "Missing permissions",
+			acl:     "user:1234",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseACL(tt.acl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseACL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseACL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,501 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/directory"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const (
+	aclCheckpointStateName = "acl-checkpoint"
+	continuationHeader     = "x-ms-continuation"
+
+	defaultACLBatchSize = 2000
+)
+
+var errACLOperationInterrupted = errors.New("recursive access control operation interrupted")
+
+type aclOperationMode string
+
+const (
+	aclOperationModify aclOperationMode = "modify"
+	aclOperationRemove aclOperationMode = "remove"
+)
+
+type aclFailedPath struct {
+	Name        string `json:"name"`
+	IsDirectory bool   `json:"isDirectory"`
+}
+
+// aclOperation is a single recursive ACL update or removal on a directory.
+// The marker and failed paths are persisted in the checkpoint so an interrupted operation can be resumed on the next run.
+type aclOperation struct {
+	Item          ACLAssignedItem  `json:"item"`
+	Mode          aclOperationMode `json:"mode"`
+	ACL           string           `json:"acl"`
+	Marker        string           `json:"marker,omitempty"`
+	TraversalDone bool             `json:"traversalDone"`
+	FailedPaths   []aclFailedPath  `json:"failedPaths,omitempty"`
+	APIds         []string         `json:"apIds,omitempty"`
+	// Superseded numbers the remainders of interrupted operations of which the ACL changed in a later sync (0 for other operations).
+	// They are checkpointed separately, so they don't clash with the operation with the new ACL.
+	Superseded int `json:"superseded,omitempty"`
+}
+
+func (o *aclOperation) key() string {
+	if o.Superseded > 0 {
+		return fmt.Sprintf("%s|%s/%s/%s|superseded-%d", o.Mode, o.Item.StorageAccount, o.Item.Container, o.Item.Path, o.Superseded)
+	}
+
+	return fmt.Sprintf("%s|%s/%s/%s", o.Mode, o.Item.StorageAccount, o.Item.Container, o.Item.Path)
+}
+
+func (o *aclOperation) String() string {
+	return fmt.Sprintf("%s ACLs for %s/%s/%s", o.Mode, o.Item.StorageAccount, o.Item.Container, o.Item.Path)
+}
+
+// aclCheckpoint keeps track of all recursive ACL operations that did not complete yet.
+type aclCheckpoint struct {
+	path string
+
+	Operations map[string]*aclOperation `json:"operations"`
+}
+
+func loadACLCheckpoint(params map[string]string) (*aclCheckpoint, error) {
+	path, err := global.StateFilePath(params, aclCheckpointStateName)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &aclCheckpoint{path: path}
+
+	err = global.LoadState(path, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpoint.Operations == nil {
+		checkpoint.Operations = make(map[string]*aclOperation)
+	}
+
+	return checkpoint, nil
+}
+
+// pending returns the checkpointed state of the given operation if the same operation was interrupted before.
+// A checkpoint of the same item with a different ACL can't be resumed, so the operation starts over and the checkpoint is discarded.
+// Normally, leftovers moves the entries of such a checkpoint that are not part of the new ACL to a separate operation before.
+func (c *aclCheckpoint) pending(op *aclOperation) (*aclOperation, bool) {
+	existing, found := c.Operations[op.key()]
+	if !found {
+		return nil, false
+	}
+
+	if existing.ACL != op.ACL {
+		logger.Warn(fmt.Sprintf("Discarding the checkpoint of the interrupted operation to %s, as its ACL changed from %q to %q. The operation starts over with the new ACL; entries of the previous ACL that are not part of the new one are not applied to the paths that were not handled yet", op, existing.ACL, op.ACL))
+
+		return nil, false
+	}
+
+	return existing, true
+}
+
+func (c *aclCheckpoint) update(op *aclOperation) error {
+	c.Operations[op.key()] = op
+
+	return global.SaveState(c.path, c)
+}
+
+func (c *aclCheckpoint) complete(op *aclOperation) error {
+	delete(c.Operations, op.key())
+
+	return global.SaveState(c.path, c)
+}
+
+// aclPathClient applies ACL changes on the paths of a file system
+type aclPathClient interface {
+	// changeDirectoryBatch applies a single batch of the operation on the directory, starting at the marker. It returns the marker of the next batch, which is empty when all paths were handled.
+	changeDirectoryBatch(ctx context.Context, op *aclOperation, marker string, batchSize int32) (directory.SetAccessControlRecursiveResponse, string, error)
+	// changeDirectory applies the operation on the directory at the given path and all paths below it
+	changeDirectory(ctx context.Context, op *aclOperation, path string, batchSize int32) (directory.SetAccessControlRecursiveResponse, error)
+	// changeFile applies the (access) ACL of the operation on the file at the given path
+	changeFile(ctx context.Context, op *aclOperation, path string, acl string) error
+}
+
+// dataLakeACLClient is the aclPathClient of the Data Lake Storage service
+type dataLakeACLClient struct {
+	params map[string]string
+}
+
+func (c *dataLakeACLClient) changeDirectoryBatch(ctx context.Context, op *aclOperation, marker string, batchSize int32) (directory.SetAccessControlRecursiveResponse, string, error) {
+	client, err := createDirectoryClient(ctx, op.Item.StorageAccount, op.Item.Container, op.Item.Path, c.params)
+	if err != nil {
+		return directory.SetAccessControlRecursiveResponse{}, "", err
+	}
+
+	var rawResponse *http.Response
+
+	batchCtx := policy.WithCaptureResponse(ctx, &rawResponse)
+
+	options := &directory.UpdateAccessControlRecursiveOptions{
+		BatchSize:         &batchSize,
+		MaxBatches:        ptr.Int32(1),
+		ContinueOnFailure: ptr.Bool(true),
+	}
+
+	if marker != "" {
+		options.Marker = ptr.String(marker)
+	}
+
+	var r directory.SetAccessControlRecursiveResponse
+
+	if op.Mode == aclOperationRemove {
+		r, err = client.RemoveAccessControlRecursive(batchCtx, op.ACL, options)
+	} else {
+		r, err = client.UpdateAccessControlRecursive(batchCtx, op.ACL, options)
+	}
+
+	if err != nil {
+		return r, "", err
+	}
+
+	nextMarker := ""
+	if rawResponse != nil {
+		nextMarker = rawResponse.Header.Get(continuationHeader)
+	}
+
+	return r, nextMarker, nil
+}
+
+func (c *dataLakeACLClient) changeDirectory(ctx context.Context, op *aclOperation, path string, batchSize int32) (directory.SetAccessControlRecursiveResponse, error) {
+	client, err := createDirectoryClient(ctx, op.Item.StorageAccount, op.Item.Container, path, c.params)
+	if err != nil {
+		return directory.SetAccessControlRecursiveResponse{}, err
+	}
+
+	if op.Mode == aclOperationRemove {
+		return client.RemoveAccessControlRecursive(ctx, op.ACL, nil)
+	}
+
+	return client.UpdateAccessControlRecursive(ctx, op.ACL, &directory.UpdateAccessControlRecursiveOptions{BatchSize: &batchSize})
+}
+
+func (c *dataLakeACLClient) changeFile(ctx context.Context, op *aclOperation, path string, acl string) error {
+	client, err := createFileClient(ctx, op.Item.StorageAccount, op.Item.Container, path, c.params)
+	if err != nil {
+		return err
+	}
+
+	if op.Mode == aclOperationRemove {
+		_, err = client.RemoveAccessControl(ctx, acl, nil)
+	} else {
+		_, err = client.UpdateAccessControl(ctx, acl, nil)
+	}
+
+	return err
+}
+
+// recursiveACLExecutor applies recursive ACL operations batch by batch, using the continuation token returned by the service to checkpoint its progress.
+type recursiveACLExecutor struct {
+	client     aclPathClient
+	checkpoint *aclCheckpoint
+	batchSize  int32
+	maxBatches int
+}
+
+func newRecursiveACLExecutor(configMap *config.ConfigMap) (*recursiveACLExecutor, error) {
+	checkpoint, err := loadACLCheckpoint(configMap.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := configMap.GetIntWithDefault(global.AzAclBatchSize, defaultACLBatchSize)
+	if batchSize <= 0 || batchSize > defaultACLBatchSize {
+		logger.Warn(fmt.Sprintf("Invalid ACL batch size %d, using %d instead", batchSize, defaultACLBatchSize))
+		batchSize = defaultACLBatchSize
+	}
+
+	return &recursiveACLExecutor{
+		client:     &dataLakeACLClient{params: configMap.Parameters},
+		checkpoint: checkpoint,
+		batchSize:  int32(batchSize), //nolint:gosec
+		maxBatches: configMap.GetIntWithDefault(global.AzAclMaxBatches, 0),
+	}, nil
+}
+
+// leftovers returns the operations of previous runs that were not completed and are not part of the given operations.
+// Entries of these operations for assignees that the given operations change on the same item (or on a directory above it) are dropped,
+// so an old operation never undoes a change of the current sync. Operations without remaining entries are removed from the checkpoint.
+// If the ACL of an interrupted operation changed, its remaining entries are resumed as a superseded operation and the given operation starts over,
+// so e.g. the removal of entries that are no longer part of the ACL is still finished on the paths that were not handled yet.
+func (e *recursiveACLExecutor) leftovers(ops []*aclOperation) ([]*aclOperation, error) {
+	current := make(map[string]*aclOperation, len(ops))
+	for _, op := range ops {
+		current[op.key()] = op
+	}
+
+	for key, op := range current {
+		existing, found := e.checkpoint.Operations[key]
+		if !found || existing.ACL == op.ACL {
+			continue
+		}
+
+		superseded := *existing
+		superseded.Superseded = 1
+
+		for e.checkpoint.Operations[superseded.key()] != nil {
+			superseded.Superseded++
+		}
+
+		logger.Info(fmt.Sprintf("The ACL of interrupted operation to %s changed from %q to %q, the previous operation is resumed separately", op, existing.ACL, op.ACL))
+
+		delete(e.checkpoint.Operations, key)
+
+		err := e.checkpoint.update(&superseded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(e.checkpoint.Operations))
+	for key := range e.checkpoint.Operations {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var result []*aclOperation
+
+	for _, key := range keys {
+		if _, found := current[key]; found {
+			continue
+		}
+
+		op := e.checkpoint.Operations[key]
+
+		acl := supersededACL(op, ops)
+		if acl == "" {
+			logger.Info(fmt.Sprintf("Dropping interrupted operation to %s, as all its entries are changed during this sync", op))
+
+			err := e.checkpoint.complete(op)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if acl != op.ACL {
+			logger.Info(fmt.Sprintf("Interrupted operation to %s is resumed for %q, the other entries are changed during this sync", op, acl))
+
+			op.ACL = acl
+		}
+
+		result = append(result, op)
+	}
+
+	return result, nil
+}
+
+// supersededACL returns the entries of the ACL of the old operation for assignees that none of the given operations changes on the same item or on a directory above it
+func supersededACL(old *aclOperation, ops []*aclOperation) string {
+	changed := make(map[ACLAssignee]struct{})
+
+	for _, op := range ops {
+		if op.Item.StorageAccount != old.Item.StorageAccount || op.Item.Container != old.Item.Container || !isSameOrParentPath(op.Item, old.Item.Path) {
+			continue
+		}
+
+		for _, entry := range strings.Split(op.ACL, ",") {
+			changed[aclEntryAssignee(entry)] = struct{}{}
+		}
+	}
+
+	var remaining []string
+
+	for _, entry := range strings.Split(old.ACL, ",") {
+		if _, found := changed[aclEntryAssignee(entry)]; !found {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	return strings.Join(remaining, ",")
+}
+
+// isSameOrParentPath returns true if the operations on the item apply to the path as well
+func isSameOrParentPath(item ACLAssignedItem, path string) bool {
+	if item.Path == path {
+		return true
+	}
+
+	if !item.HasDefaultACL() {
+		return false
+	}
+
+	return item.Path == "" || strings.HasPrefix(path, item.Path+"/")
+}
+
+// aclEntryAssignee returns the assignee of an entry of an operation ACL, e.g. user:<id> for default:user:<id>:r-x
+func aclEntryAssignee(entry string) ACLAssignee {
+	fields := strings.Split(strings.TrimPrefix(entry, "default:"), ":")
+	if len(fields) < 2 {
+		return ACLAssignee(entry)
+	}
+
+	return ACLAssignee(fields[0] + ":" + fields[1])
+}
+
+// run executes the operation. If the same operation was interrupted before, it resumes from the checkpointed continuation token and failed paths.
+func (e *recursiveACLExecutor) run(ctx context.Context, op *aclOperation) error {
+	if pending, found := e.checkpoint.pending(op); found {
+		logger.Info(fmt.Sprintf("Resuming %s", op))
+
+		op.Marker = pending.Marker
+		op.TraversalDone = pending.TraversalDone
+		op.FailedPaths = pending.FailedPaths
+	}
+
+	if op.Item.Type == ACLItemFile {
+		// A file has no children, so the operation is applied in a single call
+		return e.applyOnFile(ctx, op, op.Item.Path)
+	}
+
+	err := e.checkpoint.update(op)
+	if err != nil {
+		return err
+	}
+
+	if !op.TraversalDone {
+		batches := 0
+
+		for !op.TraversalDone {
+			err2 := e.runBatch(ctx, op)
+			if err2 != nil {
+				return err2
+			}
+
+			batches++
+
+			err2 = e.checkpoint.update(op)
+			if err2 != nil {
+				return err2
+			}
+
+			if !op.TraversalDone && e.maxBatches > 0 && batches >= e.maxBatches {
+				return fmt.Errorf("%w: %s stopped after %d batches and will be resumed during the next sync", errACLOperationInterrupted, op, batches)
+			}
+		}
+	}
+
+	if len(op.FailedPaths) > 0 {
+		op.FailedPaths = e.retryFailedPaths(ctx, op, op.FailedPaths)
+
+		if len(op.FailedPaths) > 0 {
+			err = e.checkpoint.update(op)
+			if err != nil {
+				return err
+			}
+
+			return fmt.Errorf("recursive access control %s failed for %d entities, these will be retried during the next sync", op.Mode, len(op.FailedPaths))
+		}
+	}
+
+	return e.checkpoint.complete(op)
+}
+
+// runBatch executes a single batch of the operation and updates the marker of the operation with the continuation token of the service.
+func (e *recursiveACLExecutor) runBatch(ctx context.Context, op *aclOperation) error {
+	r, marker, err := e.client.changeDirectoryBatch(ctx, op, op.Marker, e.batchSize)
+	if err != nil {
+		return err
+	}
+
+	op.Marker = marker
+	op.TraversalDone = op.Marker == ""
+
+	for _, entry := range r.FailedEntries {
+		if entry.Name == nil {
+			continue
+		}
+
+		logger.Debug(fmt.Sprintf("Failed to %s access control for %s: %s", op.Mode, *entry.Name, ptr.ToString(entry.ErrorMessage)))
+
+		op.FailedPaths = append(op.FailedPaths, aclFailedPath{
+			Name:        *entry.Name,
+			IsDirectory: entry.Type != nil && strings.EqualFold(*entry.Type, "directory"),
+		})
+	}
+
+	logger.Debug(fmt.Sprintf("Recursive Access Control batch for %s: %d directories, %d files, %d failures", op, ptr.ToInt32(r.DirectoriesSuccessful), ptr.ToInt32(r.FilesSuccessful), ptr.ToInt32(r.FailureCount)))
+
+	return nil
+}
+
+// retryFailedPaths applies the operation again on the individual paths that failed. The paths that still fail are returned.
+func (e *recursiveACLExecutor) retryFailedPaths(ctx context.Context, op *aclOperation, failedPaths []aclFailedPath) []aclFailedPath {
+	var stillFailing []aclFailedPath
+
+	for _, failedPath := range failedPaths {
+		var err error
+
+		if failedPath.IsDirectory {
+			err = e.retryDirectory(ctx, op, failedPath.Name)
+		} else {
+			err = e.applyOnFile(ctx, op, failedPath.Name)
+		}
+
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Retry to %s access control for %s failed: %s", op.Mode, failedPath.Name, err.Error()))
+
+			stillFailing = append(stillFailing, failedPath)
+		}
+	}
+
+	return stillFailing
+}
+
+func (e *recursiveACLExecutor) retryDirectory(ctx context.Context, op *aclOperation, path string) error {
+	r, err := e.client.changeDirectory(ctx, op, path, e.batchSize)
+	if err != nil {
+		return err
+	}
+
+	if op.Mode == aclOperationRemove {
+		return parseRemoveAccessControlResult(&r)
+	}
+
+	return parseUpdateAccessControlResult(&r)
+}
+
+func (e *recursiveACLExecutor) applyOnFile(ctx context.Context, op *aclOperation, path string) error {
+	// Default ACLs only exist on directories
+	acl := accessACLEntries(op.ACL)
+	if acl == "" {
+		return nil
+	}
+
+	return e.client.changeFile(ctx, op, path, acl)
+}
+
+// accessACLEntries returns the ACL string without the default entries.
+func accessACLEntries(acl string) string {
+	entries := strings.Split(acl, ",")
+	result := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry, "default:") {
+			result = append(result, entry)
+		}
+	}
+
+	return strings.Join(result, ",")
+}
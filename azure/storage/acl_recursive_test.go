@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/directory"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+type fakeACLBatch struct {
+	marker string
+	failed []*directory.ACLFailedEntry
+}
+
+// fakeACLPathClient returns the configured batches in order and records the calls
+type fakeACLPathClient struct {
+	batches      []fakeACLBatch
+	failingPaths map[string]bool
+
+	markers        []string
+	directoryCalls []string
+	fileCalls      []string
+}
+
+func (c *fakeACLPathClient) changeDirectoryBatch(_ context.Context, _ *aclOperation, marker string, _ int32) (directory.SetAccessControlRecursiveResponse, string, error) {
+	c.markers = append(c.markers, marker)
+
+	if len(c.batches) == 0 {
+		return directory.SetAccessControlRecursiveResponse{}, "", errors.New("unexpected batch")
+	}
+
+	batch := c.batches[0]
+	c.batches = c.batches[1:]
+
+	return directory.SetAccessControlRecursiveResponse{FailedEntries: batch.failed, FailureCount: ptr.Int32(int32(len(batch.failed)))}, batch.marker, nil //nolint:gosec
+}
+
+func (c *fakeACLPathClient) changeDirectory(_ context.Context, _ *aclOperation, path string, _ int32) (directory.SetAccessControlRecursiveResponse, error) {
+	c.directoryCalls = append(c.directoryCalls, path)
+
+	if c.failingPaths[path] {
+		return directory.SetAccessControlRecursiveResponse{}, errors.New("still failing")
+	}
+
+	return directory.SetAccessControlRecursiveResponse{}, nil
+}
+
+func (c *fakeACLPathClient) changeFile(_ context.Context, _ *aclOperation, path string, acl string) error {
+	c.fileCalls = append(c.fileCalls, path+"="+acl)
+
+	if c.failingPaths[path] {
+		return errors.New("still failing")
+	}
+
+	return nil
+}
+
+func newTestACLExecutor(t *testing.T, params map[string]string, client aclPathClient, maxBatches int, checkpointed ...*aclOperation) *recursiveACLExecutor {
+	t.Helper()
+
+	checkpoint, err := loadACLCheckpoint(params)
+	require.NoError(t, err)
+
+	for _, op := range checkpointed {
+		checkpoint.Operations[op.key()] = op
+	}
+
+	return &recursiveACLExecutor{client: client, checkpoint: checkpoint, batchSize: 10, maxBatches: maxBatches}
+}
+
+func TestRecursiveACLExecutor_Run(t *testing.T) {
+	item := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw", Type: ACLItemDirectory}
+
+	tests := []struct {
+		name         string
+		acl          string
+		checkpointed *aclOperation
+		batches      []fakeACLBatch
+		failingPaths map[string]bool
+		maxBatches   int
+
+		wantErr            error
+		wantAnyErr         bool
+		wantMarkers        []string
+		wantDirectoryCalls []string
+		wantFileCalls      []string
+		// wantCheckpoint is the operation that remains in the checkpoint, nil if the operation completed
+		wantCheckpoint *aclOperation
+	}{
+		{
+			name:        "Continuation tokens",
+			acl:         "user:u1:r-x",
+			batches:     []fakeACLBatch{{marker: "m1"}, {marker: "m2"}, {}},
+			wantMarkers: []string{"", "m1", "m2"},
+		},
+		{
+			name:        "Interrupted after the maximum number of batches",
+			acl:         "user:u1:r-x",
+			batches:     []fakeACLBatch{{marker: "m1"}, {marker: "m2"}, {}},
+			maxBatches:  2,
+			wantErr:     errACLOperationInterrupted,
+			wantMarkers: []string{"", "m1"},
+			wantCheckpoint: &aclOperation{
+				Item: item, Mode: aclOperationModify, ACL: "user:u1:r-x", Marker: "m2",
+			},
+		},
+		{
+			name:         "Resume from checkpoint",
+			acl:          "user:u1:r-x",
+			checkpointed: &aclOperation{Item: item, Mode: aclOperationModify, ACL: "user:u1:r-x", Marker: "m2"},
+			batches:      []fakeACLBatch{{}},
+			wantMarkers:  []string{"m2"},
+		},
+		{
+			name:         "Checkpoint with another ACL is discarded",
+			acl:          "user:u1:r-x,user:u2:r--",
+			checkpointed: &aclOperation{Item: item, Mode: aclOperationModify, ACL: "user:u1:r-x", Marker: "m2", FailedPaths: []aclFailedPath{{Name: "raw/a.csv"}}},
+			batches:      []fakeACLBatch{{}},
+			wantMarkers:  []string{""},
+		},
+		{
+			name:         "Resume failed paths after the traversal",
+			acl:          "default:user:u1:r-x,user:u1:r-x",
+			checkpointed: &aclOperation{Item: item, Mode: aclOperationModify, ACL: "default:user:u1:r-x,user:u1:r-x", TraversalDone: true, FailedPaths: []aclFailedPath{{Name: "raw/a.csv"}, {Name: "raw/sub", IsDirectory: true}}},
+			wantMarkers:  nil,
+
+			wantDirectoryCalls: []string{"raw/sub"},
+			wantFileCalls:      []string{"raw/a.csv=user:u1:r-x"},
+		},
+		{
+			name: "Failed paths are retried and kept when they still fail",
+			acl:  "user:u1:r-x",
+			batches: []fakeACLBatch{{failed: []*directory.ACLFailedEntry{
+				{Name: ptr.String("raw/a.csv"), Type: ptr.String("file")},
+				{Name: ptr.String("raw/sub"), Type: ptr.String("directory")},
+			}}},
+			failingPaths: map[string]bool{"raw/sub": true},
+			wantAnyErr:   true,
+			wantMarkers:  []string{""},
+
+			wantDirectoryCalls: []string{"raw/sub"},
+			wantFileCalls:      []string{"raw/a.csv=user:u1:r-x"},
+			wantCheckpoint: &aclOperation{
+				Item: item, Mode: aclOperationModify, ACL: "user:u1:r-x", TraversalDone: true, FailedPaths: []aclFailedPath{{Name: "raw/sub", IsDirectory: true}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeACLPathClient{batches: tt.batches, failingPaths: tt.failingPaths}
+
+			var checkpointed []*aclOperation
+			if tt.checkpointed != nil {
+				checkpointed = append(checkpointed, tt.checkpointed)
+			}
+
+			params := map[string]string{global.AzSubscriptionId: "sub", global.AzStateDirectory: t.TempDir()}
+			executor := newTestACLExecutor(t, params, client, tt.maxBatches, checkpointed...)
+
+			op := &aclOperation{Item: item, Mode: aclOperationModify, ACL: tt.acl}
+
+			err := executor.run(context.Background(), op)
+
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorIs(t, err, tt.wantErr)
+			case tt.wantAnyErr:
+				require.Error(t, err)
+			default:
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantMarkers, client.markers)
+			assert.Equal(t, tt.wantDirectoryCalls, client.directoryCalls)
+			assert.Equal(t, tt.wantFileCalls, client.fileCalls)
+
+			// The checkpoint is persisted, so it is verified as the next run would load it
+			reloaded, err := loadACLCheckpoint(params)
+			require.NoError(t, err)
+
+			if tt.wantCheckpoint == nil {
+				assert.Empty(t, reloaded.Operations)
+			} else {
+				assert.Equal(t, map[string]*aclOperation{tt.wantCheckpoint.key(): tt.wantCheckpoint}, reloaded.Operations)
+			}
+		})
+	}
+}
+
+func TestRecursiveACLExecutor_Leftovers(t *testing.T) {
+	raw := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw", Type: ACLItemDirectory}
+	sub := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw/sub", Type: ACLItemDirectory}
+	other := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "rawdata", Type: ACLItemDirectory}
+	file := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw/a.csv", Type: ACLItemFile}
+
+	tests := []struct {
+		name     string
+		leftover *aclOperation
+		current  []*aclOperation
+		// wantACL is the ACL of the leftover that is resumed, empty if it is dropped
+		wantACL string
+	}{
+		{
+			name:     "Unrelated leftover is resumed",
+			leftover: &aclOperation{Item: raw, Mode: aclOperationModify, ACL: "default:user:u1:r-x,user:u1:r-x", Marker: "m1"},
+			current:  []*aclOperation{{Item: other, Mode: aclOperationRemove, ACL: "default:user:u1,user:u1"}},
+			wantACL:  "default:user:u1:r-x,user:u1:r-x",
+		},
+		{
+			name:     "Grant revoked on the same item is dropped",
+			leftover: &aclOperation{Item: raw, Mode: aclOperationModify, ACL: "default:user:u1:r-x,user:u1:r-x", Marker: "m1"},
+			current:  []*aclOperation{{Item: raw, Mode: aclOperationRemove, ACL: "default:user:u1,user:u1"}},
+		},
+		{
+			name:     "Grant revoked on a parent directory is dropped",
+			leftover: &aclOperation{Item: sub, Mode: aclOperationModify, ACL: "default:user:u1:r-x,user:u1:r-x", Marker: "m1"},
+			current:  []*aclOperation{{Item: raw, Mode: aclOperationRemove, ACL: "default:user:u1,user:u1"}},
+		},
+		{
+			name:     "Only the entries of other assignees are resumed",
+			leftover: &aclOperation{Item: raw, Mode: aclOperationModify, ACL: "default:group:g1:r--,default:user:u1:r-x,group:g1:r--,user:u1:r-x", Marker: "m1"},
+			current:  []*aclOperation{{Item: raw, Mode: aclOperationRemove, ACL: "default:user:u1,user:u1"}},
+			wantACL:  "default:group:g1:r--,group:g1:r--",
+		},
+		{
+			name:     "Changes on a file don't supersede its parent",
+			leftover: &aclOperation{Item: raw, Mode: aclOperationModify, ACL: "default:user:u1:r-x,user:u1:r-x", Marker: "m1"},
+			current:  []*aclOperation{{Item: file, Mode: aclOperationRemove, ACL: "user:u1"}},
+			wantACL:  "default:user:u1:r-x,user:u1:r-x",
+		},
+		{
+			name:     "Same operation is resumed by the current run instead",
+			leftover: &aclOperation{Item: raw, Mode: aclOperationModify, ACL: "user:u1:r-x", Marker: "m1"},
+			current:  []*aclOperation{{Item: raw, Mode: aclOperationModify, ACL: "user:u1:r-x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]string{global.AzSubscriptionId: "sub", global.AzStateDirectory: t.TempDir()}
+			executor := newTestACLExecutor(t, params, &fakeACLPathClient{}, 0, tt.leftover)
+
+			leftovers, err := executor.leftovers(tt.current)
+			require.NoError(t, err)
+
+			if tt.wantACL == "" {
+				assert.Empty(t, leftovers)
+
+				return
+			}
+
+			require.Len(t, leftovers, 1)
+			assert.Equal(t, tt.wantACL, leftovers[0].ACL)
+			assert.Equal(t, tt.leftover.Marker, leftovers[0].Marker)
+		})
+	}
+}
+
+func TestRecursiveACLExecutor_RemoveWithChangedACL(t *testing.T) {
+	item := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw", Type: ACLItemDirectory}
+	params := map[string]string{global.AzSubscriptionId: "sub", global.AzStateDirectory: t.TempDir()}
+
+	// The removal of u1 and u2 is interrupted after the first batch
+	client := &fakeACLPathClient{batches: []fakeACLBatch{{marker: "m1"}}}
+	executor := newTestACLExecutor(t, params, client, 1)
+
+	err := executor.run(context.Background(), &aclOperation{Item: item, Mode: aclOperationRemove, ACL: "user:u1,user:u2"})
+	require.ErrorIs(t, err, errACLOperationInterrupted)
+
+	// In the next sync, only u2 and u3 are removed
+	client = &fakeACLPathClient{batches: []fakeACLBatch{{}, {}}}
+	executor = newTestACLExecutor(t, params, client, 0)
+	op := &aclOperation{Item: item, Mode: aclOperationRemove, ACL: "user:u2,user:u3"}
+
+	leftovers, err := executor.leftovers([]*aclOperation{op})
+	require.NoError(t, err)
+
+	// The removal of u1 is finished on the paths that were not handled yet
+	require.Len(t, leftovers, 1)
+	assert.Equal(t, "user:u1", leftovers[0].ACL)
+	assert.Equal(t, "m1", leftovers[0].Marker)
+
+	require.NoError(t, executor.run(context.Background(), leftovers[0]))
+	require.NoError(t, executor.run(context.Background(), op))
+
+	// The new removal starts over
+	assert.Equal(t, []string{"m1", ""}, client.markers)
+
+	reloaded, err := loadACLCheckpoint(params)
+	require.NoError(t, err)
+	assert.Empty(t, reloaded.Operations)
+}
@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/golang-set/set"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const aclStateName = "acl-state"
+
+type aclAppliedEntry struct {
+	Permissions string   `json:"permissions"`
+	APIds       []string `json:"apIds"`
+}
+
+type aclStateItem struct {
+	Item    ACLAssignedItem                 `json:"item"`
+	Entries map[ACLAssignee]aclAppliedEntry `json:"entries"`
+}
+
+// aclTraversalEntry is an execute entry Raito added on a parent directory of granted files
+type aclTraversalEntry struct {
+	// Created is true if Raito created the entry, false if it only added the execute permission to an existing entry
+	Created bool `json:"created"`
+	// Files are the granted files below the directory that need the entry. The entry is revoked when none are left.
+	Files []string `json:"files"`
+}
+
+type aclTraversalItem struct {
+	Item    ACLAssignedItem                    `json:"item"`
+	Entries map[ACLAssignee]*aclTraversalEntry `json:"entries"`
+}
+
+// aclState keeps track of the ACL entries Raito applied on each item, so changes made outside of Raito can be detected.
+type aclState struct {
+	path string
+	// initial is true if there was no state yet, e.g. during the first sync after upgrading
+	initial bool
+
+	Items      map[string]*aclStateItem     `json:"items"`
+	Traversals map[string]*aclTraversalItem `json:"traversals,omitempty"`
+}
+
+func aclItemKey(item ACLAssignedItem) string {
+	return fmt.Sprintf("%s/%s/%s", item.StorageAccount, item.Container, item.Path)
+}
+
+func loadACLState(params map[string]string) (*aclState, error) {
+	path, err := global.StateFilePath(params, aclStateName)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &aclState{path: path}
+
+	err = global.LoadState(path, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Items == nil {
+		state.Items = make(map[string]*aclStateItem)
+		state.initial = true
+	}
+
+	if state.Traversals == nil {
+		state.Traversals = make(map[string]*aclTraversalItem)
+	}
+
+	return state, nil
+}
+
+func (s *aclState) save() error {
+	return global.SaveState(s.path, s)
+}
+
+// items returns all items with ACL entries applied by Raito
+func (s *aclState) items() []ACLAssignedItem {
+	result := make([]ACLAssignedItem, 0, len(s.Items))
+
+	for _, stateItem := range s.Items {
+		result = append(result, stateItem.Item)
+	}
+
+	return result
+}
+
+func (s *aclState) entries(item ACLAssignedItem) map[ACLAssignee]aclAppliedEntry {
+	if stateItem, found := s.Items[aclItemKey(item)]; found {
+		return stateItem.Entries
+	}
+
+	return nil
+}
+
+func (s *aclState) applied(item ACLAssignedItem, assignee ACLAssignee, permissions ACLPermissionSet, apIds []string) {
+	key := aclItemKey(item)
+
+	if _, found := s.Items[key]; !found {
+		s.Items[key] = &aclStateItem{Item: item, Entries: make(map[ACLAssignee]aclAppliedEntry)}
+	}
+
+	s.Items[key].Entries[assignee] = aclAppliedEntry{Permissions: permissions.String(), APIds: apIds}
+}
+
+// seed records the grants of the access providers as applied, if there was no state yet.
+// Entries that Raito created before the state was kept are then recognized as managed by Raito instead of being reported as unmanaged.
+func (s *aclState) seed(acls ACLAssignmentsWithAP) {
+	if !s.initial {
+		return
+	}
+
+	for assignment, changes := range acls {
+		if permissions, toRemove := changes.ChangeSet(); !toRemove && assignment.Item.Type != ACLItemTraversal {
+			s.applied(assignment.Item, assignment.Assignee, permissions, changes.APIds)
+		}
+	}
+
+	s.initial = false
+}
+
+func (s *aclState) removed(item ACLAssignedItem, assignee ACLAssignee) {
+	key := aclItemKey(item)
+
+	if stateItem, found := s.Items[key]; found {
+		delete(stateItem.Entries, assignee)
+
+		if len(stateItem.Entries) == 0 {
+			delete(s.Items, key)
+		}
+	}
+}
+
+// traversed records the execute entries Raito added on a parent directory of granted files.
+// Entries that were recorded before keep their origin, as a later sync only finds the entry it created itself.
+func (s *aclState) traversed(item ACLAssignedItem, added map[ACLAssignee]bool) {
+	if len(added) == 0 {
+		return
+	}
+
+	key := aclItemKey(item)
+
+	if _, found := s.Traversals[key]; !found {
+		s.Traversals[key] = &aclTraversalItem{Item: item, Entries: make(map[ACLAssignee]*aclTraversalEntry)}
+	}
+
+	for assignee, created := range added {
+		if _, found := s.Traversals[key].Entries[assignee]; !found {
+			s.Traversals[key].Entries[assignee] = &aclTraversalEntry{Created: created}
+		}
+	}
+}
+
+func (s *aclState) traversalReleased(item ACLAssignedItem, assignee ACLAssignee) {
+	key := aclItemKey(item)
+
+	if traversal, found := s.Traversals[key]; found {
+		delete(traversal.Entries, assignee)
+
+		if len(traversal.Entries) == 0 {
+			delete(s.Traversals, key)
+		}
+	}
+}
+
+// aclReader reads the live ACL of items and caches the result for the duration of a sync
+type aclReader struct {
+	params map[string]string
+	cache  map[string][]ACLEntry
+}
+
+func newACLReader(params map[string]string) *aclReader {
+	return &aclReader{params: params, cache: make(map[string][]ACLEntry)}
+}
+
+func (r *aclReader) get(ctx context.Context, item ACLAssignedItem) ([]ACLEntry, error) {
+	if entries, found := r.cache[aclItemKey(item)]; found {
+		return entries, nil
+	}
+
+	client, err := createDirectoryClient(ctx, item.StorageAccount, item.Container, item.Path, r.params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.GetAccessControl(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ParseACL(ptr.ToString(resp.ACL))
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache[aclItemKey(item)] = entries
+
+	return entries, nil
+}
+
+// invalidate removes the cached ACL of the item, e.g. after it was changed
+func (r *aclReader) invalidate(item ACLAssignedItem) {
+	delete(r.cache, aclItemKey(item))
+}
+
+// reconcileDrift adds the changes needed to restore the entries Raito applied on the item before, if they were changed outside of Raito.
+// Entries that are not managed by Raito are reported as a warning to the access providers involved with the item. Entries of the inherited assignees are managed by Raito on other items.
+func reconcileDrift(ctx context.Context, reader *aclReader, state *aclState, item ACLAssignedItem, changes map[ACLAssignee]ACLPermissionChangesWithAP, inherited set.Set[ACLAssignee], feedbackHandler global.AccessProviderFeedbackHandler) map[ACLAssignee]ACLPermissionChangesWithAP {
+	applied := state.entries(item)
+
+	live, err := reader.get(ctx, item)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Unable to read the current ACL of %s, skipping drift detection: %s", aclItemKey(item), err.Error()))
+
+		return changes
+	}
+
+	reapply, unmanaged := detectDrift(applied, live, changes, inherited, item.HasDefaultACL())
+
+	result := make(map[ACLAssignee]ACLPermissionChangesWithAP, len(changes)+len(reapply))
+	for assignee, change := range changes {
+		result[assignee] = change
+	}
+
+	for assignee, change := range reapply {
+		message := fmt.Sprintf("ACL entry for %s on %s was changed outside of Raito and will be restored", assignee, aclItemKey(item))
+
+		logger.Warn(message)
+		feedbackHandler.Warning(message, change.APIds...)
+
+		result[assignee] = change
+	}
+
+	if len(unmanaged) > 0 {
+		apIds := set.NewSet[string]()
+		for _, change := range result {
+			apIds.Add(change.APIds...)
+		}
+
+		for _, entry := range applied {
+			apIds.Add(entry.APIds...)
+		}
+
+		descriptions := make([]string, 0, len(unmanaged))
+		for _, entry := range unmanaged {
+			description := fmt.Sprintf("%s:%s", entry.Assignee(), entry.Permissions)
+			if entry.Default {
+				description = "default:" + description
+			}
+
+			descriptions = append(descriptions, description)
+		}
+
+		message := fmt.Sprintf("ACL of %s contains entries that are not managed by Raito: %s", aclItemKey(item), strings.Join(descriptions, ", "))
+
+		logger.Info(message)
+		feedbackHandler.Warning(message, apIds.Slice()...)
+	}
+
+	return result
+}
+
+// inheritedAssignees returns the assignees of which the entries on the item are managed by Raito on other items:
+// the entries applied recursively on a directory above the item and the execute entries that make the item traversable for granted files below it.
+func inheritedAssignees(item ACLAssignedItem, state *aclState, acls ...map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP) set.Set[ACLAssignee] {
+	result := set.NewSet[ACLAssignee]()
+
+	inherits := func(other ACLAssignedItem) bool {
+		if other.StorageAccount != item.StorageAccount || other.Container != item.Container {
+			return false
+		}
+
+		if other.Type == ACLItemTraversal {
+			return other.Path == item.Path
+		}
+
+		return other.Path != item.Path && isSameOrParentPath(other, item.Path)
+	}
+
+	for _, stateItem := range state.Items {
+		if inherits(stateItem.Item) {
+			for assignee := range stateItem.Entries {
+				result.Add(assignee)
+			}
+		}
+	}
+
+	for _, traversal := range state.Traversals {
+		if inherits(traversal.Item) {
+			for assignee := range traversal.Entries {
+				result.Add(assignee)
+			}
+		}
+	}
+
+	for _, aclsPerItem := range acls {
+		for other, changes := range aclsPerItem {
+			if !inherits(other) {
+				continue
+			}
+
+			for assignee, change := range changes {
+				if _, toRemove := change.ChangeSet(); !toRemove {
+					result.Add(assignee)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// detectDrift compares the entries Raito applied on an item with its live ACL.
+// It returns the changes needed to restore the Raito entries that were changed outside of Raito and the named entries that are not managed by Raito.
+// Assignees that are changed in the current sync are ignored, as are the inherited assignees of which Raito manages the entries on other items. The default entries are only compared if withDefault is true.
+func detectDrift(applied map[ACLAssignee]aclAppliedEntry, live []ACLEntry, changes map[ACLAssignee]ACLPermissionChangesWithAP, inherited set.Set[ACLAssignee], withDefault bool) (map[ACLAssignee]ACLPermissionChangesWithAP, []ACLEntry) {
+	liveAccess := make(map[ACLAssignee]ACLPermissionSet)
+	liveDefault := make(map[ACLAssignee]ACLPermissionSet)
+
+	var unmanaged []ACLEntry
+
+	for _, entry := range live {
+		if !entry.IsNamed() {
+			continue
+		}
+
+		assignee := entry.Assignee()
+
+		if entry.Default {
+			liveDefault[assignee] = entry.Permissions
+		} else {
+			liveAccess[assignee] = entry.Permissions
+		}
+
+		_, isApplied := applied[assignee]
+		_, isChanged := changes[assignee]
+
+		if !isApplied && !isChanged && !inherited.Contains(assignee) {
+			unmanaged = append(unmanaged, entry)
+		}
+	}
+
+	reapply := make(map[ACLAssignee]ACLPermissionChangesWithAP)
+
+	for assignee, appliedEntry := range applied {
+		if _, isChanged := changes[assignee]; isChanged {
+			continue
+		}
+
+		permissions, err := ParseACLPermissionSet(appliedEntry.Permissions)
+		if err != nil {
+			continue
+		}
+
+		accessPermissions, accessFound := liveAccess[assignee]
+		defaultPermissions, defaultFound := liveDefault[assignee]
+
+		accessDrifted := !accessFound || accessPermissions != permissions
+		defaultDrifted := withDefault && (!defaultFound || defaultPermissions != permissions)
+
+		if accessDrifted || defaultDrifted {
+			reapply[assignee] = ACLPermissionChangesWithAP{
+				ACLPermissionChanges: ACLPermissionChanges{Added: permissions},
+				APIds:                appliedEntry.APIds,
+			}
+		}
+	}
+
+	sort.Slice(unmanaged, func(i, j int) bool {
+		if unmanaged[i].Assignee() == unmanaged[j].Assignee() {
+			return !unmanaged[i].Default && unmanaged[j].Default
+		}
+
+		return unmanaged[i].Assignee() < unmanaged[j].Assignee()
+	})
+
+	return reapply, unmanaged
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/raito-io/golang-set/set"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectDrift(t *testing.T) {
+	applied := map[ACLAssignee]aclAppliedEntry{
+		"user:unchanged": {Permissions: "r-x", APIds: []string{"ap1"}},
+		"user:changed":   {Permissions: "r-x", APIds: []string{"ap1"}},
+		"group:removed":  {Permissions: "rwx", APIds: []string{"ap2"}},
+		"user:updated":   {Permissions: "r--", APIds: []string{"ap3"}},
+	}
+
+	live := []ACLEntry{
+		{Type: "user", Permissions: NewACLPermissionSet(Read, Write, Execute)},
+		{Type: "user", Qualifier: "unchanged", Permissions: NewACLPermissionSet(Read, Execute)},
+		{Default: true, Type: "user", Qualifier: "unchanged", Permissions: NewACLPermissionSet(Read, Execute)},
+		{Type: "user", Qualifier: "changed", Permissions: NewACLPermissionSet(Read, Write, Execute)},
+		{Default: true, Type: "user", Qualifier: "changed", Permissions: NewACLPermissionSet(Read, Execute)},
+		{Type: "user", Qualifier: "manual", Permissions: NewACLPermissionSet(Read)},
+		{Type: "user", Qualifier: "inherited", Permissions: NewACLPermissionSet(Execute)},
+		{Type: "mask", Permissions: NewACLPermissionSet(Read, Write, Execute)},
+	}
+
+	changes := map[ACLAssignee]ACLPermissionChangesWithAP{
+		"user:updated": {ACLPermissionChanges: ACLPermissionChanges{Added: NewACLPermissionSet(Read, Write)}, APIds: []string{"ap3"}},
+	}
+
+	reapply, unmanaged := detectDrift(applied, live, changes, set.NewSet[ACLAssignee]("user:inherited"), true)
+
+	assert.Equal(t, map[ACLAssignee]ACLPermissionChangesWithAP{
+		"user:changed":  {ACLPermissionChanges: ACLPermissionChanges{Added: NewACLPermissionSet(Read, Execute)}, APIds: []string{"ap1"}},
+		"group:removed": {ACLPermissionChanges: ACLPermissionChanges{Added: NewACLPermissionSet(Read, Write, Execute)}, APIds: []string{"ap2"}},
+	}, reapply)
+	assert.Equal(t, []ACLEntry{{Type: "user", Qualifier: "manual", Permissions: NewACLPermissionSet(Read)}}, unmanaged)
+}
+
+func TestInheritedAssignees(t *testing.T) {
+	raw := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw", Type: ACLItemDirectory}
+	sub := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw/sub", Type: ACLItemDirectory}
+	root := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "", Type: ACLItemDirectory}
+	sibling := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "rawdata", Type: ACLItemDirectory}
+	file := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw/sub/a.csv", Type: ACLItemFile}
+	traversal := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw/sub", Type: ACLItemTraversal}
+
+	state := &aclState{Items: map[string]*aclStateItem{
+		aclItemKey(root):    {Item: root, Entries: map[ACLAssignee]aclAppliedEntry{"group:everyone": {Permissions: "r-x"}}},
+		aclItemKey(sub):     {Item: sub, Entries: map[ACLAssignee]aclAppliedEntry{"user:own": {Permissions: "r-x"}}},
+		aclItemKey(sibling): {Item: sibling, Entries: map[ACLAssignee]aclAppliedEntry{"user:sibling": {Permissions: "r-x"}}},
+	}}
+
+	added := ACLPermissionChangesWithAP{ACLPermissionChanges: ACLPermissionChanges{Added: NewACLPermissionSet(Read)}}
+	removed := ACLPermissionChangesWithAP{ACLPermissionChanges: ACLPermissionChanges{Removed: NewACLPermissionSet(Read)}}
+
+	acls := map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP{
+		raw:  {"user:parent": added, "user:revoked": removed},
+		file: {"user:file": added},
+	}
+	traversals := map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP{
+		traversal: {"user:file": added},
+	}
+
+	result := inheritedAssignees(sub, state, acls, traversals)
+
+	assert.ElementsMatch(t, []ACLAssignee{"group:everyone", "user:parent", "user:file"}, result.Slice())
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/directory"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/golang-set/set"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// grantTraversal adds execute permissions for the assignees to the access ACL of a parent directory of granted files.
+// The ACL is not applied recursively, as only the directory itself needs to be traversable.
+// It returns the assignees of which Raito changed the entry, with true if the entry was created.
+func grantTraversal(ctx context.Context, reader *aclReader, params map[string]string, item ACLAssignedItem, changes map[ACLAssignee]ACLPermissionChangesWithAP, feedbackHandler global.AccessProviderFeedbackHandler) map[ACLAssignee]bool {
+	apIds := make([]string, 0, len(changes))
+	assignees := make([]ACLAssignee, 0, len(changes))
+
+	for assignee, change := range changes {
+		assignees = append(assignees, assignee)
+		apIds = append(apIds, change.APIds...)
+	}
+
+	added, err := setTraversalACL(ctx, reader, params, item, assignees)
+	if err != nil {
+		message := fmt.Sprintf("Unable to grant execute permissions on parent directory %s: %s", aclItemKey(item), err.Error())
+
+		logger.Error(message)
+		feedbackHandler.Error(message, apIds...)
+	}
+
+	return added
+}
+
+func setTraversalACL(ctx context.Context, reader *aclReader, params map[string]string, item ACLAssignedItem, assignees []ACLAssignee) (map[ACLAssignee]bool, error) {
+	live, err := reader.get(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, added := mergeTraversalACL(live, assignees)
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	accessEntries := 0
+
+	for _, entry := range entries {
+		if !entry.Default {
+			accessEntries++
+		}
+	}
+
+	if accessEntries > maxACLEntries {
+		return nil, fmt.Errorf("the ACL would exceed the maximum of %d entries", maxACLEntries)
+	}
+
+	err = writeTraversalACL(ctx, reader, params, item, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// releaseTraversals updates the granted files that need the execute entries Raito added on parent directories.
+// Entries that are no longer needed by any granted file are revoked, unless the assignee is granted access on the directory itself or on a directory above it.
+func releaseTraversals(ctx context.Context, reader *aclReader, params map[string]string, state *aclState, aclsPerItem map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP) {
+	for key, traversal := range state.Traversals {
+		unused := make(map[ACLAssignee]bool)
+
+		for assignee, entry := range traversal.Entries {
+			entry.Files = traversalReferences(traversal.Item, assignee, state, aclsPerItem)
+
+			if len(entry.Files) == 0 {
+				unused[assignee] = entry.Created
+			}
+		}
+
+		if len(unused) == 0 {
+			continue
+		}
+
+		granted := directoryAssignees(traversal.Item, state, aclsPerItem)
+		toRevoke := make(map[ACLAssignee]bool, len(unused))
+
+		for assignee, created := range unused {
+			if !granted.Contains(assignee) {
+				toRevoke[assignee] = created
+			}
+		}
+
+		err := revokeTraversal(ctx, reader, params, traversal.Item, toRevoke)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to revoke execute permissions on parent directory %s, retrying during the next sync: %s", key, err.Error()))
+
+			continue
+		}
+
+		for assignee := range unused {
+			state.traversalReleased(traversal.Item, assignee)
+		}
+	}
+}
+
+// revokeTraversal removes the execute entries of the assignees from the access ACL of the directory.
+// Entries that Raito created are removed, of other entries only the execute permission is removed.
+func revokeTraversal(ctx context.Context, reader *aclReader, params map[string]string, item ACLAssignedItem, assignees map[ACLAssignee]bool) error {
+	if len(assignees) == 0 {
+		return nil
+	}
+
+	// The operations of this sync could have changed the ACL since it was read
+	reader.invalidate(item)
+
+	live, err := reader.get(ctx, item)
+	if err != nil {
+		return err
+	}
+
+	entries, changed := stripTraversalACL(live, assignees)
+	if !changed {
+		return nil
+	}
+
+	return writeTraversalACL(ctx, reader, params, item, entries)
+}
+
+func writeTraversalACL(ctx context.Context, reader *aclReader, params map[string]string, item ACLAssignedItem, entries []ACLEntry) error {
+	acl := make([]string, 0, len(entries))
+	accessEntries := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		acl = append(acl, entry.String())
+
+		if !entry.Default {
+			accessEntries = append(accessEntries, entry.String())
+		}
+	}
+
+	client, err := createDirectoryClient(ctx, item.StorageAccount, item.Container, item.Path, params)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Set traversal ACL on %s: %s", aclItemKey(item), strings.Join(accessEntries, ",")))
+
+	_, err = client.SetAccessControl(ctx, &directory.SetAccessControlOptions{ACL: ptr.String(strings.Join(acl, ","))})
+	if err != nil {
+		return err
+	}
+
+	reader.invalidate(item)
+
+	return nil
+}
+
+// traversalReferences returns the granted files below the directory that need the execute entry of the assignee on it:
+// the files with an entry for the assignee in the state and the files granted to the assignee in this sync.
+func traversalReferences(item ACLAssignedItem, assignee ACLAssignee, state *aclState, aclsPerItem map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP) []string {
+	files := set.NewSet[string]()
+
+	below := func(file ACLAssignedItem) bool {
+		return file.Type == ACLItemFile && file.StorageAccount == item.StorageAccount && file.Container == item.Container &&
+			(item.Path == "" || strings.HasPrefix(file.Path, item.Path+"/"))
+	}
+
+	for _, stateItem := range state.Items {
+		if _, found := stateItem.Entries[assignee]; found && below(stateItem.Item) {
+			files.Add(aclItemKey(stateItem.Item))
+		}
+	}
+
+	for file, changes := range aclsPerItem {
+		if change, found := changes[assignee]; found && below(file) {
+			if _, toRemove := change.ChangeSet(); !toRemove {
+				files.Add(aclItemKey(file))
+			}
+		}
+	}
+
+	result := files.Slice()
+	sort.Strings(result)
+
+	return result
+}
+
+// directoryAssignees returns the assignees that are granted access by Raito on the directory itself or recursively on a directory above it
+func directoryAssignees(item ACLAssignedItem, state *aclState, aclsPerItem map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP) set.Set[ACLAssignee] {
+	result := set.NewSet[ACLAssignee]()
+
+	grants := func(other ACLAssignedItem) bool {
+		return other.HasDefaultACL() && other.StorageAccount == item.StorageAccount && other.Container == item.Container && isSameOrParentPath(other, item.Path)
+	}
+
+	for _, stateItem := range state.Items {
+		if grants(stateItem.Item) {
+			for assignee := range stateItem.Entries {
+				result.Add(assignee)
+			}
+		}
+	}
+
+	for other, changes := range aclsPerItem {
+		if !grants(other) {
+			continue
+		}
+
+		for assignee, change := range changes {
+			if _, toRemove := change.ChangeSet(); !toRemove {
+				result.Add(assignee)
+			}
+		}
+	}
+
+	return result
+}
+
+// mergeTraversalACL adds the execute permission for the assignees to the access entries of the ACL.
+// Existing entries keep their permissions and the mask is extended so the execute permission is effective.
+// It returns the resulting entries and the assignees of which the entry changed, with true if the entry was created.
+func mergeTraversalACL(live []ACLEntry, assignees []ACLAssignee) ([]ACLEntry, map[ACLAssignee]bool) {
+	result := make([]ACLEntry, 0, len(live)+len(assignees)+1)
+	toAdd := make(map[ACLAssignee]struct{}, len(assignees))
+
+	for _, assignee := range assignees {
+		toAdd[assignee] = struct{}{}
+	}
+
+	added := make(map[ACLAssignee]bool)
+	maskIdx := -1
+	groupClass := ACLPermissionSet(0)
+
+	for _, entry := range live {
+		if !entry.Default {
+			if _, found := toAdd[entry.Assignee()]; found && entry.IsNamed() {
+				delete(toAdd, entry.Assignee())
+
+				if !entry.Permissions.Contains(Execute) {
+					entry.Permissions = entry.Permissions.Add(Execute)
+					added[entry.Assignee()] = false
+				}
+			}
+
+			if entry.Type == "mask" {
+				maskIdx = len(result)
+			} else if entry.IsNamed() || entry.Type == "group" {
+				groupClass = groupClass.Or(entry.Permissions)
+			}
+		}
+
+		result = append(result, entry)
+	}
+
+	newAssignees := make([]ACLAssignee, 0, len(toAdd))
+	for assignee := range toAdd {
+		newAssignees = append(newAssignees, assignee)
+	}
+
+	sort.Slice(newAssignees, func(i, j int) bool {
+		return newAssignees[i] < newAssignees[j]
+	})
+
+	for _, assignee := range newAssignees {
+		entryType, qualifier, _ := strings.Cut(string(assignee), ":")
+		result = append(result, ACLEntry{Type: entryType, Qualifier: qualifier, Permissions: NewACLPermissionSet(Execute)})
+		groupClass = groupClass.Add(Execute)
+		added[assignee] = true
+	}
+
+	if len(added) == 0 {
+		return result, nil
+	}
+
+	if maskIdx >= 0 {
+		result[maskIdx].Permissions = result[maskIdx].Permissions.Add(Execute)
+	} else {
+		result = append(result, ACLEntry{Type: "mask", Permissions: groupClass})
+	}
+
+	return result, added
+}
+
+// stripTraversalACL removes the execute permission of the assignees from the access entries of the ACL.
+// Entries that were created for traversal (true in assignees) are removed if they only contain the execute permission. The mask is kept as is.
+// It returns the resulting entries and whether anything changed.
+func stripTraversalACL(live []ACLEntry, assignees map[ACLAssignee]bool) ([]ACLEntry, bool) {
+	result := make([]ACLEntry, 0, len(live))
+	changed := false
+
+	for _, entry := range live {
+		created, found := assignees[entry.Assignee()]
+		if entry.Default || !entry.IsNamed() || !found || !entry.Permissions.Contains(Execute) {
+			result = append(result, entry)
+
+			continue
+		}
+
+		changed = true
+
+		if created && entry.Permissions == NewACLPermissionSet(Execute) {
+			continue
+		}
+
+		entry.Permissions = entry.Permissions.Remove(Execute)
+		result = append(result, entry)
+	}
+
+	return result, changed
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeTraversalACL(t *testing.T) {
+	base := []ACLEntry{
+		{Type: "user", Permissions: NewACLPermissionSet(Read, Write, Execute)},
+		{Type: "group", Permissions: NewACLPermissionSet(Read)},
+		{Type: "other"},
+	}
+
+	t.Run("New entries and mask", func(t *testing.T) {
+		result, added := mergeTraversalACL(base, []ACLAssignee{"user:b", "group:a"})
+
+		assert.Equal(t, map[ACLAssignee]bool{"user:b": true, "group:a": true}, added)
+		assert.Equal(t, append(append([]ACLEntry{}, base...),
+			ACLEntry{Type: "group", Qualifier: "a", Permissions: NewACLPermissionSet(Execute)},
+			ACLEntry{Type: "user", Qualifier: "b", Permissions: NewACLPermissionSet(Execute)},
+			ACLEntry{Type: "mask", Permissions: NewACLPermissionSet(Read, Execute)},
+		), result)
+	})
+
+	t.Run("Existing entries are extended", func(t *testing.T) {
+		live := append(append([]ACLEntry{}, base...),
+			ACLEntry{Type: "user", Qualifier: "a", Permissions: NewACLPermissionSet(Read)},
+			ACLEntry{Type: "mask", Permissions: NewACLPermissionSet(Read)},
+			ACLEntry{Default: true, Type: "user", Qualifier: "a", Permissions: NewACLPermissionSet(Read)},
+		)
+
+		result, added := mergeTraversalACL(live, []ACLAssignee{"user:a"})
+
+		assert.Equal(t, map[ACLAssignee]bool{"user:a": false}, added)
+		assert.Equal(t, NewACLPermissionSet(Read, Execute), result[3].Permissions)
+		assert.Equal(t, NewACLPermissionSet(Read, Execute), result[4].Permissions)
+		assert.Equal(t, NewACLPermissionSet(Read), result[5].Permissions)
+	})
+
+	t.Run("Already traversable", func(t *testing.T) {
+		live := append(append([]ACLEntry{}, base...),
+			ACLEntry{Type: "user", Qualifier: "a", Permissions: NewACLPermissionSet(Read, Execute)},
+		)
+
+		_, added := mergeTraversalACL(live, []ACLAssignee{"user:a"})
+
+		assert.Empty(t, added)
+	})
+}
+
+func TestStripTraversalACL(t *testing.T) {
+	base := []ACLEntry{
+		{Type: "user", Permissions: NewACLPermissionSet(Read, Write, Execute)},
+		{Type: "group", Permissions: NewACLPermissionSet(Read)},
+		{Type: "other"},
+		{Type: "user", Qualifier: "a", Permissions: NewACLPermissionSet(Execute)},
+		{Type: "user", Qualifier: "b", Permissions: NewACLPermissionSet(Read, Execute)},
+		{Type: "group", Qualifier: "c", Permissions: NewACLPermissionSet(Read, Execute)},
+		{Type: "mask", Permissions: NewACLPermissionSet(Read, Execute)},
+		{Default: true, Type: "user", Qualifier: "b", Permissions: NewACLPermissionSet(Read, Execute)},
+	}
+
+	t.Run("Created entries are removed, others lose the execute permission", func(t *testing.T) {
+		result, changed := stripTraversalACL(base, map[ACLAssignee]bool{"user:a": true, "user:b": false})
+
+		assert.True(t, changed)
+		assert.Equal(t, []ACLEntry{
+			base[0], base[1], base[2],
+			{Type: "user", Qualifier: "b", Permissions: NewACLPermissionSet(Read)},
+			base[5], base[6], base[7],
+		}, result)
+	})
+
+	t.Run("Created entries with other permissions are kept", func(t *testing.T) {
+		result, changed := stripTraversalACL(base, map[ACLAssignee]bool{"group:c": true})
+
+		assert.True(t, changed)
+		assert.Equal(t, ACLEntry{Type: "group", Qualifier: "c", Permissions: NewACLPermissionSet(Read)}, result[5])
+	})
+
+	t.Run("Entries already without execute permission", func(t *testing.T) {
+		_, changed := stripTraversalACL(base, map[ACLAssignee]bool{"user:d": true})
+
+		assert.False(t, changed)
+	})
+}
+
+func TestTraversalReferences(t *testing.T) {
+	dir := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw", Type: ACLItemTraversal}
+	root := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "", Type: ACLItemTraversal}
+
+	file := func(path string) ACLAssignedItem {
+		return ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: path, Type: ACLItemFile}
+	}
+
+	state := &aclState{Items: map[string]*aclStateItem{}, Traversals: map[string]*aclTraversalItem{}}
+	state.applied(file("raw/a.csv"), "user:u1", NewACLPermissionSet(Read), []string{"ap1"})
+	state.applied(file("rawdata/b.csv"), "user:u1", NewACLPermissionSet(Read), []string{"ap1"})
+	state.applied(ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "raw/sub", Type: ACLItemDirectory}, "user:u1", NewACLPermissionSet(Read), []string{"ap1"})
+
+	acls := map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP{
+		file("raw/sub/c.csv"): {
+			"user:u1": {ACLPermissionChanges: ACLPermissionChanges{Added: NewACLPermissionSet(Read)}},
+			"user:u2": {ACLPermissionChanges: ACLPermissionChanges{Removed: NewACLPermissionSet(Read)}},
+		},
+	}
+
+	assert.Equal(t, []string{"sa/data/raw/a.csv", "sa/data/raw/sub/c.csv"}, traversalReferences(dir, "user:u1", state, acls))
+	assert.Equal(t, []string{"sa/data/raw/a.csv", "sa/data/raw/sub/c.csv", "sa/data/rawdata/b.csv"}, traversalReferences(root, "user:u1", state, acls))
+	assert.Empty(t, traversalReferences(dir, "user:u2", state, acls))
+
+	state.traversed(dir, map[ACLAssignee]bool{"user:u2": true})
+	state.traversed(dir, map[ACLAssignee]bool{"user:u2": false})
+	assert.True(t, state.Traversals["sa/data/raw"].Entries["user:u2"].Created)
+
+	state.traversalReleased(dir, "user:u2")
+	assert.Empty(t, state.Traversals)
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// activityLogOperationSuffixes are the kinds of management operations that are reported as usage. Read operations are not included.
+var activityLogOperationSuffixes = []string{"/write", "/action", "/delete"}
+
+// activityLogResources resolves the resource IDs in the Activity Log to the data objects of the subscription.
+// The Activity Log doesn't preserve the casing of resource groups, so the names are resolved case-insensitively.
+type activityLogResources struct {
+	subscriptionId  string
+	resourceGroups  map[string]string
+	storageAccounts map[string]string
+}
+
+func newActivityLogResources(subscriptionId string, storageAccountsPerResourceGroup map[string][]string) *activityLogResources {
+	resources := &activityLogResources{
+		subscriptionId:  subscriptionId,
+		resourceGroups:  make(map[string]string),
+		storageAccounts: make(map[string]string),
+	}
+
+	for resourceGroup, storageAccounts := range storageAccountsPerResourceGroup {
+		resources.resourceGroups[strings.ToLower(resourceGroup)] = resourceGroup
+
+		for _, storageAccount := range storageAccounts {
+			resources.storageAccounts[strings.ToLower(resourceGroup+"/"+storageAccount)] = storageAccount
+		}
+	}
+
+	return resources
+}
+
+// dataObject returns the full name and type of the data object that is affected by a management operation on the resource.
+// Role assignments, locks and other extension resources are attributed to the resource they are assigned on.
+// Resources that are not (part of) a known resource group, storage account or container are ignored.
+func (r *activityLogResources) dataObject(resourceId string) (string, string, bool) {
+	parts := strings.Split(strings.Trim(resourceId, "/"), "/")
+
+	for i := 2; i+1 < len(parts); i++ {
+		// Providers nested in a storage account and the authorization provider are extensions of the resource before them
+		if strings.EqualFold(parts[i], "providers") && (i >= 8 || strings.EqualFold(parts[i+1], "Microsoft.Authorization")) {
+			parts = parts[:i]
+
+			break
+		}
+	}
+
+	if len(parts) < 2 || !strings.EqualFold(parts[0], "subscriptions") || !strings.EqualFold(parts[1], r.subscriptionId) {
+		return "", "", false
+	}
+
+	if len(parts) == 2 {
+		return r.subscriptionId, Subscription, true
+	}
+
+	if len(parts) < 4 || !strings.EqualFold(parts[2], "resourceGroups") {
+		return "", "", false
+	}
+
+	resourceGroup, found := r.resourceGroups[strings.ToLower(parts[3])]
+	if !found {
+		return "", "", false
+	}
+
+	if len(parts) == 4 {
+		return fmt.Sprintf("%s/%s", r.subscriptionId, resourceGroup), ResourceGroup, true
+	}
+
+	if len(parts) < 8 || !strings.EqualFold(parts[4], "providers") || !strings.EqualFold(parts[5], AzApiNamespace) || !strings.EqualFold(parts[6], "storageAccounts") {
+		return "", "", false
+	}
+
+	storageAccount, found := r.storageAccounts[strings.ToLower(resourceGroup+"/"+parts[7])]
+	if !found {
+		return "", "", false
+	}
+
+	storageAccountName := fmt.Sprintf("%s/%s/%s", r.subscriptionId, resourceGroup, storageAccount)
+
+	if len(parts) >= 12 && strings.EqualFold(parts[8], "blobServices") && strings.EqualFold(parts[10], "containers") {
+		return fmt.Sprintf("%s/%s", storageAccountName, parts[11]), Container, true
+	}
+
+	return storageAccountName, StorageAccount, true
+}
+
+// syncActivityLogUsage reports the management operations in the Activity Log of the subscription as admin usage
+func syncActivityLogUsage(ctx context.Context, monitorService monitor.MonitorService, storageAccountsPerResourceGroup map[string][]string, startDate time.Time, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
+	resources := newActivityLogResources(configParams.GetString(global.AzSubscriptionId), storageAccountsPerResourceGroup)
+
+	return monitorService.GetActivityLogs(ctx, configParams, startDate, func(entry monitor.ActivityLogEntry) error {
+		statement := activityLogEntryToStatement(ctx, configParams, resources, entry)
+		if statement == nil {
+			return nil
+		}
+
+		return commit(*statement)
+	})
+}
+
+// activityLogEntryToStatement converts a management operation into a data usage statement. It returns nil if the operation is not tracked.
+func activityLogEntryToStatement(ctx context.Context, configParams *config.ConfigMap, resources *activityLogResources, entry monitor.ActivityLogEntry) *data_usage.Statement {
+	if !isTrackedManagementOperation(entry.OperationName) {
+		return nil
+	}
+
+	fullName, doType, found := resources.dataObject(entry.ResourceId)
+	if !found {
+		return nil
+	}
+
+	user := global.GetRequesterNameById(ctx, configParams.Parameters, entry.CallerObjectId)
+	if user == "" {
+		user = entry.Caller
+	}
+
+	statement := &data_usage.Statement{
+		ExternalId: entry.EventDataId,
+		User:       user,
+		StartTime:  entry.EventTimestamp.Unix(),
+		EndTime:    entry.EventTimestamp.Unix(),
+		AccessedDataObjects: []data_usage.UsageDataObjectItem{
+			{
+				DataObject: data_usage.UsageDataObjectReference{
+					FullName: fullName,
+					Type:     doType,
+				},
+				Permissions:      []string{entry.OperationName},
+				GlobalPermission: data_usage.Admin,
+			},
+		},
+		Success: strings.EqualFold(entry.Status, "Succeeded"),
+		Status:  entry.SubStatus,
+	}
+
+	if entry.CallerIpAddress != "" {
+		statement.Query = fmt.Sprintf("Caller IP: %s", entry.CallerIpAddress)
+	}
+
+	if !statement.Success {
+		statement.Error = entry.SubStatus
+		if statement.Error == "" {
+			statement.Error = entry.Status
+		}
+	}
+
+	return statement
+}
+
+func isTrackedManagementOperation(operationName string) bool {
+	operationName = strings.ToLower(operationName)
+
+	for _, suffix := range activityLogOperationSuffixes {
+		if strings.HasSuffix(operationName, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+func TestActivityLogResources_DataObject(t *testing.T) {
+	resources := newActivityLogResources("sub", map[string][]string{"MyGroup": {"account"}})
+
+	tests := []struct {
+		name         string
+		resourceId   string
+		wantFullName string
+		wantType     string
+		wantFound    bool
+	}{
+		{name: "Subscription", resourceId: "/subscriptions/sub", wantFullName: "sub", wantType: Subscription, wantFound: true},
+		{name: "Subscription role assignment", resourceId: "/subscriptions/sub/providers/Microsoft.Authorization/roleAssignments/ra", wantFullName: "sub", wantType: Subscription, wantFound: true},
+		{name: "Resource group", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP", wantFullName: "sub/MyGroup", wantType: ResourceGroup, wantFound: true},
+		{name: "Resource group role assignment", resourceId: "/subscriptions/sub/resourcegroups/mygroup/providers/Microsoft.Authorization/roleAssignments/ra", wantFullName: "sub/MyGroup", wantType: ResourceGroup, wantFound: true},
+		{name: "Storage account", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP/providers/Microsoft.Storage/storageAccounts/account", wantFullName: "sub/MyGroup/account", wantType: StorageAccount, wantFound: true},
+		{name: "Blob service", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP/providers/Microsoft.Storage/storageAccounts/account/blobServices/default", wantFullName: "sub/MyGroup/account", wantType: StorageAccount, wantFound: true},
+		{name: "Storage account diagnostic setting", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP/providers/Microsoft.Storage/storageAccounts/account/providers/Microsoft.Insights/diagnosticSettings/logs", wantFullName: "sub/MyGroup/account", wantType: StorageAccount, wantFound: true},
+		{name: "Container", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP/providers/Microsoft.Storage/storageAccounts/account/blobServices/default/containers/data", wantFullName: "sub/MyGroup/account/data", wantType: Container, wantFound: true},
+		{name: "Container role assignment", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP/providers/Microsoft.Storage/storageAccounts/account/blobServices/default/containers/data/providers/Microsoft.Authorization/roleAssignments/ra", wantFullName: "sub/MyGroup/account/data", wantType: Container, wantFound: true},
+		{name: "Other subscription", resourceId: "/subscriptions/other/resourceGroups/MYGROUP"},
+		{name: "Unknown resource group", resourceId: "/subscriptions/sub/resourceGroups/other"},
+		{name: "Unknown storage account", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP/providers/Microsoft.Storage/storageAccounts/other"},
+		{name: "Other provider", resourceId: "/subscriptions/sub/resourceGroups/MYGROUP/providers/Microsoft.Compute/virtualMachines/vm"},
+		{name: "Subscription level provider", resourceId: "/subscriptions/sub/providers/Microsoft.Security/pricings/default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fullName, doType, found := resources.dataObject(tt.resourceId)
+
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.wantFullName, fullName)
+			assert.Equal(t, tt.wantType, doType)
+		})
+	}
+}
+
+func TestActivityLogEntryToStatement(t *testing.T) {
+	configParams := &config.ConfigMap{Parameters: map[string]string{global.AzSubscriptionId: "sub"}}
+	resources := newActivityLogResources("sub", map[string][]string{"MyGroup": {"account"}})
+	timestamp := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Listing keys", func(t *testing.T) {
+		statement := activityLogEntryToStatement(context.Background(), configParams, resources, monitor.ActivityLogEntry{
+			EventTimestamp:  timestamp,
+			EventDataId:     "event",
+			OperationName:   "Microsoft.Storage/storageAccounts/listKeys/action",
+			ResourceId:      "/subscriptions/sub/resourceGroups/MyGroup/providers/Microsoft.Storage/storageAccounts/account",
+			Status:          "Succeeded",
+			SubStatus:       "OK",
+			Caller:          "alice@example.com",
+			CallerIpAddress: "10.0.0.1",
+		})
+
+		require.NotNil(t, statement)
+		assert.Equal(t, data_usage.Statement{
+			ExternalId: "event",
+			User:       "alice@example.com",
+			StartTime:  timestamp.Unix(),
+			EndTime:    timestamp.Unix(),
+			AccessedDataObjects: []data_usage.UsageDataObjectItem{
+				{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/MyGroup/account", Type: StorageAccount},
+					Permissions:      []string{"Microsoft.Storage/storageAccounts/listKeys/action"},
+					GlobalPermission: data_usage.Admin,
+				},
+			},
+			Success: true,
+			Status:  "OK",
+			Query:   "Caller IP: 10.0.0.1",
+		}, *statement)
+	})
+
+	t.Run("Failed role assignment", func(t *testing.T) {
+		statement := activityLogEntryToStatement(context.Background(), configParams, resources, monitor.ActivityLogEntry{
+			EventTimestamp: timestamp,
+			OperationName:  "Microsoft.Authorization/roleAssignments/write",
+			ResourceId:     "/subscriptions/sub/resourceGroups/MyGroup/providers/Microsoft.Authorization/roleAssignments/ra",
+			Status:         "Failed",
+			SubStatus:      "Forbidden",
+			Caller:         "alice@example.com",
+		})
+
+		require.NotNil(t, statement)
+		assert.False(t, statement.Success)
+		assert.Equal(t, "Forbidden", statement.Error)
+		assert.Equal(t, "sub/MyGroup", statement.AccessedDataObjects[0].DataObject.FullName)
+	})
+
+	t.Run("Read operations are ignored", func(t *testing.T) {
+		statement := activityLogEntryToStatement(context.Background(), configParams, resources, monitor.ActivityLogEntry{
+			OperationName: "Microsoft.Storage/storageAccounts/read",
+			ResourceId:    "/subscriptions/sub/resourceGroups/MyGroup/providers/Microsoft.Storage/storageAccounts/account",
+			Status:        "Succeeded",
+		})
+
+		assert.Nil(t, statement)
+	})
+}
@@ -0,0 +1,562 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/linkedin/goavro/v2"
+	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/raito-io/cli/base/wrappers"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+var ErrInvalidChangeFeedChunk = errors.New("invalid change feed chunk")
+
+const (
+	changeFeedContainer = "$blobchangefeed"
+
+	// changeFeedSegmentsPrefix is the prefix of the segment manifests, which are stored as idx/segments/<yyyy>/<mm>/<dd>/<hhmm>/meta.json
+	changeFeedSegmentsPrefix = "idx/segments/"
+	changeFeedSegmentLayout  = "2006/01/02/1504"
+)
+
+// changeFeedSegment is an hour of the change feed, of which the events are stored in Avro files in one or more chunk directories
+type changeFeedSegment struct {
+	path  string
+	begin time.Time
+}
+
+// changeFeedEvent is a change to a blob or directory in the change feed
+type changeFeedEvent struct {
+	EventType string
+	// Subject is the blob or directory that changed, as /blobServices/default/containers/<container>/blobs/<path>
+	Subject   string
+	EventTime time.Time
+	Api       string
+	// DestinationUrl is the new location of a renamed blob or directory
+	DestinationUrl string
+}
+
+// changeFeed reads the change feed of a storage account from its $blobchangefeed container
+type changeFeed struct {
+	client *container.Client
+}
+
+func newChangeFeed(ctx context.Context, storageAccount string, configMap *config.ConfigMap) (*changeFeed, error) {
+	client, err := createBlobContainerClient(ctx, storageAccount, changeFeedContainer, configMap.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &changeFeed{client: client}, nil
+}
+
+// lastConsumable returns the begin of the last segment that is complete
+func (f *changeFeed) lastConsumable(ctx context.Context) (time.Time, error) {
+	var meta struct {
+		LastConsumable time.Time `json:"lastConsumable"`
+	}
+
+	err := f.readJson(ctx, "meta/segments.json", &meta)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return meta.LastConsumable, nil
+}
+
+// segments returns the segments that are still retained, from old to new
+func (f *changeFeed) segments(ctx context.Context) ([]changeFeedSegment, error) {
+	var names []string
+
+	prefix := changeFeedSegmentsPrefix
+
+	pager := f.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, blobItem := range page.Segment.BlobItems {
+			names = append(names, ptr.ToString(blobItem.Name))
+		}
+	}
+
+	return parseChangeFeedSegments(names), nil
+}
+
+// parseChangeFeedSegments returns the segments of the segment manifests among the blob names, from old to new
+func parseChangeFeedSegments(names []string) []changeFeedSegment {
+	var segments []changeFeedSegment
+
+	for _, name := range names {
+		hour, found := strings.CutPrefix(name, changeFeedSegmentsPrefix)
+		if !found {
+			continue
+		}
+
+		hour, found = strings.CutSuffix(hour, "/meta.json")
+		if !found {
+			continue
+		}
+
+		begin, err := time.Parse(changeFeedSegmentLayout, hour)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, changeFeedSegment{path: name, begin: begin})
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].begin.Before(segments[j].begin) })
+
+	return segments
+}
+
+// readSegment passes the events in the chunks of the segment to the handler, ordered by their event time.
+// The events of different chunks are interleaved, so all events of the segment are kept in memory to sort them. A segment covers an hour,
+// so the memory use is bounded by the number of changes in the storage account during an hour (a few hundred bytes per change).
+func (f *changeFeed) readSegment(ctx context.Context, segment changeFeedSegment, handler func(event changeFeedEvent) error) error {
+	var meta struct {
+		ChunkFilePaths []string `json:"chunkFilePaths"`
+	}
+
+	err := f.readJson(ctx, segment.path, &meta)
+	if err != nil {
+		return err
+	}
+
+	var events []changeFeedEvent
+
+	for _, chunkPath := range meta.ChunkFilePaths {
+		// Chunk paths include the name of the container
+		prefix := strings.TrimPrefix(strings.TrimPrefix(chunkPath, "/"), changeFeedContainer+"/")
+
+		pager := f.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, blobItem := range page.Segment.BlobItems {
+				name := ptr.ToString(blobItem.Name)
+
+				resp, err := f.client.NewBlobClient(name).DownloadStream(ctx, nil)
+				if err != nil {
+					return err
+				}
+
+				err = ParseChangeFeedChunk(resp.Body, func(event changeFeedEvent) error {
+					events = append(events, event)
+
+					return nil
+				})
+				resp.Body.Close()
+
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	// Events of different chunks of a segment are not ordered
+	sort.SliceStable(events, func(i, j int) bool { return events[i].EventTime.Before(events[j].EventTime) })
+
+	for _, event := range events {
+		err = handler(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *changeFeed) readJson(ctx context.Context, name string, target any) error {
+	resp, err := f.client.NewBlobClient(name).DownloadStream(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(target)
+	if err != nil {
+		return fmt.Errorf("parse %s/%s: %w", changeFeedContainer, name, err)
+	}
+
+	return nil
+}
+
+// ParseChangeFeedChunk parses an Avro chunk file of the change feed and passes its events to the handler
+func ParseChangeFeedChunk(r io.Reader, handler func(event changeFeedEvent) error) error {
+	reader, err := goavro.NewOCFReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidChangeFeedChunk, err.Error())
+	}
+
+	for reader.Scan() {
+		record, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidChangeFeedChunk, err.Error())
+		}
+
+		fields, ok := record.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: change feed record is not a record", ErrInvalidChangeFeedChunk)
+		}
+
+		event := changeFeedEvent{}
+		event.EventType = avroString(fields["eventType"])
+		event.Subject = avroString(fields["subject"])
+		event.EventTime, _ = time.Parse(time.RFC3339Nano, avroString(fields["eventTime"]))
+
+		if data, ok := fields["data"].(map[string]any); ok {
+			event.Api = avroString(data["api"])
+			event.DestinationUrl = avroString(data["destinationUrl"])
+		}
+
+		err = handler(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reader.Err() != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidChangeFeedChunk, reader.Err().Error())
+	}
+
+	return nil
+}
+
+// avroString returns the value of a string or enum, which may be part of a nullable union. goavro decodes a union as a map from the name of the type to the value.
+func avroString(value any) string {
+	if union, ok := value.(map[string]any); ok {
+		value = union["string"]
+	}
+
+	str, _ := value.(string)
+
+	return str
+}
+
+// changeFeedSubjectName returns the name (<container>/<path>) of the blob or directory in the subject of an event
+func changeFeedSubjectName(subject string) (string, bool) {
+	_, rest, found := strings.Cut(subject, "/containers/")
+	if !found {
+		return "", false
+	}
+
+	containerName, blobPath, found := strings.Cut(rest, "/blobs/")
+	if !found || containerName == "" || blobPath == "" {
+		return "", false
+	}
+
+	return containerName + "/" + blobPath, true
+}
+
+// changeFeedUrlName returns the name (<container>/<path>) of the blob or directory at the URL
+func changeFeedUrlName(rawUrl string) (string, bool) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", false
+	}
+
+	name := strings.Trim(parsed.Path, "/")
+
+	return name, strings.Contains(name, "/")
+}
+
+// knownObjectsStateName is the name of the state with the folders and files of a storage account that were synced before
+const knownObjectsStateName = "data-objects"
+
+// knownObjects are the folders and files of a storage account that were synced before, with the change feed segment up to which changes were applied.
+// Only changes are read from the change feed, but all data objects need to be added to the data source in every sync, as the data objects that are not added are removed from Raito.
+// That's why a full snapshot is kept, in memory and in the state file. Both grow with the number of synced folders and files (roughly their full names),
+// and removing a folder scans all known objects. For storage accounts with millions of blobs, limit the synced objects with the maximum folder depth and files per folder.
+type knownObjects struct {
+	path string
+
+	Checkpoint time.Time `json:"checkpoint"`
+	// Objects maps the full names of the folders and files to their type
+	Objects map[string]string `json:"objects"`
+}
+
+func loadKnownObjects(params map[string]string, storageAccount string) (*knownObjects, error) {
+	path, err := global.StateFilePath(params, fmt.Sprintf("%s-%s", knownObjectsStateName, strings.ReplaceAll(storageAccount, "/", "-")))
+	if err != nil {
+		return nil, err
+	}
+
+	known := &knownObjects{path: path}
+
+	err = global.LoadState(path, known)
+	if err != nil {
+		return nil, err
+	}
+
+	if known.Objects == nil {
+		known.Objects = make(map[string]string)
+		known.Checkpoint = time.Time{}
+	}
+
+	return known, nil
+}
+
+// reset clears the known objects before a full sync
+func (k *knownObjects) reset() {
+	k.Objects = make(map[string]string)
+	k.Checkpoint = time.Time{}
+}
+
+func (k *knownObjects) addDataObjects(dataObjects ...*ds.DataObject) error {
+	for _, dataObject := range dataObjects {
+		if dataObject.Type == Folder || dataObject.Type == File {
+			k.Objects[dataObject.FullName] = dataObject.Type
+		}
+	}
+
+	return nil
+}
+
+// remove removes the object and, for folders, everything in it. The removed files no longer count for the maximum number of files per folder of the tree,
+// and the removed folders are added again by the tree when something is created in them later on.
+func (k *knownObjects) remove(tree *inventoryTree, fullName string) {
+	doType, found := k.Objects[fullName]
+	if found {
+		k.forget(tree, fullName, doType)
+	}
+
+	if found && doType == File {
+		return
+	}
+
+	prefix := fullName + "/"
+
+	for name, doType := range k.Objects {
+		if strings.HasPrefix(name, prefix) {
+			k.forget(tree, name, doType)
+		}
+	}
+
+	delete(tree.folders, fullName)
+
+	for name := range tree.folders {
+		if strings.HasPrefix(name, prefix) {
+			delete(tree.folders, name)
+		}
+	}
+}
+
+func (k *knownObjects) forget(tree *inventoryTree, fullName string, doType string) {
+	delete(k.Objects, fullName)
+
+	if doType == File {
+		parent := fullName[:strings.LastIndex(fullName, "/")]
+
+		tree.files[parent]--
+		if tree.files[parent] <= 0 {
+			delete(tree.files, parent)
+		}
+	}
+}
+
+// seed adds the known objects to the tree, so folders that were synced before are not added again and files that were synced before count for the maximum number of files per folder
+func (k *knownObjects) seed(tree *inventoryTree) {
+	for fullName, doType := range k.Objects {
+		if doType == Folder {
+			tree.folders[fullName] = true
+		} else {
+			tree.files[fullName[:strings.LastIndex(fullName, "/")]]++
+		}
+	}
+}
+
+// create adds a created object through the tree. Files that are known already (e.g. overwritten blobs) are skipped, so they are not counted twice for the maximum number of files per folder.
+func (k *knownObjects) create(tree *inventoryTree, name string, isFolder bool) error {
+	if !isFolder && k.Objects[fmt.Sprintf("%s/%s", tree.storageAccount, name)] == File {
+		return nil
+	}
+
+	return tree.add(name, isFolder)
+}
+
+// apply applies a change to the known objects. Created objects are added through the tree, so the folder depth and file settings are respected.
+func (k *knownObjects) apply(tree *inventoryTree, event changeFeedEvent) error {
+	name, found := changeFeedSubjectName(event.Subject)
+	if !found {
+		return nil
+	}
+
+	isFolder := strings.HasPrefix(event.EventType, "Directory") || strings.HasSuffix(event.Api, "Directory")
+	fullName := fmt.Sprintf("%s/%s", tree.storageAccount, name)
+
+	switch event.EventType {
+	case "BlobCreated", "DirectoryCreated":
+		return k.create(tree, name, isFolder)
+	case "BlobDeleted", "DirectoryDeleted":
+		k.remove(tree, fullName)
+	case "BlobRenamed", "DirectoryRenamed":
+		destination, found := changeFeedUrlName(event.DestinationUrl)
+		if !found {
+			k.remove(tree, fullName)
+
+			return nil
+		}
+
+		// The content of a renamed directory moves along with it
+		moved := map[string]string{name: Folder}
+		if !isFolder {
+			moved[name] = File
+		}
+
+		for objectName, doType := range k.Objects {
+			if relative, found := strings.CutPrefix(objectName, fullName+"/"); found {
+				moved[name+"/"+relative] = doType
+			}
+		}
+
+		k.remove(tree, fullName)
+
+		for movedName, doType := range moved {
+			err := k.create(tree, destination+strings.TrimPrefix(movedName, name), doType == Folder)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// emit adds the known objects in the synced containers to the data source, parents before their children
+func (k *knownObjects) emit(storageAccount string, containers map[string]bool, addDataObjects func(dataObjects ...*ds.DataObject) error) error {
+	names := make([]string, 0, len(k.Objects))
+	for name := range k.Objects {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, fullName := range names {
+		path, found := strings.CutPrefix(fullName, storageAccount+"/")
+		containerName, _, _ := strings.Cut(path, "/")
+
+		if !found || !containers[containerName] {
+			continue
+		}
+
+		parent := fullName[:strings.LastIndex(fullName, "/")]
+
+		err := addDataObjects(&ds.DataObject{
+			ExternalId:       fullName,
+			Name:             fullName[len(parent)+1:],
+			FullName:         fullName,
+			Type:             k.Objects[fullName],
+			ParentExternalId: parent,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (k *knownObjects) save() error {
+	return global.SaveState(k.path, k)
+}
+
+// knownObjectsHandler records the folders and files that are added during a full sync, so the next sync can apply the changes in the change feed to them
+type knownObjectsHandler struct {
+	wrappers.DataSourceObjectHandler
+	known *knownObjects
+}
+
+func (h *knownObjectsHandler) AddDataObjects(dataObjects ...*ds.DataObject) error {
+	_ = h.known.addDataObjects(dataObjects...)
+
+	return h.DataSourceObjectHandler.AddDataObjects(dataObjects...)
+}
+
+// openChangeFeed returns the change feed of the storage account, the begin of its last complete segment and the known objects of the previous sync.
+// It returns a nil change feed if the change feed is not enabled on the storage account.
+func openChangeFeed(ctx context.Context, accountName string, storageAccount string, configMap *config.ConfigMap) (*changeFeed, time.Time, *knownObjects, error) {
+	feed, err := newChangeFeed(ctx, accountName, configMap)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+
+	lastConsumable, err := feed.lastConsumable(ctx)
+	if isChangeFeedDisabled(err) {
+		logger.Info(fmt.Sprintf("The change feed is not enabled on storage account %s, doing a full sync", accountName))
+
+		return nil, time.Time{}, nil, nil
+	} else if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+
+	known, err := loadKnownObjects(configMap.Parameters, storageAccount)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+
+	return feed, lastConsumable, known, nil
+}
+
+// retains returns true if the change feed still contains all segments since the checkpoint of the previous sync, so its changes can be applied.
+// Otherwise, a full sync is needed.
+func (f *changeFeed) retains(ctx context.Context, checkpoint time.Time) ([]changeFeedSegment, bool, error) {
+	if checkpoint.IsZero() {
+		return nil, false, nil
+	}
+
+	segments, err := f.segments(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(segments) == 0 || segments[0].begin.After(checkpoint) {
+		return nil, false, nil
+	}
+
+	return segments, true, nil
+}
+
+// applyChanges applies the changes in the segments after the checkpoint of the known objects, up to lastConsumable
+func (f *changeFeed) applyChanges(ctx context.Context, segments []changeFeedSegment, lastConsumable time.Time, known *knownObjects, tree *inventoryTree) error {
+	for _, segment := range segments {
+		if !segment.begin.After(known.Checkpoint) || segment.begin.After(lastConsumable) {
+			continue
+		}
+
+		err := f.readSegment(ctx, segment, func(event changeFeedEvent) error {
+			return known.apply(tree, event)
+		})
+		if err != nil {
+			return fmt.Errorf("read change feed segment %s: %w", segment.path, err)
+		}
+	}
+
+	return nil
+}
+
+// isChangeFeedDisabled returns true if the error indicates that the change feed is not enabled on the storage account
+func isChangeFeedDisabled(err error) bool {
+	return bloberror.HasCode(err, bloberror.ContainerNotFound, bloberror.BlobNotFound)
+}
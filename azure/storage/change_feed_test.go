@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+func readTestChangeFeedChunk(t *testing.T, name string) []changeFeedEvent {
+	t.Helper()
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var events []changeFeedEvent
+
+	err = ParseChangeFeedChunk(f, func(event changeFeedEvent) error {
+		events = append(events, event)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	return events
+}
+
+func TestParseChangeFeedChunk(t *testing.T) {
+	for _, name := range []string{"testdata/changefeed/00000.avro", "testdata/changefeed/00001.avro"} {
+		t.Run(name, func(t *testing.T) {
+			events := readTestChangeFeedChunk(t, name)
+
+			require.Len(t, events, 5)
+			assert.Equal(t, changeFeedEvent{
+				EventType: "DirectoryCreated",
+				Subject:   "/blobServices/default/containers/data/blobs/raw/2024",
+				EventTime: time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC),
+				Api:       "CreateDirectory",
+			}, events[0])
+			assert.Equal(t, "BlobDeleted", events[2].EventType)
+			assert.Equal(t, "https://account.dfs.core.windows.net/data/published", events[3].DestinationUrl)
+		})
+	}
+}
+
+func TestParseChangeFeedChunk_Invalid(t *testing.T) {
+	raw, err := os.ReadFile("testdata/changefeed/00000.avro")
+	require.NoError(t, err)
+
+	tests := map[string][]byte{
+		"Not an Avro file": []byte("Name,Last-Modified\n"),
+		"Truncated":        raw[:len(raw)-20],
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ParseChangeFeedChunk(bytes.NewReader(data), func(changeFeedEvent) error { return nil })
+			assert.ErrorIs(t, err, ErrInvalidChangeFeedChunk)
+		})
+	}
+}
+
+func TestParseChangeFeedSegments(t *testing.T) {
+	segments := parseChangeFeedSegments([]string{
+		"idx/segments/2024/01/01/1100/meta.json",
+		"idx/segments/1601/01/01/0000/meta.json",
+		"idx/segments/2024/01/01/1000/meta.json",
+		"idx/segments/2024/01/01/1000/other.json",
+		"meta/segments.json",
+	})
+
+	assert.Equal(t, []changeFeedSegment{
+		{path: "idx/segments/1601/01/01/0000/meta.json", begin: time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{path: "idx/segments/2024/01/01/1000/meta.json", begin: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{path: "idx/segments/2024/01/01/1100/meta.json", begin: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+	}, segments)
+}
+
+func TestKnownObjects_Apply(t *testing.T) {
+	configMap := &config.ConfigMap{Parameters: map[string]string{global.AzSubscriptionId: "sub", global.AzStateDirectory: t.TempDir()}}
+	checkpoint := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	known, err := loadKnownObjects(configMap.Parameters, "sub/rg/account")
+	require.NoError(t, err)
+	assert.True(t, known.Checkpoint.IsZero())
+
+	// The result of the previous full sync
+	known.Checkpoint = checkpoint
+	known.Objects = map[string]string{
+		"sub/rg/account/data/raw":                Folder,
+		"sub/rg/account/data/raw/2024":           Folder,
+		"sub/rg/account/data/raw/2024/01.csv":    File,
+		"sub/rg/account/data/curated":            Folder,
+		"sub/rg/account/data/curated/sales":      Folder,
+		"sub/rg/account/data/curated/sales/x.pq": File,
+		"sub/rg/account/data/README.md":          File,
+		"sub/rg/account/other/file.txt":          File,
+	}
+	require.NoError(t, known.save())
+
+	known, err = loadKnownObjects(configMap.Parameters, "sub/rg/account")
+	require.NoError(t, err)
+	assert.True(t, checkpoint.Equal(known.Checkpoint))
+
+	tree := newInventoryTree("sub/rg/account", map[string]bool{"data": true}, configMap, func(string) bool { return true }, known.addDataObjects)
+	known.seed(tree)
+
+	for _, event := range readTestChangeFeedChunk(t, "testdata/changefeed/00000.avro") {
+		require.NoError(t, known.apply(tree, event))
+	}
+
+	var emitted []string
+
+	err = known.emit("sub/rg/account", map[string]bool{"data": true}, func(dataObjects ...*ds.DataObject) error {
+		for _, do := range dataObjects {
+			emitted = append(emitted, do.Type+" "+do.FullName+" ("+do.ParentExternalId+")")
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"file sub/rg/account/data/README.md (sub/rg/account/data)",
+		"folder sub/rg/account/data/published (sub/rg/account/data)",
+		"folder sub/rg/account/data/published/sales (sub/rg/account/data/published)",
+		"file sub/rg/account/data/published/sales/x.pq (sub/rg/account/data/published/sales)",
+		"folder sub/rg/account/data/raw (sub/rg/account/data)",
+		"folder sub/rg/account/data/raw/2024 (sub/rg/account/data/raw)",
+		"file sub/rg/account/data/raw/2024/03.csv (sub/rg/account/data/raw/2024)",
+	}, emitted)
+}
+
+func TestKnownObjects_Remove(t *testing.T) {
+	known := &knownObjects{Objects: map[string]string{
+		"sa/data/raw":             Folder,
+		"sa/data/raw/2024":        Folder,
+		"sa/data/raw/2024/01.csv": File,
+		"sa/data/raw/2024/02.csv": File,
+		"sa/data/raw/README.md":   File,
+		"sa/data/rawdata":         Folder,
+		"sa/data/rawdata/x.csv":   File,
+	}}
+
+	tree := newInventoryTree("sa", map[string]bool{"data": true}, &config.ConfigMap{Parameters: map[string]string{global.AzDataSourceMaxFilesPerFolder: "2"}}, func(string) bool { return true }, known.addDataObjects)
+	tree.folders = map[string]bool{"sa/data/raw": true, "sa/data/raw/2024": true, "sa/data/rawdata": true}
+	tree.files = map[string]int{"sa/data/raw/2024": 2, "sa/data/raw": 1, "sa/data/rawdata": 1}
+
+	known.remove(tree, "sa/data/raw/2024/01.csv")
+
+	assert.Equal(t, map[string]int{"sa/data/raw/2024": 1, "sa/data/raw": 1, "sa/data/rawdata": 1}, tree.files)
+	assert.Len(t, tree.folders, 3)
+
+	// A file can be added again, as the deleted file no longer counts for the maximum number of files per folder
+	require.NoError(t, tree.add("data/raw/2024/03.csv", false))
+	assert.Contains(t, known.Objects, "sa/data/raw/2024/03.csv")
+
+	known.remove(tree, "sa/data/raw")
+
+	assert.Equal(t, map[string]string{"sa/data/rawdata": Folder, "sa/data/rawdata/x.csv": File}, known.Objects)
+	assert.Equal(t, map[string]int{"sa/data/rawdata": 1}, tree.files)
+	assert.Equal(t, map[string]bool{"sa/data/rawdata": true}, tree.folders)
+
+	// The removed folder is added again when something is created in it
+	require.NoError(t, tree.add("data/raw/new.csv", false))
+	assert.Contains(t, known.Objects, "sa/data/raw")
+	assert.Contains(t, known.Objects, "sa/data/raw/new.csv")
+}
+
+func TestKnownObjects_Create(t *testing.T) {
+	known := &knownObjects{Objects: map[string]string{
+		"sa/data/raw":       Folder,
+		"sa/data/raw/a.csv": File,
+	}}
+
+	var added []string
+
+	tree := newInventoryTree("sa", map[string]bool{"data": true}, &config.ConfigMap{Parameters: map[string]string{global.AzDataSourceMaxFilesPerFolder: "2"}}, func(string) bool { return true }, func(dataObjects ...*ds.DataObject) error {
+		for _, do := range dataObjects {
+			added = append(added, do.FullName)
+		}
+
+		return known.addDataObjects(dataObjects...)
+	})
+	known.seed(tree)
+
+	assert.Equal(t, map[string]bool{"sa/data/raw": true}, tree.folders)
+	assert.Equal(t, map[string]int{"sa/data/raw": 1}, tree.files)
+
+	created := func(name string) changeFeedEvent {
+		return changeFeedEvent{EventType: "BlobCreated", Subject: "/blobServices/default/containers/data/blobs/" + name}
+	}
+
+	// Overwriting a known file doesn't count it again, so there is still room for a second file in the folder
+	require.NoError(t, known.apply(tree, created("raw/a.csv")))
+	require.NoError(t, known.apply(tree, created("raw/a.csv")))
+	require.NoError(t, known.apply(tree, created("raw/b.csv")))
+	require.NoError(t, known.apply(tree, created("raw/c.csv")))
+
+	// The known folder is not added again
+	assert.Equal(t, []string{"sa/data/raw/b.csv"}, added)
+	assert.Equal(t, map[string]int{"sa/data/raw": 2}, tree.files)
+}
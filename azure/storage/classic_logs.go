@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+)
+
+const classicLogsContainer = "$logs"
+
+// Field positions in the semicolon-delimited Storage Analytics log format (version 1.0 and 2.0)
+const (
+	classicFieldVersion            = 0
+	classicFieldRequestStartTime   = 1
+	classicFieldOperationType      = 2
+	classicFieldRequestStatus      = 3
+	classicFieldHttpStatusCode     = 4
+	classicFieldEndToEndLatency    = 5
+	classicFieldServerLatency      = 6
+	classicFieldAuthenticationType = 7
+	classicFieldServiceType        = 10
+	classicFieldObjectKey          = 12
+	classicFieldRequestId          = 13
+	classicFieldRequesterIp        = 15
+	classicFieldResponsePacketSize = 20
+	classicFieldRequestLength      = 21
+	classicFieldUserAgent          = 27
+	classicFieldUserObjectId       = 30 // Only available in version 2.0
+	classicFieldTenantId           = 31 // Only available in version 2.0
+	classicFieldApplicationId      = 32 // Only available in version 2.0
+)
+
+// classicAuthenticationTypes maps the authentication types of Storage Analytics logs on the ones used in the diagnostic logs
+var classicAuthenticationTypes = map[string]string{
+	"oauth":         "OAuth",
+	"sas":           "SAS",
+	"authenticated": "AccountKey",
+	"anonymous":     "Anonymous",
+}
+
+// syncClassicUsage reads the classic Storage Analytics logs of a storage account from its $logs container.
+// This is used for storage accounts that don't have a diagnostic setting.
+func syncClassicUsage(ctx context.Context, resourceGroup, storageAccount string, checkpoint *usageCheckpoint, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
+	startDate := checkpoint.start(resourceGroup, storageAccount)
+
+	client, err := createBlobContainerClient(ctx, storageAccount, classicLogsContainer, configParams.Parameters)
+	if err != nil {
+		return err
+	}
+
+	// Log files are stored as blob/<year>/<month>/<day>/<hour><minute>/<counter>.log, only the days since the start date are listed
+	for _, prefix := range classicLogDayPrefixes(startDate, time.Now()) {
+		pager := client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+
+		for pager.More() {
+			page, err2 := pager.NextPage(ctx)
+			if err2 != nil {
+				if bloberror.HasCode(err2, bloberror.ContainerNotFound) {
+					logger.Debug(fmt.Sprintf("No diagnostic setting or classic logs found for storage account %s", storageAccount))
+
+					return nil
+				}
+
+				return err2
+			}
+
+			for _, blobItem := range page.Segment.BlobItems {
+				name := ptr.ToString(blobItem.Name)
+
+				if hour, ok := parseClassicLogBlobHour(name); ok && hour.Add(time.Hour).Before(startDate) {
+					continue
+				}
+
+				resp, err2 := client.NewBlobClient(name).DownloadStream(ctx, nil)
+				if err2 != nil {
+					return err2
+				}
+
+				err2 = ParseClassicLogs(resp.Body, startDate, func(entry monitor.LogEntry) error {
+					if !matchesUsageFilter(entry) {
+						return nil
+					}
+
+					return commitLogEntry(ctx, configParams, checkpoint, resourceGroup, storageAccount, entry, commit)
+				})
+				resp.Body.Close()
+
+				if err2 != nil {
+					return fmt.Errorf("parsing %s/%s: %w", classicLogsContainer, name, err2)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// classicLogDayPrefixes returns the blob prefixes of the log files for every day from the start date until now (UTC), e.g. blob/2024/01/31/
+func classicLogDayPrefixes(startDate time.Time, now time.Time) []string {
+	var result []string
+
+	day := startDate.UTC().Truncate(24 * time.Hour)
+
+	for !day.After(now.UTC()) {
+		result = append(result, fmt.Sprintf("blob/%04d/%02d/%02d/", day.Year(), day.Month(), day.Day()))
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return result
+}
+
+// ParseClassicLogs parses a Storage Analytics log file and passes every blob entry since startDate to the handler.
+func ParseClassicLogs(r io.Reader, startDate time.Time, handler func(entry monitor.LogEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields, err := splitClassicLogLine(line)
+		if err != nil {
+			return err
+		}
+
+		if len(fields) <= classicFieldUserAgent {
+			return fmt.Errorf("unexpected number of fields (%d) in log entry of version %q", len(fields), fields[classicFieldVersion])
+		}
+
+		if fields[classicFieldServiceType] != "blob" {
+			continue
+		}
+
+		requestTime, err := time.Parse(time.RFC3339Nano, fields[classicFieldRequestStartTime])
+		if err != nil {
+			return err
+		}
+
+		if requestTime.Before(startDate) {
+			continue
+		}
+
+		statusCode, err := strconv.Atoi(fields[classicFieldHttpStatusCode])
+		if err != nil {
+			return fmt.Errorf("invalid HTTP status code %q: %w", fields[classicFieldHttpStatusCode], err)
+		}
+
+		entry := monitor.LogEntry{
+			TimeGenerated:      requestTime,
+			OperationName:      fields[classicFieldOperationType],
+			ObjectKey:          fields[classicFieldObjectKey],
+			AuthenticationType: classicAuthenticationTypes[fields[classicFieldAuthenticationType]],
+			CorrelationId:      fields[classicFieldRequestId],
+			MetricResponseType: monitor.ResponseTypeFromStatusCode(statusCode),
+			StatusCode:         fields[classicFieldHttpStatusCode],
+			StatusText:         fields[classicFieldRequestStatus],
+			CallerIpAddress:    fields[classicFieldRequesterIp],
+			UserAgentHeader:    fields[classicFieldUserAgent],
+			RequestBodySize:    parseClassicLogNumber(fields[classicFieldRequestLength]),
+			ResponseBodySize:   parseClassicLogNumber(fields[classicFieldResponsePacketSize]),
+			DurationMs:         parseClassicLogNumber(fields[classicFieldEndToEndLatency]),
+			ServerLatencyMs:    parseClassicLogNumber(fields[classicFieldServerLatency]),
+		}
+
+		if len(fields) > classicFieldApplicationId {
+			entry.RequesterObjectId = fields[classicFieldUserObjectId]
+			entry.RequesterTenantId = fields[classicFieldTenantId]
+			entry.RequesterAppId = fields[classicFieldApplicationId]
+		}
+
+		err = handler(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseClassicLogNumber parses a numeric field. Fields that are empty or invalid, e.g. because they don't apply to the request, are reported as 0.
+func parseClassicLogNumber(field string) int64 {
+	value, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+// splitClassicLogLine splits a log line on semicolons. Fields can be quoted, in which case quotes are escaped by doubling them.
+func splitClassicLogLine(line string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+
+	quoted := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quoted && c == '"':
+			if i+1 < len(line) && line[i+1] == '"' {
+				current.WriteByte('"')
+				i++
+			} else {
+				quoted = false
+			}
+		case quoted:
+			current.WriteByte(c)
+		case c == '"':
+			quoted = true
+		case c == ';':
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	if quoted {
+		return nil, errors.New("unterminated quoted field in log entry")
+	}
+
+	return append(fields, current.String()), nil
+}
+
+// parseClassicLogBlobHour returns the hour of which a log file contains the logs, based on its name.
+func parseClassicLogBlobHour(name string) (time.Time, bool) {
+	parts := strings.Split(name, "/")
+	if len(parts) < 5 {
+		return time.Time{}, false
+	}
+
+	hour, err := time.Parse("2006/01/02/15", strings.Join(parts[1:4], "/")+"/"+parts[4][:min(2, len(parts[4]))])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return hour, true
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+)
+
+func TestParseClassicLogs(t *testing.T) {
+	f, err := os.Open("testdata/classic_000000.log")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var entries []monitor.LogEntry
+
+	err = ParseClassicLogs(f, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), func(entry monitor.LogEntry) error {
+		entries = append(entries, entry)
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []monitor.LogEntry{
+		{
+			TimeGenerated:      time.Date(2024, 3, 1, 10, 15, 2, 123456700, time.UTC),
+			OperationName:      "GetBlob",
+			ObjectKey:          "/raitodata/sales/2024/orders.csv",
+			RequesterObjectId:  "22222222-2222-2222-2222-222222222222",
+			RequesterAppId:     "11111111-1111-1111-1111-111111111111",
+			RequesterTenantId:  "33333333-3333-3333-3333-333333333333",
+			AuthenticationType: "OAuth",
+			CorrelationId:      "b2a5c1e0-001e-0066-2f1a-6b1c2d000000",
+			MetricResponseType: "Success",
+			StatusCode:         "200",
+			StatusText:         "Success",
+			CallerIpAddress:    "10.0.0.4:51234",
+			UserAgentHeader:    "azsdk-go-azblob/v1.6.0 (go1.24; linux)",
+			ResponseBodySize:   1024,
+			DurationMs:         12,
+			ServerLatencyMs:    10,
+		},
+		{
+			TimeGenerated:      time.Date(2024, 3, 1, 10, 16, 45, 0, time.UTC),
+			OperationName:      "PutBlob",
+			ObjectKey:          "/raitodata/sales/2024/new;file.csv",
+			AuthenticationType: "SAS",
+			CorrelationId:      "b2a5c1e0-001e-0066-2f1a-6b1c2d000001",
+			MetricResponseType: "Success",
+			StatusCode:         "201",
+			StatusText:         "Success",
+			CallerIpAddress:    "10.0.0.5:51235",
+			UserAgentHeader:    "Microsoft Azure Storage Explorer, 1.33.0",
+			RequestBodySize:    2048,
+			DurationMs:         20,
+			ServerLatencyMs:    18,
+		},
+		{
+			TimeGenerated:      time.Date(2024, 3, 1, 10, 17, 0, 0, time.UTC),
+			OperationName:      "GetBlob",
+			ObjectKey:          "/raitodata/sales/2024/orders.csv",
+			AuthenticationType: "Anonymous",
+			CorrelationId:      "b2a5c1e0-001e-0066-2f1a-6b1c2d000002",
+			MetricResponseType: "AuthorizationError",
+			StatusCode:         "403",
+			StatusText:         "AuthorizationFailure",
+			CallerIpAddress:    "10.0.0.6:51236",
+			UserAgentHeader:    "curl/8.0",
+			DurationMs:         3,
+			ServerLatencyMs:    3,
+		},
+	}, entries)
+}
+
+func TestSplitClassicLogLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{line: `a;b;c`, want: []string{"a", "b", "c"}},
+		{line: `a;;c;`, want: []string{"a", "", "c", ""}},
+		{line: `"a;b";"c ""d""";e`, want: []string{"a;b", `c "d"`, "e"}},
+		{line: `"a;b`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := splitClassicLogLine(tt.line)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseClassicLogBlobHour(t *testing.T) {
+	hour, ok := parseClassicLogBlobHour("blob/2024/03/01/1000/000000.log")
+
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), hour)
+
+	_, ok = parseClassicLogBlobHour("blob/2024/03/000000.log")
+	assert.False(t, ok)
+}
+
+func TestClassicLogDayPrefixes(t *testing.T) {
+	startDate := time.Date(2024, 2, 28, 23, 30, 0, 0, time.UTC)
+	now := time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{"blob/2024/02/28/", "blob/2024/02/29/", "blob/2024/03/01/"}, classicLogDayPrefixes(startDate, now))
+	assert.Empty(t, classicLogDayPrefixes(now.Add(48*time.Hour), now))
+}
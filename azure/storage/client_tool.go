@@ -0,0 +1,37 @@
+package storage
+
+import "strings"
+
+// clientTools are the tools that are recognized in the user agent of a request, in order of precedence.
+// Tools that embed an SDK (e.g. Databricks using the Hadoop ABFS driver) come before the SDK itself.
+var clientTools = []struct {
+	name     string
+	patterns []string
+}{
+	{name: "Databricks", patterns: []string{"databricks"}},
+	{name: "Synapse", patterns: []string{"synapse"}},
+	{name: "Data Factory", patterns: []string{"azuredatafactory", "datafactory", "datatransfer"}},
+	{name: "Power BI", patterns: []string{"powerbi", "microsoft.data.mashup"}},
+	{name: "AzCopy", patterns: []string{"azcopy"}},
+	{name: "Storage Explorer", patterns: []string{"storage explorer", "storageexplorer"}},
+	{name: "Azure CLI", patterns: []string{"azurecli", "azure-cli"}},
+	{name: "Azure PowerShell", patterns: []string{"azurepowershell", "az.storage"}},
+	{name: "Hadoop ABFS", patterns: []string{"azure blob fs", "hadoop"}},
+	{name: "Browser", patterns: []string{"mozilla"}},
+	{name: "Azure SDK", patterns: []string{"azsdk-", "azure-storage"}},
+}
+
+// detectClientTool returns the name of the tool that sent a request, based on its user agent. It returns an empty string for unknown tools.
+func detectClientTool(userAgent string) string {
+	userAgent = strings.ToLower(userAgent)
+
+	for _, tool := range clientTools {
+		for _, pattern := range tool.patterns {
+			if strings.Contains(userAgent, pattern) {
+				return tool.name
+			}
+		}
+	}
+
+	return ""
+}
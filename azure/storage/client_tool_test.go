@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+)
+
+func TestDetectClientTool(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{userAgent: "Azure Blob FS/3.3.4 (JavaJRE 1.8.0_372; Linux 5.15.0-1045-azure/amd64; SunJSSE-1.8; UNKNOWN/UNKNOWN) Databricks", want: "Databricks"},
+		{userAgent: "Azure Blob FS/3.3.1 (JavaJRE 1.8.0_282; Linux) Synapse", want: "Synapse"},
+		{userAgent: "AzureDataFactoryCopy FxVersion/4.8.4645.0 OSName/Windows", want: "Data Factory"},
+		{userAgent: "AzCopy/10.22.0 azsdk-go-azblob/v1.2.0 (go1.21.3; linux)", want: "AzCopy"},
+		{userAgent: "Microsoft Azure Storage Explorer, 1.33.0, win, Azure-Storage-JavaScript/12.17.0", want: "Storage Explorer"},
+		{userAgent: "AZURECLI/2.58.0 (DEB) azsdk-python-storage-blob/12.19.0 Python/3.11.5 (Linux)", want: "Azure CLI"},
+		{userAgent: "AzurePowershell/v11.3.0 PSVersion/v7.4.1 Az.Storage/6.1.1", want: "Azure PowerShell"},
+		{userAgent: "Azure Blob FS/3.3.4 (JavaJRE 11.0.20; Linux)", want: "Hadoop ABFS"},
+		{userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0", want: "Browser"},
+		{userAgent: "azsdk-go-azblob/v1.6.0 (go1.24; linux)", want: "Azure SDK"},
+		{userAgent: "curl/8.0", want: ""},
+		{userAgent: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.userAgent, func(t *testing.T) {
+			assert.Equal(t, tt.want, detectClientTool(tt.userAgent))
+		})
+	}
+}
+
+func TestRequestDetails(t *testing.T) {
+	entry := monitor.LogEntry{
+		CallerIpAddress:  "10.0.0.4:51234",
+		UserAgentHeader:  "AzCopy/10.22.0",
+		RequestBodySize:  10,
+		ResponseBodySize: 2048,
+		DurationMs:       12,
+		ServerLatencyMs:  10,
+	}
+
+	assert.Equal(t, "Client: AzCopy; Caller IP: 10.0.0.4:51234; User agent: AzCopy/10.22.0; Duration: 12 ms (server: 10 ms)", requestDetails(entry))
+	assert.Equal(t, int64(2048), transferredBytes(data_usage.Read, entry))
+	assert.Equal(t, int64(10), transferredBytes(data_usage.Write, entry))
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -25,7 +26,7 @@ import (
 type DataAccessSyncer struct {
 }
 
-func (a *DataAccessSyncer) SyncAccessProvidersFromTarget(_ context.Context, raitoManagedBindings []global.IAMRoleAssignment, iamRoleAssignments []global.IAMRoleAssignment, accessProviderHandler wrappers.AccessProviderHandler, configMap *config.ConfigMap) error {
+func (a *DataAccessSyncer) SyncAccessProvidersFromTarget(ctx context.Context, raitoManagedBindings []global.IAMRoleAssignment, iamRoleAssignments []global.IAMRoleAssignment, accessProviderHandler wrappers.AccessProviderHandler, configMap *config.ConfigMap) error {
 	apMap := make(map[string]*sync_from_target.AccessProvider)
 
 	for _, assignment := range iamRoleAssignments {
@@ -122,6 +123,16 @@ func (a *DataAccessSyncer) SyncAccessProvidersFromTarget(_ context.Context, rait
 		}
 	}
 
+	if configMap.GetBoolWithDefault(global.AzAclImportFiles, false) {
+		// The access sync has no partial sync settings, so all data objects within the limits of the data source sync are visited
+		err := importFileACLs(ctx, &data_source.DataSourceSyncConfig{ConfigMap: configMap}, func(ap *sync_from_target.AccessProvider) error {
+			return accessProviderHandler.AddAccessProviders(ap)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -136,8 +147,11 @@ func (a *DataAccessSyncer) SyncAccessProvidersToTarget(ctx context.Context, acce
 	roleBindingApMap := map[global.IAMRoleAssignment][]string{}
 
 	aclAssignments := make(ACLAssignmentsWithAP)
+	apGroups := make(map[string][]string, len(accessProviders))
 
 	for _, ap := range accessProviders {
+		apGroups[ap.Id] = ap.Who.Groups
+
 		apBindingsToAdd, apBindingsToRemove, apAclAssignemnts, err2 := convertAccessProviderToIamRoleAssignments(ctx, ap, iamClient, configMap.Parameters)
 		if err2 != nil {
 			feedbackHandler.Error(err2.Error(), ap.Id)
@@ -174,7 +188,7 @@ func (a *DataAccessSyncer) SyncAccessProvidersToTarget(ctx context.Context, acce
 		}
 	}
 
-	err = setACLs(ctx, aclAssignments, feedbackHandler, configMap.Parameters)
+	err = setACLs(ctx, aclAssignments, apGroups, feedbackHandler, configMap)
 	if err != nil {
 		return err
 	}
@@ -226,6 +240,7 @@ func convertAccessProviderToIamRoleAssignments(ctx context.Context, accessProvid
 
 		for _, what := range whatList {
 			scope := ""
+			permissions := what.Permissions
 			fullNameParts := strings.Split(what.DataObject.FullName, "/")
 
 			switch what.DataObject.Type {
@@ -248,24 +263,52 @@ func convertAccessProviderToIamRoleAssignments(ctx context.Context, accessProvid
 					break
 				}
 				scope = fmt.Sprintf("/subscriptions/%s/resourcegroups/%s/providers/Microsoft.Storage/storageAccounts/%s/blobServices/default/containers/%s", fullNameParts[0], fullNameParts[1], fullNameParts[2], fullNameParts[3])
-			case "folder":
+
+				// ACL permissions on a container are applied on the root directory of the filesystem, the other permissions are IAM roles on the container
+				var aclPermissions []string
+				aclPermissions, permissions = splitACLPermissions(permissions)
+
+				if len(aclPermissions) > 0 {
+					if aclAssignees == nil {
+						aclAssignees, removedAclAssignees = generateACLAssignees(userPrincipalIds, groupPrincipalIds, deletedUserPrincipalIds, deletedGroupPrincipalIds)
+					}
+
+					assignments, err := convertToACLAssignment(fullNameParts[:4], ACLItemDirectory, aclPermissions, i == 1 || accessProvider.Delete, aclAssignees, removedAclAssignees)
+					if err != nil {
+						return nil, nil, nil, err
+					}
+
+					aclAssignments.AddAssignments(assignments)
+				}
+			case "folder", "file":
 				if aclAssignees == nil {
 					aclAssignees, removedAclAssignees = generateACLAssignees(userPrincipalIds, groupPrincipalIds, deletedUserPrincipalIds, deletedGroupPrincipalIds)
 				}
 
-				assignments, err := convertToACLAssignment(fullNameParts, what.Permissions, i == 1 || accessProvider.Delete, aclAssignees, removedAclAssignees)
+				itemType := ACLItemDirectory
+				if what.DataObject.Type == File {
+					itemType = ACLItemFile
+				}
+
+				deleted := i == 1 || accessProvider.Delete
+
+				assignments, err := convertToACLAssignment(fullNameParts, itemType, what.Permissions, deleted, aclAssignees, removedAclAssignees)
 				if err != nil {
 					return nil, nil, nil, err
 				}
 
 				aclAssignments.AddAssignments(assignments)
+
+				if itemType == ACLItemFile && !deleted {
+					aclAssignments.AddAssignments(convertToTraversalAssignments(fullNameParts, aclAssignees))
+				}
 			}
 
 			if scope == "" {
 				continue
 			}
 
-			for _, permission := range what.Permissions {
+			for _, permission := range permissions {
 				if !dsSync.IsApplicablePermission(context.Background(), what.DataObject.Type, permission) {
 					continue
 				}
@@ -312,6 +355,21 @@ func convertAccessProviderToIamRoleAssignments(ctx context.Context, accessProvid
 	return bindings[0], bindings[1], aclAssignments, nil
 }
 
+// splitACLPermissions splits the permissions in POSIX ACL permissions and other (IAM) permissions
+func splitACLPermissions(permissions []string) ([]string, []string) {
+	var aclPermissions, otherPermissions []string
+
+	for _, permission := range permissions {
+		if _, err := ACLPermissionString(permission); err == nil {
+			aclPermissions = append(aclPermissions, permission)
+		} else {
+			otherPermissions = append(otherPermissions, permission)
+		}
+	}
+
+	return aclPermissions, otherPermissions
+}
+
 func generateACLAssignees(userPrincipalIds, groupPrincipalIds, deletedUserPrincipalIds, deletedGroupPrincipalIds []string) ([]ACLAssignee, []ACLAssignee) {
 	assignees := make([]ACLAssignee, 0, len(userPrincipalIds)+len(groupPrincipalIds))
 
@@ -335,11 +393,12 @@ func generateACLAssignees(userPrincipalIds, groupPrincipalIds, deletedUserPrinci
 	return assignees, removedAssignees
 }
 
-func convertToACLAssignment(fullNameParts []string, permissions []string, deleted bool, assignees []ACLAssignee, removedAssignees []ACLAssignee) (ACLAssignments, error) {
+func convertToACLAssignment(fullNameParts []string, itemType ACLItemType, permissions []string, deleted bool, assignees []ACLAssignee, removedAssignees []ACLAssignee) (ACLAssignments, error) {
 	item := ACLAssignedItem{
 		StorageAccount: fullNameParts[2],
 		Container:      fullNameParts[3],
 		Path:           strings.Join(fullNameParts[4:], "/"),
+		Type:           itemType,
 	}
 
 	permissionSet := ACLPermissionSet(0)
@@ -385,13 +444,46 @@ func convertToACLAssignment(fullNameParts []string, permissions []string, delete
 	return result, nil
 }
 
-func setACLs(ctx context.Context, acls ACLAssignmentsWithAP, feedbackHandler global.AccessProviderFeedbackHandler, params map[string]string) error {
+// convertToTraversalAssignments returns the execute permissions the assignees need on all parent directories (including the root of the container) to reach the file.
+// The entries Raito adds are recorded in the state with the granted files that need them, and are revoked once no granted file needs them anymore.
+func convertToTraversalAssignments(fullNameParts []string, assignees []ACLAssignee) ACLAssignments {
+	result := make(ACLAssignments)
+	pathParts := fullNameParts[4:]
+
+	for i := 0; i < len(pathParts); i++ {
+		item := ACLAssignedItem{
+			StorageAccount: fullNameParts[2],
+			Container:      fullNameParts[3],
+			Path:           strings.Join(pathParts[:i], "/"),
+			Type:           ACLItemTraversal,
+		}
+
+		for _, assignee := range assignees {
+			result[ACLAssignment{Assignee: assignee, Item: item}] = ACLPermissionChanges{Added: NewACLPermissionSet(Execute)}
+		}
+	}
+
+	return result
+}
+
+func setACLs(ctx context.Context, acls ACLAssignmentsWithAP, apGroups map[string][]string, feedbackHandler global.AccessProviderFeedbackHandler, configMap *config.ConfigMap) error {
 	var assignedItems []ACLAssignedItem
 	aclsPerItem := make(map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP)
+	traversalsPerItem := make(map[ACLAssignedItem]map[ACLAssignee]ACLPermissionChangesWithAP)
 
 	for aclAssignment, changes := range acls {
 		item := aclAssignment.Item
 
+		if item.Type == ACLItemTraversal {
+			if _, ok := traversalsPerItem[item]; !ok {
+				traversalsPerItem[item] = make(map[ACLAssignee]ACLPermissionChangesWithAP)
+			}
+
+			traversalsPerItem[item][aclAssignment.Assignee] = changes
+
+			continue
+		}
+
 		if _, ok := aclsPerItem[item]; !ok {
 			aclsPerItem[item] = make(map[ACLAssignee]ACLPermissionChangesWithAP)
 
@@ -401,22 +493,51 @@ func setACLs(ctx context.Context, acls ACLAssignmentsWithAP, feedbackHandler glo
 		aclsPerItem[item][aclAssignment.Assignee] = changes
 	}
 
-	sort.Slice(assignedItems, func(i, j int) bool {
-		sectionsI := strings.Count(assignedItems[i].Path, "/")
-		sectionsJ := strings.Count(assignedItems[j].Path, "/")
+	state, err := loadACLState(configMap.Parameters)
+	if err != nil {
+		return err
+	}
+
+	state.seed(acls)
 
-		if sectionsI == sectionsJ {
-			return assignedItems[i].Path < assignedItems[j].Path
+	// Items that got ACL entries from Raito before are verified as well, to detect entries that were changed outside of Raito
+	for _, item := range state.items() {
+		if _, ok := aclsPerItem[item]; !ok {
+			aclsPerItem[item] = make(map[ACLAssignee]ACLPermissionChangesWithAP)
+
+			assignedItems = append(assignedItems, item)
 		}
+	}
 
-		return sectionsI < sectionsJ
-	})
+	sortACLItemsByDepth(assignedItems)
+
+	reader := newACLReader(configMap.Parameters)
+
+	// Parent directories of granted files need to be traversable before the files themselves can be accessed
+	traversalItems := make([]ACLAssignedItem, 0, len(traversalsPerItem))
+	for item := range traversalsPerItem {
+		traversalItems = append(traversalItems, item)
+	}
+
+	sortACLItemsByDepth(traversalItems)
+
+	for _, item := range traversalItems {
+		state.traversed(item, grantTraversal(ctx, reader, configMap.Parameters, item, traversalsPerItem[item], feedbackHandler))
+	}
+
+	limitValidator := newACLLimitValidator(configMap, reader, apGroups, assignedItems, feedbackHandler)
+	operations := make([]*aclOperation, 0, len(assignedItems)*2)
+	operationChanges := make(map[*aclOperation]map[ACLAssignee]ACLPermissionChangesWithAP, len(assignedItems)*2)
 
 	for _, item := range assignedItems {
-		assigneesAndChanges := aclsPerItem[item]
+		inherited := inheritedAssignees(item, state, aclsPerItem, traversalsPerItem)
+		assigneesAndChanges := reconcileDrift(ctx, reader, state, item, aclsPerItem[item], inherited, feedbackHandler)
+		assigneesAndChanges = limitValidator.validate(ctx, item, assigneesAndChanges)
 
 		aclStringsToAdd := make([]string, 0, len(assigneesAndChanges)*2)
 		aclStringsToRemove := make([]string, 0, len(assigneesAndChanges)*2)
+		changesToAdd := make(map[ACLAssignee]ACLPermissionChangesWithAP)
+		changesToRemove := make(map[ACLAssignee]ACLPermissionChangesWithAP)
 
 		apIds := set.NewSet[string]()
 
@@ -428,70 +549,107 @@ func setACLs(ctx context.Context, acls ACLAssignmentsWithAP, feedbackHandler glo
 				aclStringForAssignee += ":" + aclPermissionSet.String()
 			}
 
-			defaultAclStringForAssignee := fmt.Sprintf("default:%s", aclStringForAssignee)
+			aclStrings := []string{aclStringForAssignee}
+			if item.HasDefaultACL() {
+				aclStrings = append(aclStrings, fmt.Sprintf("default:%s", aclStringForAssignee))
+			}
 
 			if toRemove {
-				aclStringsToRemove = append(aclStringsToRemove, aclStringForAssignee, defaultAclStringForAssignee)
+				aclStringsToRemove = append(aclStringsToRemove, aclStrings...)
+				changesToRemove[assignee] = changes
 			} else {
-				aclStringsToAdd = append(aclStringsToAdd, aclStringForAssignee, defaultAclStringForAssignee)
+				aclStringsToAdd = append(aclStringsToAdd, aclStrings...)
+				changesToAdd[assignee] = changes
 			}
 
 			apIds.Add(changes.APIds...)
 		}
 
-		client, err := createDirectoryClient(ctx, item.StorageAccount, item.Container, item.Path, params)
-		if err != nil {
-			feedbackHandler.Error(err.Error(), apIds.Slice()...)
-			continue
-		}
+		// Sorting keeps the ACL strings stable between runs so interrupted operations can be matched with their checkpoint
+		sort.Strings(aclStringsToRemove)
+		sort.Strings(aclStringsToAdd)
 
 		if len(aclStringsToRemove) > 0 {
-			aclStringToRemove := strings.Join(aclStringsToRemove, ",")
-			logger.Info(fmt.Sprintf("Remove ACLs for %s/%s/%s: %s", item.StorageAccount, item.Container, item.Path, aclStringToRemove))
+			op := &aclOperation{Item: item, Mode: aclOperationRemove, ACL: strings.Join(aclStringsToRemove, ","), APIds: apIds.Slice()}
+			operations = append(operations, op)
+			operationChanges[op] = changesToRemove
+		}
 
-			r, err := client.RemoveAccessControlRecursive(ctx, aclStringToRemove, nil)
-			if err != nil {
-				logger.Error(fmt.Sprintf("Something went wrong while removing ACLs for %s/%s/%s: %s", item.StorageAccount, item.Container, item.Path, err.Error()))
+		if len(aclStringsToAdd) > 0 {
+			op := &aclOperation{Item: item, Mode: aclOperationModify, ACL: strings.Join(aclStringsToAdd, ","), APIds: apIds.Slice()}
+			operations = append(operations, op)
+			operationChanges[op] = changesToAdd
+		}
+	}
 
-				feedbackHandler.Error(err.Error(), apIds.Slice()...)
+	executor, err := newRecursiveACLExecutor(configMap)
+	if err != nil {
+		return err
+	}
 
-				continue
-			}
+	// Operations that were interrupted during a previous run are finished first, so the changes of this run take precedence
+	leftovers, err := executor.leftovers(operations)
+	if err != nil {
+		return err
+	}
 
-			err = parseRemoveAccessControlResult(&r)
-			if err != nil {
-				feedbackHandler.Error(err.Error(), apIds.Slice()...)
+	for _, op := range leftovers {
+		logger.Info(fmt.Sprintf("Resuming interrupted operation to %s", op))
 
-				continue
+		runACLOperation(ctx, executor, op, feedbackHandler)
+	}
+
+	for _, op := range operations {
+		logger.Info(fmt.Sprintf("%s: %s", op, op.ACL))
+
+		if !runACLOperation(ctx, executor, op, feedbackHandler) {
+			continue
+		}
+
+		for assignee, changes := range operationChanges[op] {
+			if op.Mode == aclOperationRemove {
+				state.removed(op.Item, assignee)
+			} else {
+				permissions, _ := changes.ChangeSet()
+				state.applied(op.Item, assignee, permissions, changes.APIds)
 			}
 		}
+	}
 
-		if len(aclStringsToAdd) > 0 {
-			aclStringToAdd := strings.Join(aclStringsToAdd, ",")
+	releaseTraversals(ctx, reader, configMap.Parameters, state, aclsPerItem)
+
+	return state.save()
+}
 
-			logger.Info(fmt.Sprintf("Add ACLs for %s/%s/%s: %s", item.StorageAccount, item.Container, item.Path, aclStringToAdd))
+// sortACLItemsByDepth sorts the items so parent directories are handled before their children
+func sortACLItemsByDepth(items []ACLAssignedItem) {
+	sort.Slice(items, func(i, j int) bool {
+		sectionsI := strings.Count(items[i].Path, "/")
+		sectionsJ := strings.Count(items[j].Path, "/")
 
-			r, err := client.UpdateAccessControlRecursive(ctx, aclStringToAdd, &directory.UpdateAccessControlRecursiveOptions{
-				BatchSize: ptr.Int32(1),
-			})
-			if err != nil {
-				logger.Error(fmt.Sprintf("Something went wrong while adding ACLs for %s/%s/%s: %s", item.StorageAccount, item.Container, item.Path, err.Error()))
+		if sectionsI == sectionsJ {
+			return items[i].Path < items[j].Path
+		}
 
-				feedbackHandler.Error(err.Error(), apIds.Slice()...)
+		return sectionsI < sectionsJ
+	})
+}
 
-				continue
-			}
+// runACLOperation executes the operation and reports the result to the access providers involved. It returns true if the operation completed successfully.
+func runACLOperation(ctx context.Context, executor *recursiveACLExecutor, op *aclOperation, feedbackHandler global.AccessProviderFeedbackHandler) bool {
+	err := executor.run(ctx, op)
 
-			err = parseUpdateAccessControlResult(&r)
-			if err != nil {
-				feedbackHandler.Error(err.Error(), apIds.Slice()...)
+	if errors.Is(err, errACLOperationInterrupted) {
+		logger.Warn(err.Error())
 
-				continue
-			}
-		}
+		feedbackHandler.Warning(err.Error(), op.APIds...)
+	} else if err != nil {
+		logger.Error(fmt.Sprintf("Something went wrong while trying to %s: %s", op, err.Error()))
+
+		feedbackHandler.Error(err.Error(), op.APIds...)
 	}
 
-	return nil
+	return err == nil
 }
 
 func parseUpdateAccessControlResult(r *directory.SetAccessControlRecursiveResponse) error {
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertToACLAssignment_ContainerRoot(t *testing.T) {
+	fullNameParts := strings.Split("sub/rg/sa/data", "/")
+
+	aclPermissions, otherPermissions := splitACLPermissions([]string{"Read", "Execute", "Storage Blob Data Reader"})
+	assert.Equal(t, []string{"Read", "Execute"}, aclPermissions)
+	assert.Equal(t, []string{"Storage Blob Data Reader"}, otherPermissions)
+
+	assignments, err := convertToACLAssignment(fullNameParts, ACLItemDirectory, aclPermissions, false, []ACLAssignee{"user:u1"}, nil)
+	require.NoError(t, err)
+
+	root := ACLAssignedItem{StorageAccount: "sa", Container: "data", Path: "", Type: ACLItemDirectory}
+
+	assert.Equal(t, ACLAssignments{
+		{Assignee: "user:u1", Item: root}: {Added: NewACLPermissionSet(Read, Execute)},
+	}, assignments)
+
+	// The root directory gets a default ACL, so new top-level folders and files inherit the entries
+	assert.True(t, root.HasDefaultACL())
+	assert.True(t, isSameOrParentPath(root, "raw"))
+
+	// The directory client of the root receives the URL of the filesystem root directory
+	assert.Equal(t, "https://sa.dfs.core.windows.net/data/", dataLakePathURL(root.StorageAccount, root.Container, root.Path))
+	assert.Equal(t, "https://sa.dfs.core.windows.net/data/", dataLakePathURL("sa", "data", "/"))
+	assert.Equal(t, "https://sa.dfs.core.windows.net/data/raw/a.csv", dataLakePathURL("sa", "data", "raw/a.csv"))
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// dataObjectLimits restrict the folders and files below a container that are synced, to keep the sync time and the size of the catalog manageable
+type dataObjectLimits struct {
+	// maxFolderDepth is the number of folder levels below the container that are synced. A negative value means no limit.
+	maxFolderDepth int
+	includeFiles   bool
+	// maxFilesPerFolder is the number of files that are synced per folder (or container). A negative value means no limit.
+	maxFilesPerFolder int
+}
+
+func newDataObjectLimits(configMap *config.ConfigMap) dataObjectLimits {
+	return dataObjectLimits{
+		maxFolderDepth:    configMap.GetIntWithDefault(global.AzDataSourceMaxFolderDepth, -1),
+		includeFiles:      configMap.GetBoolWithDefault(global.AzDataSourceIncludeFiles, true),
+		maxFilesPerFolder: configMap.GetIntWithDefault(global.AzDataSourceMaxFilesPerFolder, -1),
+	}
+}
+
+// unlimited returns true if all folders and files are synced
+func (l dataObjectLimits) unlimited() bool {
+	return l.maxFolderDepth < 0 && l.includeFiles && l.maxFilesPerFolder < 0
+}
+
+// allowsFolder returns true if folders at the given depth (1 for folders in the container) are synced
+func (l dataObjectLimits) allowsFolder(depth int) bool {
+	return l.maxFolderDepth < 0 || depth <= l.maxFolderDepth
+}
+
+// allowsFile returns true if a file is synced in a folder in which the given number of files were synced already
+func (l dataObjectLimits) allowsFile(filesInFolder int) bool {
+	return l.includeFiles && (l.maxFilesPerFolder < 0 || filesInFolder < l.maxFilesPerFolder)
+}
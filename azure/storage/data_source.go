@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/filesystem"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/service"
 	"github.com/aws/smithy-go/ptr"
@@ -102,6 +104,60 @@ func (s *DataSourceSyncer) syncStorageAccount(ctx context.Context, parent string
 		return err
 	}
 
+	var feed *changeFeed
+
+	var known *knownObjects
+
+	var lastConsumable time.Time
+
+	// The change feed can only be used for full syncs, as all known objects are added to the data source
+	if configMap.GetBoolWithDefault(global.AzDataSourceChangeFeed, false) && s.config.DataObjectParent == "" {
+		feed, lastConsumable, known, err = openChangeFeed(ctx, accountName, storageAccount, configMap)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to read the change feed of storage account %s, doing a full sync: %s", accountName, err.Error()))
+
+			feed = nil
+		}
+	}
+
+	var segments []changeFeedSegment
+
+	incremental := false
+
+	if feed != nil {
+		segments, incremental, err = feed.retains(ctx, known.Checkpoint)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to list the change feed segments of storage account %s, doing a full sync: %s", accountName, err.Error()))
+		}
+
+		if !incremental {
+			logger.Info(fmt.Sprintf("No usable change feed checkpoint found for storage account %s, doing a full sync", accountName))
+
+			// The folders and files of the full sync are the starting point to apply the changes to in the next sync
+			known.reset()
+			dataSourceHandler = &knownObjectsHandler{DataSourceObjectHandler: dataSourceHandler, known: known}
+		}
+	}
+
+	var inventory *inventoryReport
+
+	if configMap.GetBoolWithDefault(global.AzDataSourceInventory, false) && !incremental {
+		_, resourceGroup, _ := strings.Cut(parent, "/")
+
+		inventory, err = latestInventoryReport(ctx, resourceGroup, accountName, configMap)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to read the blob inventory of storage account %s, listing its paths instead: %s", accountName, err.Error()))
+
+			inventory = nil
+		} else if inventory != nil {
+			defer inventory.close()
+		}
+	}
+
+	// containers are the containers that are synced, to filter the blobs in the inventory report or change feed
+	containers := make(map[string]bool)
+	complete := true
+
 	pager := client.NewListFileSystemsPager(&service.ListFileSystemsOptions{Include: service.ListFileSystemsInclude{Deleted: ptr.Bool(false)}})
 	for pager.More() {
 		page, err := pager.NextPage(ctx)
@@ -110,20 +166,67 @@ func (s *DataSourceSyncer) syncStorageAccount(ctx context.Context, parent string
 		}
 
 		for _, fs := range page.ListFileSystemsSegmentResponse.FileSystemItems {
-			errFs := s.syncFileSystem(ctx, client, storageAccount, *fs.Name, dataSourceHandler)
+			var errFs error
+
+			if inventory != nil || incremental {
+				containers[*fs.Name], errFs = s.syncContainer(storageAccount, *fs.Name, dataSourceHandler)
+			} else {
+				errFs = s.syncFileSystem(ctx, client, storageAccount, *fs.Name, dataSourceHandler)
+			}
+
 			if errFs != nil {
 				logger.Warn(fmt.Sprintf("Failed to sync file system '%s/%s': %s", storageAccount, *fs.Name, errFs.Error()))
+
+				complete = false
 			}
 		}
 	}
 
+	switch {
+	case incremental:
+		logger.Info(fmt.Sprintf("Applying the change feed of storage account %s since %s", accountName, known.Checkpoint.Format(time.RFC3339)))
+
+		tree := newInventoryTree(storageAccount, containers, configMap, s.shouldHandle, known.addDataObjects)
+		known.seed(tree)
+
+		err = feed.applyChanges(ctx, segments, lastConsumable, known, tree)
+		if err != nil {
+			return fmt.Errorf("apply change feed: %w", err)
+		}
+
+		err = known.emit(storageAccount, containers, dataSourceHandler.AddDataObjects)
+		if err != nil {
+			return err
+		}
+	case inventory != nil:
+		logger.Info(fmt.Sprintf("Processing blob inventory report of %s for storage account %s", inventory.manifest.InventoryCompletionTime.Format(time.RFC3339), accountName))
+
+		tree := newInventoryTree(storageAccount, containers, configMap, s.shouldHandle, dataSourceHandler.AddDataObjects)
+
+		err = inventory.read(tree.add)
+		if err != nil {
+			return fmt.Errorf("read blob inventory report: %w", err)
+		}
+	}
+
+	// The checkpoint is only kept if all folders and files were synced, otherwise the next sync is a full sync again
+	if feed != nil && complete {
+		known.Checkpoint = lastConsumable
+
+		err = known.save()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (s *DataSourceSyncer) syncFileSystem(ctx context.Context, serviceClient *service.Client, parent string, fileSystem string, dataSourceHandler wrappers.DataSourceObjectHandler) error {
+// syncContainer adds the data object of the container and returns whether its content needs to be synced
+func (s *DataSourceSyncer) syncContainer(parent string, fileSystem string, dataSourceHandler wrappers.DataSourceObjectHandler) (bool, error) {
 	storageContainer := fmt.Sprintf("%s/%s", parent, fileSystem)
 	if !s.shouldGoInto(storageContainer) {
-		return nil
+		return false, nil
 	}
 
 	logger.Info(fmt.Sprintf("Processing container %s", fileSystem))
@@ -137,23 +240,60 @@ func (s *DataSourceSyncer) syncFileSystem(ctx context.Context, serviceClient *se
 			ParentExternalId: parent,
 		})
 		if err != nil {
-			return err
+			return false, err
 		}
 	}
 
-	client := serviceClient.NewFileSystemClient(fileSystem)
+	return true, nil
+}
 
-	var options *filesystem.ListPathsOptions
+func (s *DataSourceSyncer) syncFileSystem(ctx context.Context, serviceClient *service.Client, parent string, fileSystem string, dataSourceHandler wrappers.DataSourceObjectHandler) error {
+	storageContainer := fmt.Sprintf("%s/%s", parent, fileSystem)
+
+	goInto, err := s.syncContainer(parent, fileSystem, dataSourceHandler)
+	if err != nil || !goInto {
+		return err
+	}
+
+	directory := ""
 
 	if s.config.DataObjectParent != "" {
-		prefix := s.config.DataObjectParent
-		prefix, f := strings.CutPrefix(prefix, storageContainer)
+		prefix, f := strings.CutPrefix(s.config.DataObjectParent, storageContainer)
 
 		if f {
-			options = &filesystem.ListPathsOptions{Prefix: &prefix}
+			directory = prefix
 		}
 	}
 
+	return listPaths(ctx, serviceClient.NewFileSystemClient(fileSystem), directory, newDataObjectLimits(s.config.GetConfigMap()), func(name string) bool {
+		return s.shouldGoInto(fmt.Sprintf("%s/%s", storageContainer, name))
+	}, func(path *filesystem.Path) error {
+		errPath := s.syncContainerObject(storageContainer, path, dataSourceHandler)
+		if errPath != nil {
+			logger.Warn(fmt.Sprintf("Failed to sync object '%s/%s': %s", storageContainer, *path.Name, errPath.Error()))
+		}
+
+		return nil
+	})
+}
+
+// pathLister lists the paths in a file system, which is implemented by *filesystem.Client
+type pathLister interface {
+	NewListPathsPager(recursive bool, options *filesystem.ListPathsOptions) *runtime.Pager[filesystem.ListPathsSegmentResponse]
+}
+
+// listPaths passes the folders and files below the directory that are within the limits to the handler.
+// Without limits, all paths are listed at once. Otherwise, they are listed level by level, and only the folders for which goInto returns true are listed in turn.
+func listPaths(ctx context.Context, client pathLister, directory string, limits dataObjectLimits, goInto func(name string) bool, handler func(path *filesystem.Path) error) error {
+	if !limits.unlimited() {
+		return listPathLevels(ctx, client, directory, limits, goInto, handler)
+	}
+
+	var options *filesystem.ListPathsOptions
+	if directory != "" {
+		options = &filesystem.ListPathsOptions{Prefix: &directory}
+	}
+
 	pager := client.NewListPathsPager(true, options)
 	for pager.More() {
 		page, err := pager.NextPage(ctx)
@@ -162,9 +302,9 @@ func (s *DataSourceSyncer) syncFileSystem(ctx context.Context, serviceClient *se
 		}
 
 		for _, path := range page.Paths {
-			errPath := s.syncContainerObject(storageContainer, path, dataSourceHandler)
-			if errPath != nil {
-				logger.Warn(fmt.Sprintf("Failed to sync object '%s/%s': %s", storageContainer, *path.Name, errPath.Error()))
+			err = handler(path)
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -172,6 +312,85 @@ func (s *DataSourceSyncer) syncFileSystem(ctx context.Context, serviceClient *se
 	return nil
 }
 
+// listPathLevels lists the paths below the directory level by level, so folders below the maximum depth are never listed.
+// Listing stops for a folder as soon as its files are no longer needed and it has no more subfolders to sync.
+func listPathLevels(ctx context.Context, client pathLister, directory string, limits dataObjectLimits, goInto func(name string) bool, handler func(path *filesystem.Path) error) error {
+	directories := []string{directory}
+
+	for len(directories) > 0 {
+		var next []string
+
+		for _, dir := range directories {
+			subdirectories, err := listDirectory(ctx, client, dir, limits, goInto, handler)
+			if err != nil {
+				return err
+			}
+
+			next = append(next, subdirectories...)
+		}
+
+		directories = next
+	}
+
+	return nil
+}
+
+// listDirectory passes the folders and files directly in the directory to the handler and returns the folders that need to be listed in turn
+func listDirectory(ctx context.Context, client pathLister, directory string, limits dataObjectLimits, goInto func(name string) bool, handler func(path *filesystem.Path) error) ([]string, error) {
+	var options *filesystem.ListPathsOptions
+	if directory != "" {
+		options = &filesystem.ListPathsOptions{Prefix: &directory}
+	}
+
+	depth := 1
+	if trimmed := strings.Trim(directory, "/"); trimmed != "" {
+		depth = strings.Count(trimmed, "/") + 2
+	}
+
+	var subdirectories []string
+
+	files := 0
+
+	pager := client.NewListPathsPager(false, options)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range page.Paths {
+			if path.IsDirectory != nil && *path.IsDirectory {
+				if !limits.allowsFolder(depth) {
+					// Folders at this depth are not synced
+					continue
+				}
+
+				if (limits.allowsFolder(depth+1) || limits.allowsFile(0)) && goInto(*path.Name) {
+					subdirectories = append(subdirectories, *path.Name)
+				}
+			} else {
+				if !limits.allowsFile(files) {
+					// Paths are listed by name, so folders can still follow the files. Listing only stops if those folders aren't synced either.
+					if !limits.allowsFolder(depth) {
+						return subdirectories, nil
+					}
+
+					continue
+				}
+
+				files++
+			}
+
+			err = handler(path)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return subdirectories, nil
+}
+
 func (s *DataSourceSyncer) syncContainerObject(containerName string, path *filesystem.Path, dataSourceHandler wrappers.DataSourceObjectHandler) error {
 	fullName := fmt.Sprintf("%s/%s", containerName, *path.Name)
 	if !s.shouldHandle(fullName) {
@@ -205,50 +424,9 @@ func (s *DataSourceSyncer) syncContainerObject(containerName string, path *files
 func (s *DataSourceSyncer) GetDataObjectTypes(_ context.Context) ([]string, []*ds.DataObjectType) {
 	logger.Debug("Returning meta data for Azure Storage data source")
 
-	folderPermissions := []*ds.DataObjectTypePermission{
-		{
-			Permission:             "Read",
-			Description:            "Read access to the folder",
-			GlobalPermissions:      []string{ds.Read},
-			UsageGlobalPermissions: []string{ds.Read},
-		},
-		{
-			Permission:             "Write",
-			Description:            "Write access to the folder",
-			GlobalPermissions:      []string{ds.Write},
-			UsageGlobalPermissions: []string{ds.Write},
-		},
-		{
-			Permission:        "Execute",
-			Description:       "Execute access to the folder",
-			GlobalPermissions: []string{ds.Read, ds.Write},
-		},
-	}
-	folderPermissions = append(folderPermissions, s.GetIAMPermissions(true)...)
-
-	filePermissions := []*ds.DataObjectTypePermission{
-		{
-			Permission:             "Read",
-			Description:            "Read access to the file",
-			GlobalPermissions:      []string{ds.Read},
-			UsageGlobalPermissions: []string{ds.Read},
-			CannotBeGranted:        true,
-		},
-		{
-			Permission:             "Write",
-			Description:            "Write access to the file",
-			GlobalPermissions:      []string{ds.Write},
-			UsageGlobalPermissions: []string{ds.Write},
-			CannotBeGranted:        true,
-		},
-		{
-			Permission:        "Execute",
-			Description:       "Execute access to the file",
-			GlobalPermissions: []string{ds.Read, ds.Write},
-			CannotBeGranted:   true,
-		},
-	}
-	filePermissions = append(filePermissions, s.GetIAMPermissions(true)...)
+	containerPermissions := append(getACLPermissions(Container), s.GetIAMPermissions(false)...)
+	folderPermissions := append(getACLPermissions(Folder), s.GetIAMPermissions(true)...)
+	filePermissions := append(getACLPermissions(File), s.GetIAMPermissions(true)...)
 
 	return []string{"subscription"}, []*ds.DataObjectType{
 		{
@@ -272,14 +450,20 @@ func (s *DataSourceSyncer) GetDataObjectTypes(_ context.Context) ([]string, []*d
 		{
 			Name:        Container,
 			Type:        Container,
-			Permissions: s.GetIAMPermissions(false),
+			Permissions: containerPermissions,
 			Children:    []string{Folder, File},
 		},
 		{
 			Name:        Folder,
 			Type:        Folder,
 			Permissions: folderPermissions,
-			Children:    []string{Folder, File},
+			Actions: []*ds.DataObjectTypeAction{
+				{
+					Action:        "DeleteDirectory",
+					GlobalActions: []string{ds.Write},
+				},
+			},
+			Children: []string{Folder, File},
 		},
 		{
 			Name:        File,
@@ -295,13 +479,37 @@ func (s *DataSourceSyncer) GetDataObjectTypes(_ context.Context) ([]string, []*d
 					GlobalActions: []string{ds.Write},
 				},
 				{
-					Action:        "DeleteBlob",
+					Action:        "PutBlockList",
+					GlobalActions: []string{ds.Write},
+				},
+				{
+					Action:        "PutBlockFromURL",
+					GlobalActions: []string{ds.Write},
+				},
+				{
+					Action:        "AppendFile",
+					GlobalActions: []string{ds.Write},
+				},
+				{
+					Action:        "FlushFile",
+					GlobalActions: []string{ds.Write},
+				},
+				{
+					Action:        "CreateFile",
 					GlobalActions: []string{ds.Write},
 				},
 				{
 					Action:        "DeleteBlob",
 					GlobalActions: []string{ds.Write},
 				},
+				{
+					Action:        "DeleteFile",
+					GlobalActions: []string{ds.Write},
+				},
+				{
+					Action:        "RenamePathFile",
+					GlobalActions: []string{ds.Write},
+				},
 			},
 			Children: []string{},
 		},
@@ -312,6 +520,29 @@ func (s *DataSourceSyncer) GetDataSourceIAMPermissions() []*ds.DataObjectTypePer
 	return []*ds.DataObjectTypePermission{}
 }
 
+// getACLPermissions returns the POSIX ACL permissions that can be granted on a container (root directory), folder or file
+func getACLPermissions(objectType string) []*ds.DataObjectTypePermission {
+	return []*ds.DataObjectTypePermission{
+		{
+			Permission:             "Read",
+			Description:            fmt.Sprintf("Read access to the %s", objectType),
+			GlobalPermissions:      []string{ds.Read},
+			UsageGlobalPermissions: []string{ds.Read},
+		},
+		{
+			Permission:             "Write",
+			Description:            fmt.Sprintf("Write access to the %s", objectType),
+			GlobalPermissions:      []string{ds.Write},
+			UsageGlobalPermissions: []string{ds.Write},
+		},
+		{
+			Permission:        "Execute",
+			Description:       fmt.Sprintf("Execute access to the %s", objectType),
+			GlobalPermissions: []string{ds.Read, ds.Write},
+		},
+	}
+}
+
 func (s *DataSourceSyncer) GetIAMPermissions(cannotBeGranted bool) []*ds.DataObjectTypePermission {
 	return []*ds.DataObjectTypePermission{
 		{
@@ -381,41 +612,11 @@ func handleError(e error) error {
 }
 
 // shouldHandle determines if this data object needs to be handled by the syncer or not. It does this by looking at the configuration options to only sync a part.
-func (s *DataSourceSyncer) shouldHandle(fullName string) (ret bool) {
-	defer func() {
-		logger.Debug(fmt.Sprintf("shouldHandle %s: %t", fullName, ret))
-	}()
-
-	// No partial sync specified, so do everything
-	if s.config.DataObjectParent == "" {
-		return true
-	}
-
-	// Check if the data object is under the data object to start from
-	if !strings.HasPrefix(fullName, s.config.DataObjectParent) || s.config.DataObjectParent == fullName {
-		return false
-	}
-
-	// Check if we hit any excludes
-	for _, exclude := range s.config.DataObjectExcludes {
-		if strings.HasPrefix(fullName, s.config.DataObjectParent+"/"+exclude) {
-			return false
-		}
-	}
-
-	return true
+func (s *DataSourceSyncer) shouldHandle(fullName string) bool {
+	return global.ShouldHandleDataObject(s.config, fullName)
 }
 
 // shouldGoInto checks if we need to go deeper into this data object or not.
-func (s *DataSourceSyncer) shouldGoInto(fullName string) (ret bool) {
-	defer func() {
-		logger.Debug(fmt.Sprintf("shouldGoInto %s: %t", fullName, ret))
-	}()
-
-	// No partial sync specified, so do everything
-	if s.config.DataObjectParent == "" || strings.HasPrefix(s.config.DataObjectParent, fullName) || strings.HasPrefix(fullName, s.config.DataObjectParent) {
-		return true
-	}
-
-	return false
+func (s *DataSourceSyncer) shouldGoInto(fullName string) bool {
+	return global.ShouldGoIntoDataObject(s.config, fullName)
 }
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/filesystem"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// fakePathLister returns the pages of paths per listed directory and records the pages that were fetched
+type fakePathLister struct {
+	pages   map[string][][]*filesystem.Path
+	fetched []string
+}
+
+func (l *fakePathLister) NewListPathsPager(_ bool, options *filesystem.ListPathsOptions) *runtime.Pager[filesystem.ListPathsSegmentResponse] {
+	directory := ""
+	if options != nil && options.Prefix != nil {
+		directory = *options.Prefix
+	}
+
+	pages := l.pages[directory]
+	next := 0
+
+	return runtime.NewPager(runtime.PagingHandler[filesystem.ListPathsSegmentResponse]{
+		More: func(filesystem.ListPathsSegmentResponse) bool {
+			return next < len(pages)
+		},
+		Fetcher: func(context.Context, *filesystem.ListPathsSegmentResponse) (filesystem.ListPathsSegmentResponse, error) {
+			l.fetched = append(l.fetched, directory)
+
+			page := filesystem.ListPathsSegmentResponse{}
+			if next < len(pages) {
+				page.Paths = pages[next]
+			}
+
+			next++
+
+			return page, nil
+		},
+	})
+}
+
+func folderPath(name string) *filesystem.Path {
+	return &filesystem.Path{Name: ptr.String(name), IsDirectory: ptr.Bool(true)}
+}
+
+func filePath(name string) *filesystem.Path {
+	return &filesystem.Path{Name: ptr.String(name)}
+}
+
+func TestListPathLevels(t *testing.T) {
+	tests := []struct {
+		name        string
+		directory   string
+		params      map[string]string
+		goInto      func(name string) bool
+		pages       map[string][][]*filesystem.Path
+		wantPaths   []string
+		wantFetched []string
+	}{
+		{
+			name:   "Maximum folder depth",
+			params: map[string]string{global.AzDataSourceMaxFolderDepth: "1"},
+			pages: map[string][][]*filesystem.Path{
+				"":    {{folderPath("raw"), filePath("README.md")}},
+				"raw": {{folderPath("raw/2024"), filePath("raw/01.csv")}},
+			},
+			wantPaths:   []string{"raw", "README.md", "raw/01.csv"},
+			wantFetched: []string{"", "raw"},
+		},
+		{
+			name:      "Maximum folder depth below a directory",
+			directory: "/raw",
+			params:    map[string]string{global.AzDataSourceMaxFolderDepth: "2", global.AzDataSourceIncludeFiles: "false"},
+			pages: map[string][][]*filesystem.Path{
+				"/raw":     {{folderPath("raw/2024"), filePath("raw/01.csv")}},
+				"raw/2024": {{folderPath("raw/2024/01")}},
+			},
+			wantPaths:   []string{"raw/2024"},
+			wantFetched: []string{"/raw"},
+		},
+		{
+			name:      "Listing stops once the files are no longer needed and the folders are too deep",
+			directory: "/raw/2024",
+			params:    map[string]string{global.AzDataSourceMaxFolderDepth: "2", global.AzDataSourceMaxFilesPerFolder: "1"},
+			pages: map[string][][]*filesystem.Path{
+				"/raw/2024": {
+					{folderPath("raw/2024/01"), filePath("raw/2024/a.csv"), filePath("raw/2024/b.csv")},
+					{filePath("raw/2024/c.csv")},
+				},
+			},
+			wantPaths:   []string{"raw/2024/a.csv"},
+			wantFetched: []string{"/raw/2024"},
+		},
+		{
+			name:   "Maximum files per folder",
+			params: map[string]string{global.AzDataSourceMaxFilesPerFolder: "1"},
+			pages: map[string][][]*filesystem.Path{
+				"": {
+					{filePath("a.csv"), filePath("b.csv")},
+					{folderPath("raw")},
+				},
+				"raw": {{filePath("raw/01.csv"), filePath("raw/02.csv")}},
+			},
+			wantPaths:   []string{"a.csv", "raw", "raw/01.csv"},
+			wantFetched: []string{"", "", "raw"},
+		},
+		{
+			name:   "Folders that are filtered out are not listed",
+			params: map[string]string{global.AzDataSourceMaxFolderDepth: "3"},
+			goInto: func(name string) bool { return name != "tmp" },
+			pages: map[string][][]*filesystem.Path{
+				"":    {{folderPath("raw"), folderPath("tmp")}},
+				"raw": {{filePath("raw/01.csv")}},
+				"tmp": {{filePath("tmp/01.csv")}},
+			},
+			wantPaths:   []string{"raw", "tmp", "raw/01.csv"},
+			wantFetched: []string{"", "raw"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goInto := tt.goInto
+			if goInto == nil {
+				goInto = func(string) bool { return true }
+			}
+
+			lister := &fakePathLister{pages: tt.pages}
+
+			var paths []string
+
+			err := listPathLevels(context.Background(), lister, tt.directory, newDataObjectLimits(&config.ConfigMap{Parameters: tt.params}), goInto, func(path *filesystem.Path) error {
+				paths = append(paths, *path.Name)
+
+				return nil
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantPaths, paths)
+			assert.Equal(t, tt.wantFetched, lister.fetched)
+		})
+	}
+}
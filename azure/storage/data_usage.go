@@ -2,11 +2,13 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/raito-io/cli/base/data_usage"
 	"github.com/raito-io/cli/base/util/config"
 
@@ -14,9 +16,45 @@ import (
 	"github.com/raito-io/cli-plugin-azure/global"
 )
 
+// usageOperation describes how a storage operation in the logs is reported as data usage
+type usageOperation struct {
+	action data_usage.ActionType
+	doType string
+}
+
+// usageOperations are the storage operations that are tracked as data usage.
+// Block uploads are tracked when the block list is committed (PutBlockList) instead of per staged block (PutBlock). An upload stages many blocks,
+// which would result in a statement per block, and the staged blocks only become part of the blob when the block list is committed.
+var usageOperations = map[string]usageOperation{
+	"GetBlob":         {action: data_usage.Read, doType: File},
+	"PutBlob":         {action: data_usage.Write, doType: File},
+	"PutBlockList":    {action: data_usage.Write, doType: File},
+	"PutBlockFromURL": {action: data_usage.Write, doType: File},
+	"AppendFile":      {action: data_usage.Write, doType: File},
+	"FlushFile":       {action: data_usage.Write, doType: File},
+	"CreateFile":      {action: data_usage.Write, doType: File},
+	"DeleteBlob":      {action: data_usage.Write, doType: File},
+	"DeleteFile":      {action: data_usage.Write, doType: File},
+	"DeleteDirectory": {action: data_usage.Write, doType: Folder},
+	"RenamePathFile":  {action: data_usage.Write, doType: File},
+}
+
+// usageAuthenticationTypes are the authentication types of the requests that are tracked as data usage
+var usageAuthenticationTypes = []string{"OAuth", "SAS", "AccountKey", "Anonymous"}
+
+// isTrackedResponseType returns true for successful requests and requests that failed because of the client, e.g. because access was denied
+func isTrackedResponseType(responseType string) bool {
+	return responseType == "Success" || strings.HasSuffix(responseType, "AuthorizationError") || strings.HasPrefix(responseType, "Client")
+}
+
 type DataUsageSyncer struct {
 }
 
+type usageStorageAccount struct {
+	resourceGroup string
+	name          string
+}
+
 func (s *DataUsageSyncer) SyncDataUsage(ctx context.Context, startDate time.Time, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
 	// we use the monitor service to 1. check if logging is enabled on our storage account and 2. extract the logs
 	monitorService := monitor.NewMonitorService()
@@ -27,52 +65,348 @@ func (s *DataUsageSyncer) SyncDataUsage(ctx context.Context, startDate time.Time
 		return err
 	}
 
+	queryBuilder, err := newUsageQueryBuilder(configParams)
+	if err != nil {
+		return err
+	}
+
+	coverage, err := newUsageLogsCoverage(configParams)
+	if err != nil {
+		return err
+	}
+
+	checkpoint, err := loadUsageCheckpoint(configParams, startDate)
+	if err != nil {
+		return err
+	}
+
+	err = s.syncStorageAccountsUsage(ctx, monitorService, queryBuilder, coverage, checkpoint, storageAccountsPerResourceGroup, configParams, commit)
+	if err != nil {
+		return saveUsageCheckpoint(checkpoint, err)
+	}
+
+	err = checkpoint.save()
+	if err != nil {
+		return err
+	}
+
+	// Diagnostic settings are only created after the usage is synced, so the current sync still uses the logs that were available before
+	coverage.apply(ctx, monitorService, configParams)
+
+	if configParams.GetBoolWithDefault(global.AzUsageActivityLog, false) {
+		// The checkpoint of the storage accounts is saved already. The Activity Log has no checkpoint, it is read again from the start date during the next sync.
+		err = syncActivityLogUsage(ctx, monitorService, storageAccountsPerResourceGroup, startDate, configParams, commit)
+		if errors.Is(err, global.ErrMaxUsageFileSizeReached) {
+			return err
+		} else if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to read the Activity Log of the subscription: %s", err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// syncStorageAccountsUsage syncs the usage of the storage accounts from the source their diagnostic setting sends the logs to.
+// Storage accounts that send their logs to the same Log Analytics workspace are grouped, so their logs are fetched with a single query.
+func (s *DataUsageSyncer) syncStorageAccountsUsage(ctx context.Context, monitorService monitor.MonitorService, queryBuilder *usageQueryBuilder, coverage *usageLogsCoverage, checkpoint *usageCheckpoint, storageAccountsPerResourceGroup map[string][]string, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
+	storageAccountsPerWorkspace := make(map[string][]usageStorageAccount)
+
 	for resourceGroup, storageAccounts := range storageAccountsPerResourceGroup {
 		for _, storageAccount := range storageAccounts {
-			enabled, _ := monitorService.HasLogsEnabled(ctx, configParams, resourceGroup, AzApiNamespace, "storageAccounts", fmt.Sprintf("%s/blobServices/default/", storageAccount))
+			setting, err := monitorService.GetResourceDiagnosticSetting(ctx, configParams, resourceGroup, AzApiNamespace, "storageAccounts", fmt.Sprintf("%s/blobServices/default/", storageAccount))
+			if err != nil {
+				// An error (e.g. access denied or throttling) doesn't mean the storage account has no diagnostic setting, so its logs can't be read reliably
+				logger.Warn(fmt.Sprintf("Unable to read the diagnostic settings of storage account %s, skipping its usage: %s", storageAccount, err.Error()))
 
-			if !enabled {
 				continue
 			}
 
-			query := "StorageBlobLogs | where OperationName == \"GetBlob\" and MetricResponseType == \"Success\" and AuthenticationType == \"OAuth\""
+			// Settings that don't send all logs are reported by the coverage check
+			coverage.check(setting, resourceGroup, storageAccount)
 
-			entries, err2 := monitorService.GetLogs(ctx, configParams, query, startDate, resourceGroup, AzApiNamespace, "storageAccounts", fmt.Sprintf("%s/blobServices/default/", storageAccount))
+			// The classic Storage Analytics logs are only read for storage accounts without a diagnostic setting
+			if setting == nil {
+				err = syncClassicUsage(ctx, resourceGroup, storageAccount, checkpoint, configParams, commit)
+				if errors.Is(err, global.ErrMaxUsageFileSizeReached) {
+					return err
+				} else if err != nil {
+					logger.Warn(fmt.Sprintf("Unable to read the classic Storage Analytics logs of storage account %s: %s", storageAccount, err.Error()))
+				}
 
-			if err2 != nil {
-				return err2
+				continue
 			}
 
-			for _, rt := range entries {
-				accessedResource := data_usage.UsageDataObjectItem{
-					DataObject: data_usage.UsageDataObjectReference{
-						FullName: fmt.Sprintf("%s/%s/%s/%s", configParams.GetString(global.AzSubscriptionId), resourceGroup, storageAccount, strings.Join(strings.Split(rt.ObjectKey, "/")[2:], "/")),
-						Type:     "file",
-					},
-					Permissions: []string{rt.OperationName},
+			if setting.WorkspaceID == "" {
+				err = syncArchivedUsage(ctx, monitorService, setting, resourceGroup, storageAccount, checkpoint, configParams, commit)
+				if err != nil {
+					return err
 				}
 
-				timeGenerated, err3 := time.Parse(time.RFC3339, rt.TimeGenerated)
+				continue
+			}
 
-				if err3 != nil {
-					return err3
-				}
+			storageAccountsPerWorkspace[setting.WorkspaceID] = append(storageAccountsPerWorkspace[setting.WorkspaceID], usageStorageAccount{resourceGroup: resourceGroup, name: storageAccount})
+		}
+	}
 
-				err3 = commit(data_usage.Statement{
-					ExternalId:          rt.CorrelationId,
-					User:                global.GetPrincipalNameById(ctx, configParams.Parameters, armauthorization.PrincipalTypeUser, rt.RequesterObjectId),
-					StartTime:           timeGenerated.Unix(),
-					EndTime:             timeGenerated.Unix(),
-					AccessedDataObjects: []data_usage.UsageDataObjectItem{accessedResource},
-					Success:             true,
-				})
-
-				if err3 != nil {
-					return err3
-				}
-			}
+	workspaces := make([]string, 0, len(storageAccountsPerWorkspace))
+	for workspace := range storageAccountsPerWorkspace {
+		workspaces = append(workspaces, workspace)
+	}
+
+	sort.Strings(workspaces)
+
+	for _, workspace := range workspaces {
+		err := s.syncWorkspaceUsage(ctx, monitorService, queryBuilder, workspace, storageAccountsPerWorkspace[workspace], checkpoint, configParams, commit)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// saveUsageCheckpoint saves the checkpoint if the sync stopped because the maximum file size is reached, so the next sync continues after the statements that were written.
+// The checkpoint is not saved for other errors, so the failed sync is retried from the previous checkpoint. The error is returned in both cases.
+func saveUsageCheckpoint(checkpoint *usageCheckpoint, err error) error {
+	if !errors.Is(err, global.ErrMaxUsageFileSizeReached) {
+		return err
+	}
+
+	errSave := checkpoint.save()
+	if errSave != nil {
+		return errSave
+	}
+
+	return err
+}
+
+// syncWorkspaceUsage fetches the logs of all storage accounts that send their logs to the workspace and splits the results per account.
+// If the workspace can't be queried directly, the logs are fetched per storage account.
+func (s *DataUsageSyncer) syncWorkspaceUsage(ctx context.Context, monitorService monitor.MonitorService, queryBuilder *usageQueryBuilder, workspace string, storageAccounts []usageStorageAccount, checkpoint *usageCheckpoint, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
+	subscriptionId := configParams.GetString(global.AzSubscriptionId)
+
+	resourceIds := make([]string, 0, len(storageAccounts)*2)
+	// knownAccounts maps the lower case names of the storage accounts to their names, as _ResourceId is usually upper case
+	knownAccounts := make(map[usageStorageAccount]usageStorageAccount, len(storageAccounts))
+
+	for _, storageAccount := range storageAccounts {
+		resourceId := fmt.Sprintf("/subscriptions/%s/resourcegroups/%s/providers/%s/storageAccounts/%s", subscriptionId, storageAccount.resourceGroup, AzApiNamespace, storageAccount.name)
+		resourceIds = append(resourceIds, resourceId, resourceId+"/blobServices/default")
+
+		knownAccounts[usageStorageAccount{resourceGroup: strings.ToLower(storageAccount.resourceGroup), name: strings.ToLower(storageAccount.name)}] = storageAccount
+	}
+
+	query, err := queryBuilder.workspaceQuery(resourceIds)
+	if err != nil {
+		return err
+	}
+
+	handledEntries := 0
+
+	err = monitorService.GetWorkspaceLogs(ctx, configParams, workspace, query, checkpoint.earliestStart(storageAccounts), func(entry monitor.LogEntry) error {
+		handledEntries++
+
+		resourceGroup, storageAccount, found := monitor.ParseResourceId(entry.ResourceId, "storageAccounts")
+		if !found {
+			logger.Debug(fmt.Sprintf("Ignoring log entry for unknown resource %q", entry.ResourceId))
+
+			return nil
+		}
+
+		account, known := knownAccounts[usageStorageAccount{resourceGroup: strings.ToLower(resourceGroup), name: strings.ToLower(storageAccount)}]
+		if !known {
+			return nil
+		}
+
+		return commitLogEntry(ctx, configParams, checkpoint, account.resourceGroup, account.name, entry, commit)
+	})
+
+	if err == nil || handledEntries > 0 {
+		return err
+	}
+
+	logger.Warn(fmt.Sprintf("Unable to query workspace %q directly, querying the logs per storage account instead: %s", workspace, err.Error()))
+
+	resourceQuery, err := queryBuilder.resourceQuery()
+	if err != nil {
+		return err
+	}
+
+	for _, storageAccount := range storageAccounts {
+		err = monitorService.GetLogs(ctx, configParams, resourceQuery, checkpoint.start(storageAccount.resourceGroup, storageAccount.name), storageAccount.resourceGroup, AzApiNamespace, "storageAccounts", fmt.Sprintf("%s/blobServices/default/", storageAccount.name), func(entry monitor.LogEntry) error {
+			return commitLogEntry(ctx, configParams, checkpoint, storageAccount.resourceGroup, storageAccount.name, entry, commit)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncArchivedUsage reads the logs of a storage account that are archived to another storage account by its diagnostic setting
+func syncArchivedUsage(ctx context.Context, monitorService monitor.MonitorService, setting *monitor.ResourceDiagnosticSetting, resourceGroup, storageAccount string, checkpoint *usageCheckpoint, configParams *config.ConfigMap, commit func(st data_usage.Statement) error) error {
+	return monitorService.GetArchivedLogs(ctx, configParams, setting, checkpoint.start(resourceGroup, storageAccount), func(entry monitor.LogEntry) error {
+		if !matchesUsageFilter(entry) {
+			return nil
+		}
+
+		return commitLogEntry(ctx, configParams, checkpoint, resourceGroup, storageAccount, entry, commit)
+	})
+}
+
+// matchesUsageFilter applies the same filter as usageOperationFilter on log entries that are not fetched with a query
+func matchesUsageFilter(entry monitor.LogEntry) bool {
+	_, tracked := usageOperations[entry.OperationName]
+
+	return tracked && isTrackedResponseType(entry.MetricResponseType) && slices.Contains(usageAuthenticationTypes, entry.AuthenticationType)
+}
+
+// commitLogEntry commits the statement of the log entry, unless the entry was already handled before the checkpoint of the storage account
+func commitLogEntry(ctx context.Context, configParams *config.ConfigMap, checkpoint *usageCheckpoint, resourceGroup, storageAccount string, entry monitor.LogEntry, commit func(st data_usage.Statement) error) error {
+	return checkpoint.handle(resourceGroup, storageAccount, entry, func(entry monitor.LogEntry) error {
+		statement, err := logEntryToStatement(ctx, configParams, resourceGroup, storageAccount, entry)
+		if err != nil || statement == nil {
+			return err
+		}
+
+		return commit(*statement)
+	})
+}
+
+// logEntryToStatement converts a storage log entry into a data usage statement. It returns nil if the operation is not tracked.
+func logEntryToStatement(ctx context.Context, configParams *config.ConfigMap, resourceGroup, storageAccount string, rt monitor.LogEntry) (*data_usage.Statement, error) {
+	operation, found := usageOperations[rt.OperationName]
+	if !found {
+		return nil, nil
+	}
+
+	// The object key is /<storage account>/<container>/<path>
+	keyParts := strings.Split(rt.ObjectKey, "/")
+	if len(keyParts) < 3 || keyParts[2] == "" {
+		logger.Debug(fmt.Sprintf("Ignoring log entry %q with object key %q without a container", rt.CorrelationId, rt.ObjectKey))
+
+		return nil, nil
+	}
+
+	objectPath, doType := rollupObjectPath(keyParts[2:], operation.doType, configParams.GetIntWithDefault(global.AzUsageRollupDepth, -1))
+
+	accessedResource := data_usage.UsageDataObjectItem{
+		DataObject: data_usage.UsageDataObjectReference{
+			FullName: fmt.Sprintf("%s/%s/%s/%s", configParams.GetString(global.AzSubscriptionId), resourceGroup, storageAccount, strings.Join(objectPath, "/")),
+			Type:     doType,
+		},
+		Permissions:      []string{rt.OperationName},
+		GlobalPermission: operation.action,
+	}
+
+	timeGenerated := rt.TimeGenerated
+	if timeGenerated.IsZero() {
+		return nil, fmt.Errorf("no TimeGenerated in log entry %q", rt.CorrelationId)
+	}
+
+	statement := &data_usage.Statement{
+		ExternalId:          rt.CorrelationId,
+		User:                usageUser(ctx, configParams, storageAccount, rt),
+		StartTime:           timeGenerated.Unix(),
+		EndTime:             timeGenerated.Unix(),
+		AccessedDataObjects: []data_usage.UsageDataObjectItem{accessedResource},
+		Success:             rt.MetricResponseType == "" || rt.MetricResponseType == "Success",
+		Status:              rt.StatusCode,
+		Query:               requestDetails(rt),
+		Bytes:               int(transferredBytes(operation.action, rt)),
+	}
+
+	if !statement.Success {
+		statement.Error = rt.StatusText
+		if statement.Error == "" {
+			statement.Error = rt.MetricResponseType
+		}
+	}
+
+	return statement, nil
+}
+
+// rollupObjectPath rolls the path of an object (starting with the container) up to the folder at the given depth below the container.
+// Depth 0 rolls up to the container, a negative depth keeps the object itself. Objects that are not deeper than the depth are kept as well.
+func rollupObjectPath(objectPath []string, doType string, depth int) ([]string, string) {
+	if depth < 0 || len(objectPath)-1 <= depth {
+		return objectPath, doType
+	}
+
+	if depth == 0 {
+		return objectPath[:1], Container
+	}
+
+	return objectPath[:depth+1], Folder
+}
+
+// usageUser returns the user of a request. Requests that are not authenticated with Entra ID are attributed to a synthetic user, based on their authentication type.
+func usageUser(ctx context.Context, configParams *config.ConfigMap, storageAccount string, rt monitor.LogEntry) string {
+	switch rt.AuthenticationType {
+	case "SAS":
+		if rt.AuthenticationHash != "" {
+			return fmt.Sprintf("sas:%s", rt.AuthenticationHash)
+		}
+
+		return fmt.Sprintf("sas:%s", storageAccount)
+	case "AccountKey":
+		return fmt.Sprintf("accountkey:%s", storageAccount)
+	case "Anonymous":
+		return "anonymous"
+	default:
+		if name := global.GetRequesterNameById(ctx, configParams.Parameters, rt.RequesterObjectId); name != "" {
+			return name
+		}
+
+		// Applications that can't be resolved (e.g. from another tenant) are still reported by their application ID
+		if rt.RequesterAppId != "" {
+			return fmt.Sprintf("app:%s", rt.RequesterAppId)
+		}
+
+		return ""
+	}
+}
+
+// transferredBytes returns the number of bytes that were read or written by the request
+func transferredBytes(action data_usage.ActionType, rt monitor.LogEntry) int64 {
+	if action == data_usage.Read {
+		return rt.ResponseBodySize
+	}
+
+	return rt.RequestBodySize
+}
+
+// requestDetails describes where the request came from and how long it took, so suspicious requests can be investigated
+// and access by people can be told apart from access by pipelines.
+func requestDetails(rt monitor.LogEntry) string {
+	var details []string
+
+	if tool := detectClientTool(rt.UserAgentHeader); tool != "" {
+		details = append(details, fmt.Sprintf("Client: %s", tool))
+	}
+
+	if rt.RequesterAppId != "" {
+		details = append(details, fmt.Sprintf("Application: %s", rt.RequesterAppId))
+	}
+
+	if rt.RequesterTenantId != "" {
+		details = append(details, fmt.Sprintf("Tenant: %s", rt.RequesterTenantId))
+	}
+
+	if rt.CallerIpAddress != "" {
+		details = append(details, fmt.Sprintf("Caller IP: %s", rt.CallerIpAddress))
+	}
+
+	if rt.UserAgentHeader != "" {
+		details = append(details, fmt.Sprintf("User agent: %s", rt.UserAgentHeader))
+	}
+
+	if rt.DurationMs > 0 {
+		details = append(details, fmt.Sprintf("Duration: %d ms (server: %d ms)", rt.DurationMs, rt.ServerLatencyMs))
+	}
+
+	return strings.Join(details, "; ")
+}
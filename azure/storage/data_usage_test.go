@@ -0,0 +1,374 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+func TestRollupObjectPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectPath []string
+		doType     string
+		depth      int
+		wantPath   []string
+		wantType   string
+	}{
+		{name: "No rollup", objectPath: []string{"c", "a", "b", "f.csv"}, doType: File, depth: -1, wantPath: []string{"c", "a", "b", "f.csv"}, wantType: File},
+		{name: "Container", objectPath: []string{"c", "a", "b", "f.csv"}, doType: File, depth: 0, wantPath: []string{"c"}, wantType: Container},
+		{name: "First level folder", objectPath: []string{"c", "a", "b", "f.csv"}, doType: File, depth: 1, wantPath: []string{"c", "a"}, wantType: Folder},
+		{name: "Second level folder", objectPath: []string{"c", "a", "b", "f.csv"}, doType: File, depth: 2, wantPath: []string{"c", "a", "b"}, wantType: Folder},
+		{name: "File above depth", objectPath: []string{"c", "f.csv"}, doType: File, depth: 2, wantPath: []string{"c", "f.csv"}, wantType: File},
+		{name: "Folder at depth", objectPath: []string{"c", "a", "b"}, doType: Folder, depth: 2, wantPath: []string{"c", "a", "b"}, wantType: Folder},
+		{name: "Folder below depth", objectPath: []string{"c", "a", "b"}, doType: Folder, depth: 1, wantPath: []string{"c", "a"}, wantType: Folder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, doType := rollupObjectPath(tt.objectPath, tt.doType, tt.depth)
+
+			assert.Equal(t, tt.wantPath, path)
+			assert.Equal(t, tt.wantType, doType)
+		})
+	}
+}
+
+func TestUsageOperations(t *testing.T) {
+	tests := []struct {
+		operation  string
+		wantAction data_usage.ActionType
+		wantType   string
+		wantFound  bool
+	}{
+		{operation: "GetBlob", wantAction: data_usage.Read, wantType: File, wantFound: true},
+		{operation: "PutBlob", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "PutBlockList", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "PutBlockFromURL", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "AppendFile", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "FlushFile", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "CreateFile", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "DeleteBlob", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "DeleteFile", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "DeleteDirectory", wantAction: data_usage.Write, wantType: Folder, wantFound: true},
+		{operation: "RenamePathFile", wantAction: data_usage.Write, wantType: File, wantFound: true},
+		{operation: "PutBlock"},
+		{operation: "GetBlobProperties"},
+		{operation: "ListBlobs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			operation, found := usageOperations[tt.operation]
+
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.wantAction, operation.action)
+			assert.Equal(t, tt.wantType, operation.doType)
+		})
+	}
+}
+
+func TestLogEntryToStatement(t *testing.T) {
+	timeGenerated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		entry  monitor.LogEntry
+		// want is the statement without the user and request details, nil if the entry is ignored
+		want    *data_usage.Statement
+		wantErr bool
+	}{
+		{
+			name:  "Read",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "GetBlob", ObjectKey: "/account/data/raw/a.csv", CorrelationId: "c1", MetricResponseType: "Success", StatusCode: "200", ResponseBodySize: 10, RequestBodySize: 1},
+			want: &data_usage.Statement{
+				ExternalId: "c1", StartTime: timeGenerated.Unix(), EndTime: timeGenerated.Unix(), Success: true, Status: "200", Bytes: 10,
+				AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/rg/account/data/raw/a.csv", Type: File},
+					Permissions:      []string{"GetBlob"},
+					GlobalPermission: data_usage.Read,
+				}},
+			},
+		},
+		{
+			name:  "Failed write",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "PutBlockList", ObjectKey: "/account/data/raw/a.csv", CorrelationId: "c2", MetricResponseType: "AuthorizationError", StatusCode: "403", ResponseBodySize: 10, RequestBodySize: 1},
+			want: &data_usage.Statement{
+				ExternalId: "c2", StartTime: timeGenerated.Unix(), EndTime: timeGenerated.Unix(), Status: "403", Error: "AuthorizationError", Bytes: 1,
+				AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/rg/account/data/raw/a.csv", Type: File},
+					Permissions:      []string{"PutBlockList"},
+					GlobalPermission: data_usage.Write,
+				}},
+			},
+		},
+		{
+			name:  "Failed read with status text",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "GetBlob", ObjectKey: "/account/data/raw/a.csv", CorrelationId: "c6", MetricResponseType: "ClientOtherError", StatusCode: "404", StatusText: "BlobNotFound"},
+			want: &data_usage.Statement{
+				ExternalId: "c6", StartTime: timeGenerated.Unix(), EndTime: timeGenerated.Unix(), Status: "404", Error: "BlobNotFound",
+				AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/rg/account/data/raw/a.csv", Type: File},
+					Permissions:      []string{"GetBlob"},
+					GlobalPermission: data_usage.Read,
+				}},
+			},
+		},
+		{
+			name:  "Deleted directory",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "DeleteDirectory", ObjectKey: "/account/data/raw/2024", CorrelationId: "c3", MetricResponseType: "Success"},
+			want: &data_usage.Statement{
+				ExternalId: "c3", StartTime: timeGenerated.Unix(), EndTime: timeGenerated.Unix(), Success: true,
+				AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/rg/account/data/raw/2024", Type: Folder},
+					Permissions:      []string{"DeleteDirectory"},
+					GlobalPermission: data_usage.Write,
+				}},
+			},
+		},
+		{
+			name:   "Rolled up to a folder",
+			params: map[string]string{global.AzUsageRollupDepth: "1"},
+			entry:  monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "DeleteDirectory", ObjectKey: "/account/data/raw/2024", CorrelationId: "c4", MetricResponseType: "Success"},
+			want: &data_usage.Statement{
+				ExternalId: "c4", StartTime: timeGenerated.Unix(), EndTime: timeGenerated.Unix(), Success: true,
+				AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/rg/account/data/raw", Type: Folder},
+					Permissions:      []string{"DeleteDirectory"},
+					GlobalPermission: data_usage.Write,
+				}},
+			},
+		},
+		{
+			name:   "Rolled up to the container",
+			params: map[string]string{global.AzUsageRollupDepth: "0"},
+			entry:  monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "GetBlob", ObjectKey: "/account/data/raw/a.csv", CorrelationId: "c5", MetricResponseType: "Success"},
+			want: &data_usage.Statement{
+				ExternalId: "c5", StartTime: timeGenerated.Unix(), EndTime: timeGenerated.Unix(), Success: true,
+				AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+					DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/rg/account/data", Type: Container},
+					Permissions:      []string{"GetBlob"},
+					GlobalPermission: data_usage.Read,
+				}},
+			},
+		},
+		{
+			name:  "Untracked operation",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "ListBlobs", ObjectKey: "/account/data"},
+		},
+		{
+			name:  "Empty object key",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "GetBlob"},
+		},
+		{
+			name:  "Object key without container",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "GetBlob", ObjectKey: "/account"},
+		},
+		{
+			name:  "Object key with an empty container",
+			entry: monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "GetBlob", ObjectKey: "/account/"},
+		},
+		{
+			name:    "No time",
+			entry:   monitor.LogEntry{OperationName: "GetBlob", ObjectKey: "/account/data/a.csv"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]string{global.AzSubscriptionId: "sub"}
+			for k, v := range tt.params {
+				params[k] = v
+			}
+
+			// Requests with an account key don't need a lookup of the user
+			tt.entry.AuthenticationType = "AccountKey"
+
+			statement, err := logEntryToStatement(context.Background(), &config.ConfigMap{Parameters: params}, "rg", "account", tt.entry)
+
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tt.want == nil {
+				assert.Nil(t, statement)
+
+				return
+			}
+
+			require.NotNil(t, statement)
+			assert.Equal(t, "accountkey:account", statement.User)
+
+			statement.User = ""
+			statement.Query = ""
+			assert.Equal(t, tt.want, statement)
+		})
+	}
+}
+
+func TestUsageUser(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry monitor.LogEntry
+		want  string
+	}{
+		{name: "SAS", entry: monitor.LogEntry{AuthenticationType: "SAS", AuthenticationHash: "key1(ABCDEF)"}, want: "sas:key1(ABCDEF)"},
+		{name: "SAS without hash", entry: monitor.LogEntry{AuthenticationType: "SAS"}, want: "sas:account"},
+		{name: "Account key", entry: monitor.LogEntry{AuthenticationType: "AccountKey", RequesterObjectId: "o1"}, want: "accountkey:account"},
+		{name: "Anonymous", entry: monitor.LogEntry{AuthenticationType: "Anonymous"}, want: "anonymous"},
+		{name: "Unresolved application", entry: monitor.LogEntry{AuthenticationType: "OAuth", RequesterAppId: "a1"}, want: "app:a1"},
+		{name: "Unknown requester", entry: monitor.LogEntry{AuthenticationType: "OAuth"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, usageUser(context.Background(), &config.ConfigMap{Parameters: map[string]string{}}, "account", tt.entry))
+		})
+	}
+}
+
+func TestIsTrackedResponseType(t *testing.T) {
+	tests := []struct {
+		responseType string
+		want         bool
+	}{
+		{responseType: "Success", want: true},
+		{responseType: "AuthorizationError", want: true},
+		{responseType: "SASAuthorizationError", want: true},
+		{responseType: "ClientOtherError", want: true},
+		{responseType: "ClientThrottlingError", want: true},
+		{responseType: "ServerOtherError", want: false},
+		{responseType: "ServerTimeoutError", want: false},
+		{responseType: "NetworkError", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.responseType, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTrackedResponseType(tt.responseType))
+		})
+	}
+}
+
+func TestMatchesUsageFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry monitor.LogEntry
+		want  bool
+	}{
+		{name: "Successful read", entry: monitor.LogEntry{OperationName: "GetBlob", MetricResponseType: "Success", AuthenticationType: "OAuth"}, want: true},
+		{name: "Denied write", entry: monitor.LogEntry{OperationName: "PutBlob", MetricResponseType: "AuthorizationError", AuthenticationType: "SAS"}, want: true},
+		{name: "Server error", entry: monitor.LogEntry{OperationName: "GetBlob", MetricResponseType: "ServerOtherError", AuthenticationType: "OAuth"}},
+		{name: "Untracked operation", entry: monitor.LogEntry{OperationName: "ListBlobs", MetricResponseType: "Success", AuthenticationType: "OAuth"}},
+		{name: "Untracked authentication", entry: monitor.LogEntry{OperationName: "GetBlob", MetricResponseType: "Success", AuthenticationType: "Kerberos"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchesUsageFilter(tt.entry))
+		})
+	}
+}
+
+func TestDataUsageSyncer_SyncStorageAccountsUsage(t *testing.T) {
+	const (
+		workspace1 = "/subscriptions/sub/resourceGroups/logs/providers/Microsoft.OperationalInsights/workspaces/one"
+		workspace2 = "/subscriptions/sub/resourceGroups/logs/providers/Microsoft.OperationalInsights/workspaces/two"
+	)
+
+	timeGenerated := time.Now().Add(-time.Hour).Truncate(time.Second)
+	startDate := timeGenerated.Add(-time.Hour)
+
+	configParams := &config.ConfigMap{Parameters: map[string]string{global.AzSubscriptionId: "sub", global.AzStateDirectory: t.TempDir()}}
+
+	entry := func(correlationId, resourceId, objectKey string) monitor.LogEntry {
+		return monitor.LogEntry{TimeGenerated: timeGenerated, OperationName: "GetBlob", ObjectKey: objectKey, CorrelationId: correlationId, ResourceId: resourceId, AuthenticationType: "AccountKey", MetricResponseType: "Success"}
+	}
+
+	settings := map[string]*monitor.ResourceDiagnosticSetting{
+		"a": {WorkspaceID: workspace1, ReadLogsEnabled: true},
+		"b": {WorkspaceID: workspace1, ReadLogsEnabled: true},
+		"c": {WorkspaceID: workspace2, ReadLogsEnabled: true},
+	}
+
+	monitorService := monitor.NewMockMonitorService(t)
+
+	for name, setting := range settings {
+		resourceGroup := "rg1"
+		if name == "c" {
+			resourceGroup = "rg2"
+		}
+
+		monitorService.EXPECT().GetResourceDiagnosticSetting(mock.Anything, configParams, resourceGroup, AzApiNamespace, "storageAccounts", name+"/blobServices/default/").Return(setting, nil).Once()
+	}
+
+	// An account of which the diagnostic settings can't be read is skipped
+	monitorService.EXPECT().GetResourceDiagnosticSetting(mock.Anything, configParams, "rg2", AzApiNamespace, "storageAccounts", "denied/blobServices/default/").Return(nil, errors.New("forbidden")).Once()
+
+	// The logs of a and b are fetched with a single query and split per account by their resource ID
+	monitorService.EXPECT().GetWorkspaceLogs(mock.Anything, configParams, workspace1, mock.Anything, startDate, mock.Anything).RunAndReturn(func(_ context.Context, _ *config.ConfigMap, _ string, query string, _ time.Time, handler func(monitor.LogEntry) error) error {
+		assert.Contains(t, query, `"/subscriptions/sub/resourcegroups/rg1/providers/Microsoft.Storage/storageAccounts/a/blobServices/default"`)
+		assert.Contains(t, query, `"/subscriptions/sub/resourcegroups/rg1/providers/Microsoft.Storage/storageAccounts/b/blobServices/default"`)
+		assert.NotContains(t, query, "storageAccounts/c")
+
+		for _, e := range []monitor.LogEntry{
+			entry("1", "/SUBSCRIPTIONS/SUB/RESOURCEGROUPS/RG1/PROVIDERS/MICROSOFT.STORAGE/STORAGEACCOUNTS/A/BLOBSERVICES/DEFAULT", "/a/data/1.csv"),
+			entry("2", "/subscriptions/sub/resourceGroups/rg1/providers/Microsoft.Storage/storageAccounts/b/blobServices/default", "/b/data/2.csv"),
+			entry("3", "/subscriptions/sub/resourceGroups/rg1/providers/Microsoft.Storage/storageAccounts/unknown/blobServices/default", "/unknown/data/3.csv"),
+			entry("4", "", "/a/data/4.csv"),
+		} {
+			err := handler(e)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}).Once()
+
+	// The workspace of c can't be resolved, so its logs are fetched for the storage account itself
+	monitorService.EXPECT().GetWorkspaceLogs(mock.Anything, configParams, workspace2, mock.Anything, startDate, mock.Anything).Return(errors.New("workspace not found")).Once()
+	monitorService.EXPECT().GetLogs(mock.Anything, configParams, mock.Anything, startDate, "rg2", AzApiNamespace, "storageAccounts", "c/blobServices/default/", mock.Anything).RunAndReturn(func(_ context.Context, _ *config.ConfigMap, _ string, _ time.Time, _, _, _, _ string, handler func(monitor.LogEntry) error) error {
+		return handler(entry("5", "", "/c/data/5.csv"))
+	}).Once()
+
+	queryBuilder, err := newUsageQueryBuilder(configParams)
+	require.NoError(t, err)
+
+	coverage, err := newUsageLogsCoverage(configParams)
+	require.NoError(t, err)
+
+	checkpoint, err := loadUsageCheckpoint(configParams, startDate)
+	require.NoError(t, err)
+
+	committed := make(map[string]string)
+
+	syncer := &DataUsageSyncer{}
+	err = syncer.syncStorageAccountsUsage(context.Background(), monitorService, queryBuilder, coverage, checkpoint, map[string][]string{"rg1": {"a", "b"}, "rg2": {"c", "denied"}}, configParams, func(st data_usage.Statement) error {
+		committed[st.ExternalId] = st.AccessedDataObjects[0].DataObject.FullName
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"1": "sub/rg1/a/data/1.csv",
+		"2": "sub/rg1/b/data/2.csv",
+		"5": "sub/rg2/c/data/5.csv",
+	}, committed)
+}
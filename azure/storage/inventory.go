@@ -0,0 +1,450 @@
+package storage
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/smithy-go/ptr"
+	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const (
+	// inventoryManifestSuffix is the suffix of the manifest of a report, which is stored as <yyyy>/<mm>/<dd>/<hh-mm-ss>/<rule>/<rule>-manifest.json
+	inventoryManifestSuffix = "-manifest.json"
+
+	// inventoryReportMaxAgeDays is the number of days in which the latest report is searched. Reports run daily or weekly, older reports are outdated.
+	inventoryReportMaxAgeDays = 8
+)
+
+var (
+	ErrInvalidInventoryReport     = errors.New("invalid blob inventory report")
+	ErrUnsupportedInventoryFormat = errors.New("unsupported blob inventory format")
+)
+
+// inventoryManifest is the manifest of a Blob Inventory report, which lists the files that contain the inventory
+type inventoryManifest struct {
+	Files []struct {
+		Blob string `json:"blob"`
+	} `json:"files"`
+	InventoryCompletionTime time.Time `json:"inventoryCompletionTime"`
+	RuleName                string    `json:"ruleName"`
+	Status                  string    `json:"status"`
+	RuleDefinition          struct {
+		Format     string `json:"format"`
+		ObjectType string `json:"objectType"`
+	} `json:"ruleDefinition"`
+}
+
+// inventoryReport is the latest report of a Blob Inventory rule, stored in the destination container of the rule
+type inventoryReport struct {
+	client   *container.Client
+	manifest *inventoryManifest
+	// files are the local copies of the files of the report
+	files []string
+}
+
+// latestInventoryReport returns the latest completed CSV report of the blob inventory policy of the storage account.
+// It returns nil if the storage account has no usable inventory, so the paths are listed instead.
+// The files of the report are downloaded before it is returned, so a report that can't be read never results in a partial sync. The caller needs to close the report.
+func latestInventoryReport(ctx context.Context, resourceGroup, storageAccount string, configMap *config.ConfigMap) (*inventoryReport, error) {
+	cred, err := global.CreateADClientSecretCredential(ctx, configMap.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a credential from a secret: %w", err)
+	}
+
+	policiesClient, err := armstorage.NewBlobInventoryPoliciesClient(configMap.GetString(global.AzSubscriptionId), cred, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := policiesClient.Get(ctx, resourceGroup, storageAccount, armstorage.BlobInventoryPolicyNameDefault, nil)
+
+	var responseError *azcore.ResponseError
+	if errors.As(err, &responseError) && responseError.StatusCode == http.StatusNotFound {
+		logger.Info(fmt.Sprintf("No blob inventory policy found for storage account %s", storageAccount))
+
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get blob inventory policy: %w", err)
+	}
+
+	if policy.Properties == nil || policy.Properties.Policy == nil || !ptr.ToBool(policy.Properties.Policy.Enabled) {
+		logger.Info(fmt.Sprintf("No enabled blob inventory policy found for storage account %s", storageAccount))
+
+		return nil, nil
+	}
+
+	rules, err := csvInventoryRules(storageAccount, policy.Properties.Policy.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *inventoryReport
+
+	for _, rule := range rules {
+		client, err := createBlobContainerClient(ctx, storageAccount, ptr.ToString(rule.Destination), configMap.Parameters)
+		if err != nil {
+			return nil, err
+		}
+
+		report, err := latestRuleReport(ctx, client, ptr.ToString(rule.Name))
+		if err != nil {
+			return nil, err
+		}
+
+		if report != nil && (latest == nil || report.manifest.InventoryCompletionTime.After(latest.manifest.InventoryCompletionTime)) {
+			latest = report
+		}
+	}
+
+	if latest == nil {
+		logger.Info(fmt.Sprintf("No completed CSV blob inventory report found for storage account %s", storageAccount))
+
+		return nil, nil
+	}
+
+	err = latest.download(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("download blob inventory report: %w", err)
+	}
+
+	return latest, nil
+}
+
+// csvInventoryRules returns the enabled rules of an inventory policy that report on blobs in CSV format.
+// An error is returned if the blobs are only reported in another format (i.e. Parquet), as those reports can't be read.
+func csvInventoryRules(storageAccount string, rules []*armstorage.BlobInventoryPolicyRule) ([]*armstorage.BlobInventoryPolicyRule, error) {
+	var csvRules []*armstorage.BlobInventoryPolicyRule
+	var unsupported []string
+
+	for _, rule := range rules {
+		if rule == nil || !ptr.ToBool(rule.Enabled) || rule.Definition == nil || rule.Definition.ObjectType == nil || *rule.Definition.ObjectType != armstorage.ObjectTypeBlob {
+			continue
+		}
+
+		if rule.Definition.Format == nil || *rule.Definition.Format != armstorage.FormatCSV {
+			format := ""
+			if rule.Definition.Format != nil {
+				format = string(*rule.Definition.Format)
+			}
+
+			logger.Warn(fmt.Sprintf("Blob inventory rule %q of storage account %s produces %s reports, only CSV reports are supported", ptr.ToString(rule.Name), storageAccount, format))
+
+			unsupported = append(unsupported, fmt.Sprintf("%q (%s)", ptr.ToString(rule.Name), format))
+
+			continue
+		}
+
+		csvRules = append(csvRules, rule)
+	}
+
+	if len(csvRules) == 0 && len(unsupported) > 0 {
+		return nil, fmt.Errorf("%w: the blob inventory rules %s of storage account %s don't produce CSV reports, which is the only supported format", ErrUnsupportedInventoryFormat, strings.Join(unsupported, ", "), storageAccount)
+	}
+
+	return csvRules, nil
+}
+
+// latestRuleReport returns the latest successful report of the inventory rule in the destination container.
+// The days are listed from new to old and the search stops at the first successful report, as the latest report can still be running.
+func latestRuleReport(ctx context.Context, client *container.Client, ruleName string) (*inventoryReport, error) {
+	for _, dayPrefix := range inventoryDayPrefixes(time.Now()) {
+		var runs []string
+
+		pager := client.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{Prefix: &dayPrefix})
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, prefix := range page.Segment.BlobPrefixes {
+				runs = append(runs, ptr.ToString(prefix.Name))
+			}
+		}
+
+		for _, name := range ruleManifestNames(runs, ruleName) {
+			resp, err := client.NewBlobClient(name).DownloadStream(ctx, nil)
+			if bloberror.HasCode(err, bloberror.BlobNotFound) {
+				// The run was for another rule
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			manifest, err := parseInventoryManifest(resp.Body)
+			resp.Body.Close()
+
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+
+			if strings.EqualFold(manifest.Status, "Succeeded") {
+				return &inventoryReport{client: client, manifest: manifest}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// inventoryDayPrefixes returns the prefixes of the days on which the latest report can have run, from new to old
+func inventoryDayPrefixes(now time.Time) []string {
+	prefixes := make([]string, 0, inventoryReportMaxAgeDays)
+
+	for i := 0; i < inventoryReportMaxAgeDays; i++ {
+		prefixes = append(prefixes, now.UTC().AddDate(0, 0, -i).Format("2006/01/02/"))
+	}
+
+	return prefixes
+}
+
+// ruleManifestNames returns the names of the manifests of the rule in the runs (<yyyy>/<mm>/<dd>/<hh-mm-ss>/) of a day, from the newest to the oldest run
+func ruleManifestNames(runs []string, ruleName string) []string {
+	// The time in the path sorts lexicographically
+	sorted := append([]string{}, runs...)
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+	manifests := make([]string, 0, len(sorted))
+	for _, run := range sorted {
+		manifests = append(manifests, fmt.Sprintf("%s%s/%s%s", run, ruleName, ruleName, inventoryManifestSuffix))
+	}
+
+	return manifests
+}
+
+func parseInventoryManifest(r io.Reader) (*inventoryManifest, error) {
+	var manifest inventoryManifest
+
+	err := json.NewDecoder(r).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInventoryReport, err.Error())
+	}
+
+	if manifest.RuleDefinition.Format != "" && !strings.EqualFold(manifest.RuleDefinition.Format, string(armstorage.FormatCSV)) {
+		return nil, fmt.Errorf("%w: %q, only CSV reports are supported", ErrUnsupportedInventoryFormat, manifest.RuleDefinition.Format)
+	}
+
+	return &manifest, nil
+}
+
+// download copies the files of the report to local files. The files are validated while they are downloaded, so reading them afterwards doesn't fail halfway.
+// This needs temporary disk space for the full report, but streaming would emit the data objects of a report that turns out to be broken halfway,
+// and the data objects that are not emitted are removed from Raito.
+func (r *inventoryReport) download(ctx context.Context) error {
+	for _, file := range r.manifest.Files {
+		err := r.downloadFile(ctx, file.Blob)
+		if err != nil {
+			r.close()
+
+			return fmt.Errorf("%s: %w", file.Blob, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *inventoryReport) downloadFile(ctx context.Context, blob string) error {
+	local, err := os.CreateTemp("", "blob-inventory-*.csv")
+	if err != nil {
+		return err
+	}
+
+	defer local.Close()
+
+	r.files = append(r.files, local.Name())
+
+	resp, err := r.client.NewBlobClient(blob).DownloadStream(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return ParseInventoryCsv(io.TeeReader(resp.Body, local), func(string, bool) error { return nil })
+}
+
+// read passes every current blob in the downloaded files of the report to the handler
+func (r *inventoryReport) read(handler func(name string, isFolder bool) error) error {
+	for _, name := range r.files {
+		err := readInventoryFile(name, handler)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readInventoryFile(name string, handler func(name string, isFolder bool) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return ParseInventoryCsv(f, handler)
+}
+
+// close removes the downloaded files of the report
+func (r *inventoryReport) close() {
+	for _, name := range r.files {
+		err := os.Remove(name)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("Unable to remove downloaded blob inventory file %s: %s", name, err.Error()))
+		}
+	}
+
+	r.files = nil
+}
+
+// ParseInventoryCsv parses a CSV file of a Blob Inventory report and passes the name (<container>/<path>) of every current blob to the handler.
+// Deleted blobs, snapshots and previous versions are skipped. Directories of accounts with a hierarchical namespace are marked with hdi_isfolder.
+func ParseInventoryCsv(r io.Reader, handler func(name string, isFolder bool) error) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%w: read header: %s", ErrInvalidInventoryReport, err.Error())
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	nameColumn, found := columns["name"]
+	if !found {
+		return fmt.Errorf("%w: no Name column", ErrInvalidInventoryReport)
+	}
+
+	field := func(record []string, column string) string {
+		if i, found := columns[column]; found && i < len(record) {
+			return record[i]
+		}
+
+		return ""
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidInventoryReport, err.Error())
+		}
+
+		if strings.EqualFold(field(record, "deleted"), "true") || strings.EqualFold(field(record, "iscurrentversion"), "false") || field(record, "snapshot") != "" {
+			continue
+		}
+
+		err = handler(record[nameColumn], strings.EqualFold(field(record, "hdi_isfolder"), "true"))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// inventoryTree builds the data objects of the containers of a storage account from the blobs in an inventory report.
+// Folders that only exist as prefix of a blob name (accounts without a hierarchical namespace) are added as well.
+type inventoryTree struct {
+	storageAccount string
+	// containers are the containers of the storage account that are synced
+	containers     map[string]bool
+	limits         dataObjectLimits
+	shouldHandle   func(fullName string) bool
+	addDataObjects func(dataObjects ...*ds.DataObject) error
+
+	folders map[string]bool
+	// files is the number of files that were added per folder
+	files map[string]int
+}
+
+func newInventoryTree(storageAccount string, containers map[string]bool, configMap *config.ConfigMap, shouldHandle func(fullName string) bool, addDataObjects func(dataObjects ...*ds.DataObject) error) *inventoryTree {
+	return &inventoryTree{
+		storageAccount: storageAccount,
+		containers:     containers,
+		limits:         newDataObjectLimits(configMap),
+		shouldHandle:   shouldHandle,
+		addDataObjects: addDataObjects,
+		folders:        make(map[string]bool),
+		files:          make(map[string]int),
+	}
+}
+
+// add adds the data objects for a blob in the report and the folders above it
+func (t *inventoryTree) add(name string, isFolder bool) error {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	if len(parts) < 2 || !t.containers[parts[0]] {
+		return nil
+	}
+
+	parent := fmt.Sprintf("%s/%s", t.storageAccount, parts[0])
+	path := parts[1:]
+
+	folderCount := len(path) - 1
+	if isFolder {
+		folderCount = len(path)
+	}
+
+	for depth := 1; depth <= folderCount; depth++ {
+		if !t.limits.allowsFolder(depth) {
+			return nil
+		}
+
+		fullName := fmt.Sprintf("%s/%s", parent, path[depth-1])
+
+		if !t.folders[fullName] {
+			t.folders[fullName] = true
+
+			err := t.addDataObject(fullName, path[depth-1], Folder, parent)
+			if err != nil {
+				return err
+			}
+		}
+
+		parent = fullName
+	}
+
+	if isFolder || !t.limits.allowsFile(t.files[parent]) {
+		return nil
+	}
+
+	t.files[parent]++
+
+	return t.addDataObject(fmt.Sprintf("%s/%s", parent, path[len(path)-1]), path[len(path)-1], File, parent)
+}
+
+func (t *inventoryTree) addDataObject(fullName, name, doType, parent string) error {
+	if !t.shouldHandle(fullName) {
+		return nil
+	}
+
+	return t.addDataObjects(&ds.DataObject{
+		ExternalId:       fullName,
+		Name:             name,
+		FullName:         fullName,
+		Type:             doType,
+		ParentExternalId: parent,
+	})
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/aws/smithy-go/ptr"
+	ds "github.com/raito-io/cli/base/data_source"
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+func TestParseInventoryManifest(t *testing.T) {
+	f, err := os.Open("testdata/inventory/daily-manifest.json")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	manifest, err := parseInventoryManifest(f)
+	require.NoError(t, err)
+
+	assert.Equal(t, "daily", manifest.RuleName)
+	assert.Equal(t, "Succeeded", manifest.Status)
+	assert.Equal(t, time.Date(2024, 1, 2, 1, 12, 31, 0, time.UTC), manifest.InventoryCompletionTime)
+	require.Len(t, manifest.Files, 1)
+	assert.Equal(t, "2024/01/02/01-00-00/daily/daily_1000000_0.csv", manifest.Files[0].Blob)
+
+	_, err = parseInventoryManifest(strings.NewReader(`{"ruleName": "daily", "ruleDefinition": {"format": "parquet"}}`))
+	assert.ErrorIs(t, err, ErrUnsupportedInventoryFormat)
+
+	_, err = parseInventoryManifest(strings.NewReader(`{"ruleName": `))
+	assert.ErrorIs(t, err, ErrInvalidInventoryReport)
+}
+
+func TestCsvInventoryRules(t *testing.T) {
+	rule := func(name string, enabled bool, objectType armstorage.ObjectType, format armstorage.Format) *armstorage.BlobInventoryPolicyRule {
+		return &armstorage.BlobInventoryPolicyRule{
+			Name:    ptr.String(name),
+			Enabled: ptr.Bool(enabled),
+			Definition: &armstorage.BlobInventoryPolicyDefinition{
+				ObjectType: &objectType,
+				Format:     &format,
+			},
+		}
+	}
+
+	daily := rule("daily", true, armstorage.ObjectTypeBlob, armstorage.FormatCSV)
+	weekly := rule("weekly", true, armstorage.ObjectTypeBlob, armstorage.FormatParquet)
+	containers := rule("containers", true, armstorage.ObjectTypeContainer, armstorage.FormatCSV)
+	disabled := rule("disabled", false, armstorage.ObjectTypeBlob, armstorage.FormatCSV)
+
+	rules, err := csvInventoryRules("account", []*armstorage.BlobInventoryPolicyRule{daily, weekly, containers, disabled})
+	require.NoError(t, err)
+	assert.Equal(t, []*armstorage.BlobInventoryPolicyRule{daily}, rules)
+
+	rules, err = csvInventoryRules("account", []*armstorage.BlobInventoryPolicyRule{containers, disabled})
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	_, err = csvInventoryRules("account", []*armstorage.BlobInventoryPolicyRule{weekly, containers})
+	require.ErrorIs(t, err, ErrUnsupportedInventoryFormat)
+	assert.Contains(t, err.Error(), `"weekly" (Parquet)`)
+}
+
+func TestInventoryDayPrefixes(t *testing.T) {
+	prefixes := inventoryDayPrefixes(time.Date(2024, 3, 2, 23, 0, 0, 0, time.FixedZone("CET", -2*60*60)))
+
+	require.Len(t, prefixes, inventoryReportMaxAgeDays)
+	assert.Equal(t, []string{"2024/03/03/", "2024/03/02/", "2024/03/01/", "2024/02/29/"}, prefixes[:4])
+}
+
+func TestRuleManifestNames(t *testing.T) {
+	runs := []string{"2024/01/02/01-00-00/", "2024/01/02/13-00-00/"}
+
+	assert.Equal(t, []string{"2024/01/02/13-00-00/daily/daily-manifest.json", "2024/01/02/01-00-00/daily/daily-manifest.json"}, ruleManifestNames(runs, "daily"))
+	assert.Empty(t, ruleManifestNames(nil, "daily"))
+}
+
+func TestParseInventoryCsv(t *testing.T) {
+	f, err := os.Open("testdata/inventory/daily_1000000_0.csv")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var names []string
+
+	err = ParseInventoryCsv(f, func(name string, isFolder bool) error {
+		if isFolder {
+			name += "/"
+		}
+
+		names = append(names, name)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"data/raw/", "data/raw/2024/", "data/raw/2024/01.csv", "data/raw/2024/03.csv", "data/README.md", "data/curated/sales, 2024/orders.parquet", "other/file.txt"}, names)
+
+	err = ParseInventoryCsv(strings.NewReader("Last-Modified\n2024-01-01T10:00:00Z\n"), func(string, bool) error { return nil })
+	assert.ErrorIs(t, err, ErrInvalidInventoryReport)
+}
+
+func TestInventoryTree(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   []string
+	}{
+		{
+			name: "All folders and files",
+			want: []string{
+				"folder sa/data/raw (sa/data)",
+				"folder sa/data/raw/2024 (sa/data/raw)",
+				"file sa/data/raw/2024/01.csv (sa/data/raw/2024)",
+				"file sa/data/raw/2024/03.csv (sa/data/raw/2024)",
+				"file sa/data/README.md (sa/data)",
+				"folder sa/data/curated (sa/data)",
+				"folder sa/data/curated/sales, 2024 (sa/data/curated)",
+				"file sa/data/curated/sales, 2024/orders.parquet (sa/data/curated/sales, 2024)",
+			},
+		},
+		{
+			name:   "Files per folder",
+			params: map[string]string{global.AzDataSourceMaxFilesPerFolder: "1"},
+			want: []string{
+				"folder sa/data/raw (sa/data)",
+				"folder sa/data/raw/2024 (sa/data/raw)",
+				"file sa/data/raw/2024/01.csv (sa/data/raw/2024)",
+				"file sa/data/README.md (sa/data)",
+				"folder sa/data/curated (sa/data)",
+				"folder sa/data/curated/sales, 2024 (sa/data/curated)",
+				"file sa/data/curated/sales, 2024/orders.parquet (sa/data/curated/sales, 2024)",
+			},
+		},
+		{
+			name:   "Folder depth",
+			params: map[string]string{global.AzDataSourceMaxFolderDepth: "1"},
+			want: []string{
+				"folder sa/data/raw (sa/data)",
+				"file sa/data/README.md (sa/data)",
+				"folder sa/data/curated (sa/data)",
+			},
+		},
+		{
+			name:   "Without files",
+			params: map[string]string{global.AzDataSourceMaxFolderDepth: "1", global.AzDataSourceIncludeFiles: "false"},
+			want: []string{
+				"folder sa/data/raw (sa/data)",
+				"folder sa/data/curated (sa/data)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+
+			tree := newInventoryTree("sa", map[string]bool{"data": true}, &config.ConfigMap{Parameters: tt.params}, func(string) bool { return true }, func(dataObjects ...*ds.DataObject) error {
+				for _, do := range dataObjects {
+					got = append(got, do.Type+" "+do.FullName+" ("+do.ParentExternalId+")")
+				}
+
+				return nil
+			})
+
+			f, err := os.Open("testdata/inventory/daily_1000000_0.csv")
+			require.NoError(t, err)
+
+			defer f.Close()
+
+			require.NoError(t, ParseInventoryCsv(f, tree.add))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
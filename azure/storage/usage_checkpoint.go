@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const (
+	usageCheckpointStateName = "usage-checkpoint"
+
+	// usageCheckpointOverlap is the window before the checkpoint that is queried again, as log entries are not ingested in order and can arrive after later entries were handled already
+	usageCheckpointOverlap = 30 * time.Minute
+)
+
+// usageResourceCheckpoint is the high-water mark of the logs of a storage account that were handled in previous syncs
+type usageResourceCheckpoint struct {
+	LastTimeGenerated time.Time `json:"lastTimeGenerated"`
+	// CorrelationIds are the requests in the overlap window before LastTimeGenerated that were handled already, with their timestamp
+	CorrelationIds map[string]time.Time `json:"correlationIds,omitempty"`
+}
+
+// usageCheckpoint keeps track of the logs that were handled per storage account, so every storage account is queried from its own checkpoint.
+// The overlap window before the checkpoint is queried again to pick up late entries. Entries that were handled before are skipped, so overlapping queries never result in duplicate statements.
+type usageCheckpoint struct {
+	path string
+
+	// defaultStart is the start of storage accounts without a checkpoint
+	defaultStart time.Time
+	windowStart  time.Time
+	// previous is the checkpoint at the start of the sync. Entries are not sorted, so they are always compared with the previous checkpoint.
+	previous map[string]usageResourceCheckpoint
+
+	Resources map[string]*usageResourceCheckpoint `json:"resources"`
+}
+
+// loadUsageCheckpoint reads the checkpoint of the previous syncs.
+// Storage accounts that were added since the checkpoint was created are synced for the full data usage window.
+// If there is no checkpoint yet, the usage is synced from startDate, so the usage that was synced before checkpoints existed is not duplicated.
+func loadUsageCheckpoint(configParams *config.ConfigMap, startDate time.Time) (*usageCheckpoint, error) {
+	path, err := global.StateFilePath(configParams.Parameters, usageCheckpointStateName)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &usageCheckpoint{
+		path:        path,
+		windowStart: global.DataUsageWindowStart(configParams),
+	}
+
+	err = global.LoadState(path, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint.defaultStart = checkpoint.windowStart
+
+	if checkpoint.Resources == nil {
+		checkpoint.Resources = make(map[string]*usageResourceCheckpoint)
+		checkpoint.defaultStart = startDate
+	}
+
+	checkpoint.previous = make(map[string]usageResourceCheckpoint, len(checkpoint.Resources))
+	for key, resource := range checkpoint.Resources {
+		checkpoint.previous[key] = usageResourceCheckpoint{LastTimeGenerated: resource.LastTimeGenerated, CorrelationIds: maps.Clone(resource.CorrelationIds)}
+	}
+
+	return checkpoint, nil
+}
+
+func usageCheckpointKey(resourceGroup, storageAccount string) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s", resourceGroup, storageAccount))
+}
+
+// start returns the time from which the logs of the storage account need to be synced
+func (c *usageCheckpoint) start(resourceGroup, storageAccount string) time.Time {
+	resource, found := c.previous[usageCheckpointKey(resourceGroup, storageAccount)]
+	if !found {
+		return c.defaultStart
+	}
+
+	start := resource.LastTimeGenerated.Add(-usageCheckpointOverlap)
+	if start.Before(c.windowStart) {
+		return c.windowStart
+	}
+
+	return start
+}
+
+// earliestStart returns the earliest start of the given storage accounts, to query their logs at once
+func (c *usageCheckpoint) earliestStart(storageAccounts []usageStorageAccount) time.Time {
+	var earliest time.Time
+
+	for i, storageAccount := range storageAccounts {
+		start := c.start(storageAccount.resourceGroup, storageAccount.name)
+		if i == 0 || start.Before(earliest) {
+			earliest = start
+		}
+	}
+
+	return earliest
+}
+
+// handle passes the entry to the handler if it was not handled in a previous sync and records it in the checkpoint of the storage account.
+// The entry is only recorded if the handler succeeds, so entries that were rejected (e.g. because the maximum file size is reached) are handled again in the next sync.
+func (c *usageCheckpoint) handle(resourceGroup, storageAccount string, entry monitor.LogEntry, handler func(entry monitor.LogEntry) error) error {
+	timeGenerated := entry.TimeGenerated
+	if timeGenerated.IsZero() {
+		// Entries without a timestamp can't be checkpointed, the handler reports them
+		return handler(entry)
+	}
+
+	key := usageCheckpointKey(resourceGroup, storageAccount)
+
+	if timeGenerated.Before(c.start(resourceGroup, storageAccount)) {
+		return nil
+	}
+
+	if _, handled := c.previous[key].CorrelationIds[entry.CorrelationId]; handled {
+		return nil
+	}
+
+	err := handler(entry)
+	if err != nil {
+		return err
+	}
+
+	resource := c.Resources[key]
+	if resource == nil {
+		resource = &usageResourceCheckpoint{LastTimeGenerated: timeGenerated}
+		c.Resources[key] = resource
+	}
+
+	if resource.CorrelationIds == nil {
+		resource.CorrelationIds = make(map[string]time.Time)
+	}
+
+	resource.CorrelationIds[entry.CorrelationId] = timeGenerated
+
+	if timeGenerated.After(resource.LastTimeGenerated) {
+		resource.LastTimeGenerated = timeGenerated
+	}
+
+	return nil
+}
+
+// save persists the checkpoint. It should only be called once the handled entries are written, so failed syncs are retried from the previous checkpoint.
+// Requests before the overlap window are not queried anymore, so they are removed from the checkpoint.
+func (c *usageCheckpoint) save() error {
+	for _, resource := range c.Resources {
+		overlapStart := resource.LastTimeGenerated.Add(-usageCheckpointOverlap)
+
+		maps.DeleteFunc(resource.CorrelationIds, func(_ string, timeGenerated time.Time) bool {
+			return timeGenerated.Before(overlapStart)
+		})
+	}
+
+	return global.SaveState(c.path, c)
+}
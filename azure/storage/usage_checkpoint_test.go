@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+func TestUsageCheckpoint(t *testing.T) {
+	configParams := &config.ConfigMap{Parameters: map[string]string{
+		global.AzSubscriptionId: "sub",
+		global.AzStateDirectory: t.TempDir(),
+		global.DataUsageWindow:  "10",
+	}}
+
+	windowStart := global.DataUsageWindowStart(configParams)
+	startDate := windowStart.Add(48 * time.Hour)
+	t1 := startDate.Add(time.Hour)
+	t2 := startDate.Add(2 * time.Hour)
+
+	entry := func(timeGenerated time.Time, correlationId string) monitor.LogEntry {
+		return monitor.LogEntry{TimeGenerated: timeGenerated, CorrelationId: correlationId}
+	}
+
+	var handled []string
+
+	handler := func(entry monitor.LogEntry) error {
+		handled = append(handled, entry.CorrelationId)
+
+		return nil
+	}
+
+	// Without a checkpoint, the usage is synced from the start date
+	checkpoint, err := loadUsageCheckpoint(configParams, startDate)
+	require.NoError(t, err)
+
+	assert.Equal(t, startDate, checkpoint.start("rg", "account"))
+
+	require.NoError(t, checkpoint.handle("rg", "account", entry(startDate.Add(-time.Minute), "before"), handler))
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t2, "b"), handler))
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t1, "a"), handler))
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t2, "c"), handler))
+
+	assert.Equal(t, []string{"b", "a", "c"}, handled)
+	require.NoError(t, checkpoint.save())
+
+	// The next sync starts from the overlap window before the last handled entry and skips the entries that were handled already
+	handled = nil
+
+	checkpoint, err = loadUsageCheckpoint(configParams, startDate)
+	require.NoError(t, err)
+
+	assert.True(t, t2.Add(-usageCheckpointOverlap).Equal(checkpoint.start("rg", "ACCOUNT")))
+	assert.Equal(t, windowStart, checkpoint.start("rg", "new"))
+	assert.Equal(t, windowStart, checkpoint.earliestStart([]usageStorageAccount{{resourceGroup: "rg", name: "account"}, {resourceGroup: "rg", name: "new"}}))
+
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t1, "late-before-overlap"), handler))
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t2.Add(-time.Minute), "late"), handler))
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t2, "c"), handler))
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t2, "d"), handler))
+	require.NoError(t, checkpoint.handle("rg", "new", entry(windowStart.Add(time.Hour), "e"), handler))
+
+	assert.Equal(t, []string{"late", "d", "e"}, handled)
+
+	// Entries that are rejected by the handler are not recorded, so they are handled again in the next sync
+	err = checkpoint.handle("rg", "account", entry(t2.Add(time.Minute), "rejected"), func(monitor.LogEntry) error {
+		return global.ErrMaxUsageFileSizeReached
+	})
+	require.ErrorIs(t, err, global.ErrMaxUsageFileSizeReached)
+
+	assert.True(t, t2.Equal(checkpoint.Resources["rg/account"].LastTimeGenerated))
+	assert.NotContains(t, checkpoint.Resources["rg/account"].CorrelationIds, "rejected")
+
+	// Without saving, the next sync starts from the same checkpoint again
+	checkpoint, err = loadUsageCheckpoint(configParams, startDate)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"b", "c"}, slices.Collect(maps.Keys(checkpoint.Resources["rg/account"].CorrelationIds)))
+
+	// Saving removes the requests before the overlap window
+	require.NoError(t, checkpoint.handle("rg", "account", entry(t2.Add(time.Hour), "f"), handler))
+	require.NoError(t, checkpoint.save())
+
+	checkpoint, err = loadUsageCheckpoint(configParams, startDate)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"f"}, slices.Collect(maps.Keys(checkpoint.Resources["rg/account"].CorrelationIds)))
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const (
+	autoEnableUsageLogsOff    = "off"
+	autoEnableUsageLogsReport = "report"
+	autoEnableUsageLogsEnable = "enable"
+)
+
+var ErrInvalidAutoEnableUsageLogs = errors.New("invalid auto enable usage logs configuration")
+
+// usageLogsCoverage keeps track of the storage accounts without read logs in a diagnostic setting and, if configured, enables their logs.
+type usageLogsCoverage struct {
+	mode      string
+	workspace string
+	uncovered []usageStorageAccount
+}
+
+func newUsageLogsCoverage(configParams *config.ConfigMap) (*usageLogsCoverage, error) {
+	mode := strings.ToLower(configParams.GetStringWithDefault(global.AzAutoEnableUsageLogs, autoEnableUsageLogsOff))
+	workspace := configParams.GetStringWithDefault(global.AzAutoEnableUsageLogsWorkspace, "")
+
+	switch mode {
+	case autoEnableUsageLogsOff, autoEnableUsageLogsReport:
+	case autoEnableUsageLogsEnable:
+		if _, _, found := monitor.ParseResourceId(workspace, "workspaces"); !found {
+			return nil, fmt.Errorf("%w: %s must be the resource ID of a Log Analytics workspace when %s is %q", ErrInvalidAutoEnableUsageLogs, global.AzAutoEnableUsageLogsWorkspace, global.AzAutoEnableUsageLogs, autoEnableUsageLogsEnable)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q, expected %q, %q or %q", ErrInvalidAutoEnableUsageLogs, mode, autoEnableUsageLogsOff, autoEnableUsageLogsReport, autoEnableUsageLogsEnable)
+	}
+
+	return &usageLogsCoverage{mode: mode, workspace: workspace}, nil
+}
+
+// check registers the storage account as uncovered if its blob service has no diagnostic setting with read logs
+func (c *usageLogsCoverage) check(setting *monitor.ResourceDiagnosticSetting, resourceGroup, storageAccount string) {
+	if c.mode == autoEnableUsageLogsOff || (setting != nil && setting.ReadLogsEnabled) {
+		return
+	}
+
+	c.uncovered = append(c.uncovered, usageStorageAccount{resourceGroup: resourceGroup, name: storageAccount})
+}
+
+// apply reports the uncovered storage accounts or creates a diagnostic setting for them.
+// Logs are only available from the moment the setting is created, so the usage of these accounts is only complete from the next sync onwards.
+func (c *usageLogsCoverage) apply(ctx context.Context, monitorService monitor.MonitorService, configParams *config.ConfigMap) {
+	if len(c.uncovered) == 0 {
+		return
+	}
+
+	if c.mode == autoEnableUsageLogsReport {
+		names := make([]string, 0, len(c.uncovered))
+		for _, storageAccount := range c.uncovered {
+			names = append(names, fmt.Sprintf("%s/%s", storageAccount.resourceGroup, storageAccount.name))
+		}
+
+		logger.Warn(fmt.Sprintf("The following storage accounts have no diagnostic setting that sends read logs to Azure Monitor, so their data usage is incomplete: %s", strings.Join(names, ", ")))
+
+		return
+	}
+
+	for _, storageAccount := range c.uncovered {
+		err := monitorService.EnableLogs(ctx, configParams, storageAccount.resourceGroup, AzApiNamespace, "storageAccounts", fmt.Sprintf("%s/blobServices/default/", storageAccount.name), c.workspace)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to enable the usage logs of storage account %s/%s: %s", storageAccount.resourceGroup, storageAccount.name, err.Error()))
+
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("Enabled the usage logs of storage account %s/%s, its usage will be available from the next sync onwards", storageAccount.resourceGroup, storageAccount.name))
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+const testWorkspace = "/subscriptions/sub/resourceGroups/logs/providers/Microsoft.OperationalInsights/workspaces/usage"
+
+func TestNewUsageLogsCoverage(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]string
+		wantMode string
+		wantErr  bool
+	}{
+		{name: "Off by default", params: map[string]string{}, wantMode: autoEnableUsageLogsOff},
+		{name: "Report", params: map[string]string{global.AzAutoEnableUsageLogs: "report"}, wantMode: autoEnableUsageLogsReport},
+		{name: "Enable", params: map[string]string{global.AzAutoEnableUsageLogs: "enable", global.AzAutoEnableUsageLogsWorkspace: testWorkspace}, wantMode: autoEnableUsageLogsEnable},
+		{name: "Enable without workspace", params: map[string]string{global.AzAutoEnableUsageLogs: "enable"}, wantErr: true},
+		{name: "Unknown mode", params: map[string]string{global.AzAutoEnableUsageLogs: "always"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coverage, err := newUsageLogsCoverage(&config.ConfigMap{Parameters: tt.params})
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAutoEnableUsageLogs)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMode, coverage.mode)
+		})
+	}
+}
+
+func TestUsageLogsCoverage_Apply(t *testing.T) {
+	configParams := &config.ConfigMap{Parameters: map[string]string{global.AzAutoEnableUsageLogs: "enable", global.AzAutoEnableUsageLogsWorkspace: testWorkspace}}
+
+	coverage, err := newUsageLogsCoverage(configParams)
+	require.NoError(t, err)
+
+	coverage.check(nil, "rg", "nosetting")
+	coverage.check(&monitor.ResourceDiagnosticSetting{WriteLogsEnabled: true}, "rg", "noread")
+	coverage.check(&monitor.ResourceDiagnosticSetting{ReadLogsEnabled: true, WorkspaceID: testWorkspace}, "rg", "covered")
+
+	monitorService := monitor.NewMockMonitorService(t)
+	monitorService.EXPECT().EnableLogs(mock.Anything, configParams, "rg", AzApiNamespace, "storageAccounts", "nosetting/blobServices/default/", testWorkspace).Return(nil).Once()
+	monitorService.EXPECT().EnableLogs(mock.Anything, configParams, "rg", AzApiNamespace, "storageAccounts", "noread/blobServices/default/", testWorkspace).Return(errors.New("forbidden")).Once()
+
+	coverage.apply(context.Background(), monitorService, configParams)
+}
+
+func TestUsageLogsCoverage_Report(t *testing.T) {
+	configParams := &config.ConfigMap{Parameters: map[string]string{global.AzAutoEnableUsageLogs: "report"}}
+
+	coverage, err := newUsageLogsCoverage(configParams)
+	require.NoError(t, err)
+
+	coverage.check(nil, "rg", "nosetting")
+
+	assert.Equal(t, []usageStorageAccount{{resourceGroup: "rg", name: "nosetting"}}, coverage.uncovered)
+
+	// Nothing is enabled in report mode
+	coverage.apply(context.Background(), monitor.NewMockMonitorService(t), configParams)
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/raito-io/cli/base/util/config"
+
+	"github.com/raito-io/cli-plugin-azure/azure/monitor"
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+// defaultUsageQueryTemplate is the query on the storage logs that is used if no template is configured
+const defaultUsageQueryTemplate = "StorageBlobLogs | where {{.OperationFilter}} and {{.ResourceFilter}} | project {{.Columns}}"
+
+var ErrInvalidUsageQuery = errors.New("invalid usage query")
+
+// usageQueryData contains the placeholders that can be used in a usage query template.
+// The time range placeholders are kept in the rendered query and filled in for every time slice by the monitor service.
+type usageQueryData struct {
+	monitor.LogQueryTimeRange
+
+	// OperationFilter is a predicate that filters the tracked operations, response types and authentication types
+	OperationFilter string
+	// ResourceFilter is a predicate that filters the logs on the storage accounts that are synced
+	ResourceFilter string
+	// Columns is the list of StorageBlobLogs columns that are used, to project the results on
+	Columns string
+}
+
+// usageQueryBuilder renders the KQL query that fetches the usage logs, based on the built-in query or the template configured by the operator.
+type usageQueryBuilder struct {
+	template *template.Template
+	// columns maps log entry columns to the result columns of the query they are read from
+	columns map[string]string
+}
+
+func newUsageQueryBuilder(configParams *config.ConfigMap) (*usageQueryBuilder, error) {
+	queryTemplate := configParams.GetStringWithDefault(global.AzUsageQuery, "")
+
+	if file := configParams.GetStringWithDefault(global.AzUsageQueryFile, ""); file != "" {
+		if queryTemplate != "" {
+			return nil, fmt.Errorf("%w: only one of %s and %s can be set", ErrInvalidUsageQuery, global.AzUsageQuery, global.AzUsageQueryFile)
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read usage query file %q: %w", file, err)
+		}
+
+		queryTemplate = string(content)
+	}
+
+	if strings.TrimSpace(queryTemplate) == "" {
+		queryTemplate = defaultUsageQueryTemplate
+	}
+
+	tmpl, err := template.New("usage").Option("missingkey=error").Parse(queryTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidUsageQuery, err.Error())
+	}
+
+	columns, err := parseUsageQueryColumns(configParams.GetStringWithDefault(global.AzUsageQueryColumns, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return &usageQueryBuilder{template: tmpl, columns: columns}, nil
+}
+
+// parseUsageQueryColumns parses a comma separated list of column mappings in the form <log entry column>=<result column>
+func parseUsageQueryColumns(mapping string) (map[string]string, error) {
+	columns := make(map[string]string)
+
+	for _, pair := range strings.Split(mapping, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		column, resultColumn, found := strings.Cut(pair, "=")
+		column = strings.TrimSpace(column)
+		resultColumn = strings.TrimSpace(resultColumn)
+
+		if !found || column == "" || resultColumn == "" {
+			return nil, fmt.Errorf("%w: invalid column mapping %q, expected <column>=<result column>", ErrInvalidUsageQuery, pair)
+		}
+
+		if !monitor.IsLogEntryColumn(column) {
+			return nil, fmt.Errorf("%w: unknown column %q in column mapping", ErrInvalidUsageQuery, column)
+		}
+
+		columns[column] = resultColumn
+	}
+
+	return columns, nil
+}
+
+// resourceQuery returns the query on the logs of a single storage account
+func (b *usageQueryBuilder) resourceQuery() (string, error) {
+	return b.render("true")
+}
+
+// workspaceQuery returns the query on a workspace for the storage accounts with the given resource IDs.
+// The resource ID is added to the results, so they can be split per storage account.
+func (b *usageQueryBuilder) workspaceQuery(resourceIds []string) (string, error) {
+	quoted := make([]string, 0, len(resourceIds))
+	for _, resourceId := range resourceIds {
+		quoted = append(quoted, fmt.Sprintf("%q", resourceId))
+	}
+
+	query, err := b.render(fmt.Sprintf("_ResourceId in~ (%s)", strings.Join(quoted, ", ")))
+	if err != nil {
+		return "", err
+	}
+
+	if _, mapped := b.columns["ResourceId"]; !mapped {
+		query += " | extend ResourceId = _ResourceId"
+	}
+
+	return query, nil
+}
+
+func (b *usageQueryBuilder) render(resourceFilter string) (string, error) {
+	var query strings.Builder
+
+	err := b.template.Execute(&query, usageQueryData{
+		LogQueryTimeRange: monitor.TimeRangePlaceholders,
+		OperationFilter:   usageOperationFilter(),
+		ResourceFilter:    resourceFilter,
+		Columns:           usageColumns(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidUsageQuery, err.Error())
+	}
+
+	columns := make([]string, 0, len(b.columns))
+	for column := range b.columns {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		query.WriteString(fmt.Sprintf(" | extend %s = %s", column, b.columns[column]))
+	}
+
+	return query.String(), nil
+}
+
+// usageOperationFilter returns the KQL predicate on the operations in usageOperations. Server errors are not included.
+func usageOperationFilter() string {
+	operations := make([]string, 0, len(usageOperations))
+	for operation := range usageOperations {
+		operations = append(operations, fmt.Sprintf("%q", operation))
+	}
+
+	sort.Strings(operations)
+
+	authenticationTypes := make([]string, 0, len(usageAuthenticationTypes))
+	for _, authenticationType := range usageAuthenticationTypes {
+		authenticationTypes = append(authenticationTypes, fmt.Sprintf("%q", authenticationType))
+	}
+
+	return fmt.Sprintf("OperationName in (%s) and (MetricResponseType == \"Success\" or MetricResponseType endswith \"AuthorizationError\" or MetricResponseType startswith \"Client\") and AuthenticationType in (%s)", strings.Join(operations, ", "), strings.Join(authenticationTypes, ", "))
+}
+
+// usageColumns returns the columns of the storage logs that are decoded in a log entry.
+// The resource ID is projected as _ResourceId, which is the column that is available in both workspace and resource queries.
+func usageColumns() string {
+	columns := make([]string, 0, len(monitor.LogEntryColumns()))
+
+	for _, column := range monitor.LogEntryColumns() {
+		if column == "ResourceId" {
+			column = "_ResourceId"
+		}
+
+		columns = append(columns, column)
+	}
+
+	return strings.Join(columns, ", ")
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raito-io/cli/base/util/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raito-io/cli-plugin-azure/global"
+)
+
+func TestUsageQueryBuilder(t *testing.T) {
+	operationFilter := usageOperationFilter()
+
+	queryFile := filepath.Join(t.TempDir(), "usage.kql")
+	require.NoError(t, os.WriteFile(queryFile, []byte("StorageBlobLogs | where {{.TimeRange}} and {{.OperationFilter}}"), 0600))
+
+	tests := []struct {
+		name          string
+		params        map[string]string
+		wantResource  string
+		wantWorkspace string
+		wantErr       bool
+	}{
+		{
+			name:          "Default query",
+			params:        map[string]string{},
+			wantResource:  "StorageBlobLogs | where " + operationFilter + " and true | project " + usageColumns(),
+			wantWorkspace: "StorageBlobLogs | where " + operationFilter + " and _ResourceId in~ (\"/a\", \"/b\") | project " + usageColumns() + " | extend ResourceId = _ResourceId",
+		},
+		{
+			name:          "Custom template",
+			params:        map[string]string{global.AzUsageQuery: "StorageBlobLogs | where {{.ResourceFilter}} and RequesterObjectId != \"svc\""},
+			wantResource:  "StorageBlobLogs | where true and RequesterObjectId != \"svc\"",
+			wantWorkspace: "StorageBlobLogs | where _ResourceId in~ (\"/a\", \"/b\") and RequesterObjectId != \"svc\" | extend ResourceId = _ResourceId",
+		},
+		{
+			name:          "Template file with time range",
+			params:        map[string]string{global.AzUsageQueryFile: queryFile},
+			wantResource:  "StorageBlobLogs | where {{.TimeRange}} and " + operationFilter,
+			wantWorkspace: "StorageBlobLogs | where {{.TimeRange}} and " + operationFilter + " | extend ResourceId = _ResourceId",
+		},
+		{
+			name: "Column mapping",
+			params: map[string]string{
+				global.AzUsageQuery:        "MyLogs | where {{.ResourceFilter}}",
+				global.AzUsageQueryColumns: "ResourceId=Resource, ObjectKey=Path",
+			},
+			wantResource:  "MyLogs | where true | extend ObjectKey = Path | extend ResourceId = Resource",
+			wantWorkspace: "MyLogs | where _ResourceId in~ (\"/a\", \"/b\") | extend ObjectKey = Path | extend ResourceId = Resource",
+		},
+		{
+			name:    "Unknown placeholder",
+			params:  map[string]string{global.AzUsageQuery: "StorageBlobLogs | where {{.Unknown}}"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid template",
+			params:  map[string]string{global.AzUsageQuery: "StorageBlobLogs | where {{.OperationFilter"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown column",
+			params:  map[string]string{global.AzUsageQueryColumns: "Unknown=Path"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid column mapping",
+			params:  map[string]string{global.AzUsageQueryColumns: "ObjectKey"},
+			wantErr: true,
+		},
+		{
+			name:    "Both query and file",
+			params:  map[string]string{global.AzUsageQuery: "StorageBlobLogs", global.AzUsageQueryFile: queryFile},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, err := newUsageQueryBuilder(&config.ConfigMap{Parameters: tt.params})
+
+			if err == nil {
+				_, err = builder.resourceQuery()
+			}
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidUsageQuery)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			resourceQuery, err := builder.resourceQuery()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantResource, resourceQuery)
+
+			workspaceQuery, err := builder.workspaceQuery([]string{"/a", "/b"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWorkspace, workspaceQuery)
+		})
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/directory"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/file"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/service"
 	"github.com/hashicorp/go-hclog"
 	"github.com/raito-io/cli/base"
@@ -73,7 +75,31 @@ func createDirectoryClient(ctx context.Context, accountName string, fileSystem s
 		return nil, fmt.Errorf("could not create a credential from a secret: %w", err)
 	}
 
-	serviceURL := fmt.Sprintf("https://%s.dfs.core.windows.net/%s/%s", accountName, fileSystem, path)
+	return directory.NewClient(dataLakePathURL(accountName, fileSystem, path), cred, nil)
+}
+
+func createFileClient(ctx context.Context, accountName string, fileSystem string, path string, params map[string]string) (*file.Client, error) {
+	cred, err := global.CreateADClientSecretCredential(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a credential from a secret: %w", err)
+	}
+
+	return file.NewClient(dataLakePathURL(accountName, fileSystem, path), cred, nil)
+}
+
+// dataLakePathURL returns the URL of a path in a filesystem. The root directory of the filesystem ("/", or "" as used for the root of a container in ACL items)
+// is addressed as the filesystem URL with a trailing slash, e.g. https://<account>.dfs.core.windows.net/<filesystem>/
+func dataLakePathURL(accountName string, fileSystem string, path string) string {
+	return fmt.Sprintf("https://%s.dfs.core.windows.net/%s/%s", accountName, fileSystem, strings.TrimPrefix(path, "/"))
+}
+
+func createBlobContainerClient(ctx context.Context, accountName string, containerName string, params map[string]string) (*container.Client, error) {
+	cred, err := global.CreateADClientSecretCredential(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a credential from a secret: %w", err)
+	}
+
+	containerURL := fmt.Sprintf("https://%s.blob.core.windows.net/%s", accountName, containerName)
 
-	return directory.NewClient(serviceURL, cred, nil)
+	return container.NewClient(containerURL, cred, nil)
 }
@@ -0,0 +1,175 @@
+package azure
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+)
+
+const (
+	usageAggregationNone   = "none"
+	usageAggregationHourly = "hourly"
+	usageAggregationDaily  = "daily"
+
+	// maxAggregatedDetails is the maximum number of distinct request details that are kept per aggregated statement
+	maxAggregatedDetails = 10
+)
+
+// usageAggregationKey identifies the statements that are merged into a single statement
+type usageAggregationKey struct {
+	user        string
+	dataObject  data_usage.UsageDataObjectReference
+	permissions string
+	success     bool
+	status      string
+	error       string
+	bucket      int64
+}
+
+type usageAggregate struct {
+	statement data_usage.Statement
+	count     int
+	// details are the distinct details of the merged requests (e.g. client tool and caller IP), omitted counts the details that didn't fit
+	details []string
+	omitted int
+}
+
+func (a *usageAggregate) addDetails(details string) {
+	if details == "" || slices.Contains(a.details, details) {
+		return
+	}
+
+	if len(a.details) >= maxAggregatedDetails {
+		a.omitted++
+
+		return
+	}
+
+	a.details = append(a.details, details)
+}
+
+// usageAggregator merges the statements of the same user on the same data object with the same permissions and result within a time bucket.
+// Buckets are flushed as soon as a statement of a later bucket is added, as the logs are read in chronological order.
+type usageAggregator struct {
+	granularity time.Duration
+	aggregates  map[usageAggregationKey]*usageAggregate
+	// latest is the latest bucket a statement was added to
+	latest int64
+}
+
+func newUsageAggregator(aggregation string) (*usageAggregator, error) {
+	var granularity time.Duration
+
+	switch strings.ToLower(aggregation) {
+	case "", usageAggregationNone:
+		return nil, nil
+	case usageAggregationHourly:
+		granularity = time.Hour
+	case usageAggregationDaily:
+		granularity = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("invalid usage aggregation %q, expected one of %s, %s or %s", aggregation, usageAggregationNone, usageAggregationHourly, usageAggregationDaily)
+	}
+
+	return &usageAggregator{granularity: granularity, aggregates: make(map[usageAggregationKey]*usageAggregate)}, nil
+}
+
+// add merges the statement into its aggregate. It returns the statements that are ready to be committed: statements that don't access exactly one data object
+// are returned as is, and the aggregates of earlier buckets are returned once a statement of a later bucket is added.
+// Statements that arrive after their bucket was flushed (e.g. from the next storage account) start a new aggregate.
+func (a *usageAggregator) add(st data_usage.Statement) []data_usage.Statement {
+	if len(st.AccessedDataObjects) != 1 {
+		return []data_usage.Statement{st}
+	}
+
+	accessed := st.AccessedDataObjects[0]
+	key := usageAggregationKey{
+		user:        st.User,
+		dataObject:  accessed.DataObject,
+		permissions: strings.Join(accessed.Permissions, ","),
+		success:     st.Success,
+		status:      st.Status,
+		error:       st.Error,
+		bucket:      time.Unix(st.StartTime, 0).UTC().Truncate(a.granularity).Unix(),
+	}
+
+	var ready []data_usage.Statement
+
+	if key.bucket > a.latest {
+		ready = a.flushBefore(key.bucket)
+		a.latest = key.bucket
+	}
+
+	aggregate, found := a.aggregates[key]
+	if !found {
+		aggregate = &usageAggregate{statement: st}
+		a.aggregates[key] = aggregate
+	} else {
+		aggregate.statement.StartTime = min(aggregate.statement.StartTime, st.StartTime)
+		aggregate.statement.EndTime = max(aggregate.statement.EndTime, st.EndTime)
+		aggregate.statement.Bytes += st.Bytes
+		aggregate.statement.Rows += st.Rows
+	}
+
+	aggregate.count++
+	aggregate.addDetails(st.Query)
+
+	return ready
+}
+
+// flush returns all aggregated statements, sorted by start time, and resets the aggregator.
+func (a *usageAggregator) flush() []data_usage.Statement {
+	return a.flushBefore(math.MaxInt64)
+}
+
+// flushBefore returns the aggregated statements of the buckets before the given bucket, sorted by start time, and removes them from the aggregator.
+func (a *usageAggregator) flushBefore(bucket int64) []data_usage.Statement {
+	var result []data_usage.Statement
+
+	for key, aggregate := range a.aggregates {
+		if key.bucket >= bucket {
+			continue
+		}
+
+		result = append(result, aggregate.aggregatedStatement())
+
+		delete(a.aggregates, key)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].StartTime == result[j].StartTime {
+			return result[i].ExternalId < result[j].ExternalId
+		}
+
+		return result[i].StartTime < result[j].StartTime
+	})
+
+	return result
+}
+
+// aggregatedStatement returns the merged statement. The number of merged requests is reported in the query, as a statement has no field for it:
+// Rows is the number of rows a query returned, which would count the requests as rows in the usage insights.
+func (a *usageAggregate) aggregatedStatement() data_usage.Statement {
+	st := a.statement
+
+	if a.count == 1 {
+		return st
+	}
+
+	st.Query = fmt.Sprintf("%d requests between %s and %s", a.count, time.Unix(st.StartTime, 0).UTC().Format(time.RFC3339), time.Unix(st.EndTime, 0).UTC().Format(time.RFC3339))
+
+	if len(a.details) > 0 {
+		st.Query += "\n" + strings.Join(a.details, "\n")
+
+		if a.omitted > 0 {
+			st.Query += fmt.Sprintf("\n... and %d more", a.omitted)
+		}
+	}
+
+	return st
+}
@@ -0,0 +1,56 @@
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raito-io/cli/base/data_usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageAggregator_Add(t *testing.T) {
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	statement := func(id string, at time.Time, query string, errorMessage string) data_usage.Statement {
+		return data_usage.Statement{
+			ExternalId: id,
+			User:       "alice",
+			StartTime:  at.Unix(),
+			EndTime:    at.Unix(),
+			Success:    errorMessage == "",
+			Error:      errorMessage,
+			Query:      query,
+			AccessedDataObjects: []data_usage.UsageDataObjectItem{{
+				Permissions:      []string{"GetBlob"},
+				GlobalPermission: data_usage.Read,
+				DataObject:       data_usage.UsageDataObjectReference{FullName: "sub/rg/acct/c/a.csv", Type: "file"},
+			}},
+		}
+	}
+
+	aggregator, err := newUsageAggregator(usageAggregationHourly)
+	require.NoError(t, err)
+
+	assert.Empty(t, aggregator.add(statement("1", base.Add(5*time.Minute), "Client: AzCopy; Caller IP: 10.0.0.1", "")))
+	assert.Empty(t, aggregator.add(statement("2", base.Add(15*time.Minute), "Client: AzCopy; Caller IP: 10.0.0.2", "")))
+	assert.Empty(t, aggregator.add(statement("3", base.Add(20*time.Minute), "Client: AzCopy; Caller IP: 10.0.0.1", "")))
+	assert.Empty(t, aggregator.add(statement("4", base.Add(25*time.Minute), "Client: AzCopy; Caller IP: 10.0.0.3", "AuthorizationPermissionMismatch")))
+
+	// A statement of the next hour flushes the previous hour
+	ready := aggregator.add(statement("5", base.Add(65*time.Minute), "Client: Azure Portal", ""))
+
+	require.Len(t, ready, 2)
+	assert.Equal(t, "1", ready[0].ExternalId)
+	assert.Equal(t, "3 requests between 2024-03-01T10:05:00Z and 2024-03-01T10:20:00Z\nClient: AzCopy; Caller IP: 10.0.0.1\nClient: AzCopy; Caller IP: 10.0.0.2", ready[0].Query)
+	assert.Equal(t, "4", ready[1].ExternalId)
+	assert.Equal(t, "AuthorizationPermissionMismatch", ready[1].Error)
+	assert.Equal(t, "Client: AzCopy; Caller IP: 10.0.0.3", ready[1].Query)
+
+	rest := aggregator.flush()
+
+	require.Len(t, rest, 1)
+	assert.Equal(t, "5", rest[0].ExternalId)
+	assert.Equal(t, "Client: Azure Portal", rest[0].Query)
+	assert.Empty(t, aggregator.flush())
+}
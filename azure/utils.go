@@ -18,18 +18,16 @@ func init() {
 }
 
 func GetDataUsageStartDate(ctx context.Context, configMap *config.ConfigMap) (time.Time, *time.Time, *time.Time) {
-	numberOfDays := configMap.GetIntWithDefault(global.DataUsageWindow, 90)
-	if numberOfDays > 90 {
-		logger.Info(fmt.Sprintf("Capping data usage window to 90 days (from %d days)", numberOfDays))
-		numberOfDays = 90
+	numberOfDays := configMap.GetIntWithDefault(global.DataUsageWindow, global.MaxDataUsageWindow)
+	if numberOfDays > global.MaxDataUsageWindow {
+		logger.Info(fmt.Sprintf("Capping data usage window to %d days (from %d days)", global.MaxDataUsageWindow, numberOfDays))
 	}
 
 	if numberOfDays <= 0 {
-		logger.Info(fmt.Sprintf("Invalid input for data usage window (%d), setting to default 90 days", numberOfDays))
-		numberOfDays = 90
+		logger.Info(fmt.Sprintf("Invalid input for data usage window (%d), setting to default %d days", numberOfDays, global.MaxDataUsageWindow))
 	}
 
-	syncStart := time.Now().Truncate(24*time.Hour).AddDate(0, 0, -numberOfDays)
+	syncStart := global.DataUsageWindowStart(configMap)
 
 	var earliestTime *time.Time
 
@@ -3,4 +3,30 @@ package global
 const (
 	AzSubscriptionId = "azure-subscription-id"
 	DataUsageWindow  = "data-usage-window"
+	AzStateDirectory = "azure-state-directory"
+
+	AzDataSourceInventory         = "azure-data-source-inventory"
+	AzDataSourceMaxFolderDepth    = "azure-data-source-max-folder-depth"
+	AzDataSourceIncludeFiles      = "azure-data-source-include-files"
+	AzDataSourceMaxFilesPerFolder = "azure-data-source-max-files-per-folder"
+	AzDataSourceChangeFeed        = "azure-data-source-change-feed"
+
+	AzAclBatchSize    = "azure-acl-batch-size"
+	AzAclMaxBatches   = "azure-acl-max-batches"
+	AzAclGroupAdvisor = "azure-acl-group-advisor"
+	AzAclImportFiles  = "azure-acl-import-files"
+
+	AzUsageMaxFileSize = "azure-usage-max-file-size"
+	AzUsageAggregation = "azure-usage-aggregation"
+	AzUsageRollupDepth = "azure-usage-rollup-depth"
+	AzUsageActivityLog = "azure-usage-activity-log"
+
+	AzAutoEnableUsageLogs          = "azure-auto-enable-usage-logs"
+	AzAutoEnableUsageLogsWorkspace = "azure-auto-enable-usage-logs-workspace"
+
+	AzUsageQuery        = "azure-usage-query"
+	AzUsageQueryFile    = "azure-usage-query-file"
+	AzUsageQueryColumns = "azure-usage-query-columns"
+
+	AzSqlAuditWorkspace = "azure-sql-audit-workspace"
 )
@@ -0,0 +1,48 @@
+package global
+
+import (
+	"fmt"
+	"strings"
+
+	ds "github.com/raito-io/cli/base/data_source"
+)
+
+// ShouldHandleDataObject determines if the data object needs to be handled by a data source syncer or not. It does this by looking at the configuration options to only sync a part.
+func ShouldHandleDataObject(config *ds.DataSourceSyncConfig, fullName string) (ret bool) {
+	defer func() {
+		logger.Debug(fmt.Sprintf("shouldHandle %s: %t", fullName, ret))
+	}()
+
+	// No partial sync specified, so do everything
+	if config.DataObjectParent == "" {
+		return true
+	}
+
+	// Check if the data object is under the data object to start from
+	if !strings.HasPrefix(fullName, config.DataObjectParent) || config.DataObjectParent == fullName {
+		return false
+	}
+
+	// Check if we hit any excludes
+	for _, exclude := range config.DataObjectExcludes {
+		if strings.HasPrefix(fullName, config.DataObjectParent+"/"+exclude) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ShouldGoIntoDataObject checks if a data source syncer needs to go deeper into the data object or not.
+func ShouldGoIntoDataObject(config *ds.DataSourceSyncConfig, fullName string) (ret bool) {
+	defer func() {
+		logger.Debug(fmt.Sprintf("shouldGoInto %s: %t", fullName, ret))
+	}()
+
+	// No partial sync specified, so do everything
+	if config.DataObjectParent == "" || strings.HasPrefix(config.DataObjectParent, fullName) || strings.HasPrefix(fullName, config.DataObjectParent) {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package global
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+)
+
+const graphEndpoint = "https://graph.microsoft.com/v1.0"
+
+// ServicePrincipal is a service principal in Entra ID. Managed identities are service principals of type "ManagedIdentity".
+type ServicePrincipal struct {
+	Id                   string `json:"id"`
+	AppId                string `json:"appId"`
+	DisplayName          string `json:"displayName"`
+	ServicePrincipalType string `json:"servicePrincipalType"`
+}
+
+// servicePrincipalLookup looks up service principals in Microsoft Graph. It is shared by concurrent callers.
+type servicePrincipalLookup struct {
+	mutex    sync.Mutex
+	pipeline *runtime.Pipeline
+	// disabled is set when the application is not allowed to read service principals, so the lookup isn't tried again for every ID
+	disabled bool
+	// cache also keeps the IDs that could not be found or failed, so they are only looked up once
+	cache map[string]*ServicePrincipal
+}
+
+var servicePrincipals = &servicePrincipalLookup{cache: make(map[string]*ServicePrincipal)}
+
+// GetServicePrincipalById looks up a service principal or managed identity in Microsoft Graph. Nil is returned if it doesn't exist.
+// After the first lookup that is denied, nil is returned for all IDs.
+func GetServicePrincipalById(ctx context.Context, params map[string]string, id string) (*ServicePrincipal, error) {
+	servicePrincipals.mutex.Lock()
+	defer servicePrincipals.mutex.Unlock()
+
+	return servicePrincipals.get(ctx, params, id)
+}
+
+func (l *servicePrincipalLookup) get(ctx context.Context, params map[string]string, id string) (*ServicePrincipal, error) {
+	if l.disabled {
+		return nil, nil
+	}
+
+	if sp, found := l.cache[id]; found {
+		return sp, nil
+	}
+
+	if l.pipeline == nil {
+		cred, err := CreateADClientSecretCredential(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("could not create a credential from a secret: %w", err)
+		}
+
+		pipeline := runtime.NewPipeline("github.com/raito-io/cli-plugin-azure/global", "", runtime.PipelineOptions{
+			PerRetry: []policy.Policy{runtime.NewBearerTokenPolicy(cred, []string{"https://graph.microsoft.com/.default"}, nil)},
+		}, &policy.ClientOptions{Telemetry: policy.TelemetryOptions{Disabled: true}})
+
+		l.pipeline = &pipeline
+	}
+
+	sp, err := l.request(ctx, id)
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden {
+			l.disabled = true
+
+			return nil, fmt.Errorf("not allowed to read service principals, skipping the lookup of all other service principals: %w", err)
+		}
+	}
+
+	l.cache[id] = sp
+
+	return sp, err
+}
+
+func (l *servicePrincipalLookup) request(ctx context.Context, id string) (*ServicePrincipal, error) {
+	req, err := runtime.NewRequest(ctx, http.MethodGet, runtime.JoinPaths(graphEndpoint, "servicePrincipals", id))
+	if err != nil {
+		return nil, err
+	}
+
+	reqQP := req.Raw().URL.Query()
+	reqQP.Set("$select", "id,appId,displayName,servicePrincipalType")
+	req.Raw().URL.RawQuery = reqQP.Encode()
+
+	resp, err := l.pipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if runtime.HasStatusCode(resp, http.StatusNotFound) {
+		return nil, nil
+	}
+
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return nil, runtime.NewResponseError(resp)
+	}
+
+	var sp ServicePrincipal
+
+	err = runtime.UnmarshalAsJSON(resp, &sp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sp, nil
+}
+
+// GetRequesterNameById returns the name of the user, service principal or managed identity with the given object ID.
+// An empty string is returned if the principal can't be found.
+func GetRequesterNameById(ctx context.Context, params map[string]string, id string) string {
+	if id == "" {
+		return ""
+	}
+
+	if name := GetPrincipalNameById(ctx, params, armauthorization.PrincipalTypeUser, id); name != "" {
+		return name
+	}
+
+	sp, err := GetServicePrincipalById(ctx, params, id)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Unable to look up service principal %q: %s", id, err.Error()))
+
+		return ""
+	}
+
+	if sp == nil {
+		return ""
+	}
+
+	return sp.DisplayName
+}
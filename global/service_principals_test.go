@@ -0,0 +1,136 @@
+package global
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/raito-io/cli-plugin-azure-ad/ad"
+	is "github.com/raito-io/cli/base/identity_store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGraph answers the service principal requests with the given status codes and bodies per ID and records the requested IDs
+type fakeGraph struct {
+	statusCodes map[string]int
+	bodies      map[string]string
+	requested   []string
+}
+
+func (g *fakeGraph) Do(req *http.Request) (*http.Response, error) {
+	id := path.Base(req.URL.Path)
+	g.requested = append(g.requested, id)
+
+	statusCode, found := g.statusCodes[id]
+	if !found {
+		statusCode = http.StatusNotFound
+	}
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(g.bodies[id])),
+		Request:    req,
+	}, nil
+}
+
+func newFakeServicePrincipalLookup(graph *fakeGraph) *servicePrincipalLookup {
+	pipeline := runtime.NewPipeline("test", "", runtime.PipelineOptions{}, &policy.ClientOptions{
+		Transport: graph,
+		Retry:     policy.RetryOptions{MaxRetries: -1},
+		Telemetry: policy.TelemetryOptions{Disabled: true},
+	})
+
+	return &servicePrincipalLookup{pipeline: &pipeline, cache: make(map[string]*ServicePrincipal)}
+}
+
+func TestServicePrincipalLookup_Get(t *testing.T) {
+	graph := &fakeGraph{
+		statusCodes: map[string]int{"sp1": http.StatusOK},
+		bodies:      map[string]string{"sp1": `{"id":"sp1","appId":"app1","displayName":"pipeline","servicePrincipalType":"Application"}`},
+	}
+	lookup := newFakeServicePrincipalLookup(graph)
+
+	sp, err := lookup.get(context.Background(), nil, "sp1")
+	require.NoError(t, err)
+	assert.Equal(t, &ServicePrincipal{Id: "sp1", AppId: "app1", DisplayName: "pipeline", ServicePrincipalType: "Application"}, sp)
+
+	sp, err = lookup.get(context.Background(), nil, "unknown")
+	require.NoError(t, err)
+	assert.Nil(t, sp)
+
+	// Both the found and the unknown service principal are cached
+	sp, err = lookup.get(context.Background(), nil, "sp1")
+	require.NoError(t, err)
+	assert.Equal(t, "pipeline", sp.DisplayName)
+
+	sp, err = lookup.get(context.Background(), nil, "unknown")
+	require.NoError(t, err)
+	assert.Nil(t, sp)
+
+	assert.Equal(t, []string{"sp1", "unknown"}, graph.requested)
+	assert.False(t, lookup.disabled)
+}
+
+func TestServicePrincipalLookup_GetForbidden(t *testing.T) {
+	graph := &fakeGraph{
+		statusCodes: map[string]int{"sp1": http.StatusForbidden, "sp2": http.StatusOK},
+		bodies:      map[string]string{"sp1": `{"error":{"code":"Authorization_RequestDenied"}}`, "sp2": `{"id":"sp2","displayName":"other"}`},
+	}
+	lookup := newFakeServicePrincipalLookup(graph)
+
+	sp, err := lookup.get(context.Background(), nil, "sp1")
+	require.Error(t, err)
+	assert.Nil(t, sp)
+	assert.True(t, lookup.disabled)
+
+	// Once denied, no other service principal is looked up anymore
+	sp, err = lookup.get(context.Background(), nil, "sp2")
+	require.NoError(t, err)
+	assert.Nil(t, sp)
+
+	assert.Equal(t, []string{"sp1"}, graph.requested)
+}
+
+func TestServicePrincipalLookup_GetServerError(t *testing.T) {
+	graph := &fakeGraph{statusCodes: map[string]int{"sp1": http.StatusInternalServerError, "sp2": http.StatusOK}, bodies: map[string]string{"sp2": `{"id":"sp2","displayName":"other"}`}}
+	lookup := newFakeServicePrincipalLookup(graph)
+
+	_, err := lookup.get(context.Background(), nil, "sp1")
+	require.Error(t, err)
+	assert.False(t, lookup.disabled)
+
+	sp, err := lookup.get(context.Background(), nil, "sp2")
+	require.NoError(t, err)
+	assert.Equal(t, "other", sp.DisplayName)
+}
+
+func TestGetRequesterNameById(t *testing.T) {
+	graph := &fakeGraph{
+		statusCodes: map[string]int{"sp1": http.StatusOK},
+		bodies:      map[string]string{"sp1": `{"id":"sp1","displayName":"pipeline"}`},
+	}
+
+	originalContainer, originalLookup := identityContainer, servicePrincipals
+
+	t.Cleanup(func() {
+		identityContainer, servicePrincipals = originalContainer, originalLookup
+	})
+
+	identityContainer = &ad.IdentityContainer{Users: []*is.User{{ExternalId: "u1", UserName: "jane@example.com"}}}
+	servicePrincipals = newFakeServicePrincipalLookup(graph)
+
+	assert.Equal(t, "jane@example.com", GetRequesterNameById(context.Background(), nil, "u1"))
+	assert.Equal(t, "pipeline", GetRequesterNameById(context.Background(), nil, "sp1"))
+	assert.Equal(t, "", GetRequesterNameById(context.Background(), nil, "unknown"))
+	assert.Equal(t, "", GetRequesterNameById(context.Background(), nil, ""))
+
+	// Users are resolved from the identity container without a Graph request
+	assert.Equal(t, []string{"sp1", "unknown"}, graph.requested)
+}
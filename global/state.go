@@ -0,0 +1,72 @@
+package global
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const stateDirectoryName = "raito-cli-plugin-azure"
+
+// StateFilePath returns the location of the local state file with the given name.
+// The file is stored in the directory configured by AzStateDirectory or in the user cache directory otherwise.
+func StateFilePath(params map[string]string, name string) (string, error) {
+	dir := params[AzStateDirectory]
+
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine state directory: %w", err)
+		}
+
+		dir = filepath.Join(cacheDir, stateDirectoryName)
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.json", params[AzSubscriptionId], name)), nil
+}
+
+// LoadState reads the JSON state file at the given path into state. A missing file is not considered an error.
+func LoadState(path string, state interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read state file %q: %w", path, err)
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return fmt.Errorf("could not parse state file %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// SaveState writes state as JSON to the given path. The file is replaced atomically so an interrupted run never leaves a corrupt state file behind.
+func SaveState(path string, state interface{}) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("could not create state directory: %w", err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("could not serialize state: %w", err)
+	}
+
+	tmpFile := path + ".tmp"
+
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write state file %q: %w", tmpFile, err)
+	}
+
+	err = os.Rename(tmpFile, path)
+	if err != nil {
+		return fmt.Errorf("could not replace state file %q: %w", path, err)
+	}
+
+	return nil
+}
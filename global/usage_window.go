@@ -0,0 +1,25 @@
+package global
+
+import (
+	"errors"
+	"time"
+
+	"github.com/raito-io/cli/base/util/config"
+)
+
+// ErrMaxUsageFileSizeReached is returned when a usage statement is committed after the data usage file reached the size in AzUsageMaxFileSize.
+// Usage syncers stop reading logs when they get it, so their checkpoints don't move past the statements that were not written.
+var ErrMaxUsageFileSizeReached = errors.New("maximum data usage file size reached")
+
+// MaxDataUsageWindow is the maximum number of days of data usage that is synced
+const MaxDataUsageWindow = 90
+
+// DataUsageWindowStart returns the start of the data usage window configured by DataUsageWindow. Invalid windows fall back to the maximum window.
+func DataUsageWindowStart(configMap *config.ConfigMap) time.Time {
+	numberOfDays := configMap.GetIntWithDefault(DataUsageWindow, MaxDataUsageWindow)
+	if numberOfDays <= 0 || numberOfDays > MaxDataUsageWindow {
+		numberOfDays = MaxDataUsageWindow
+	}
+
+	return time.Now().Truncate(24*time.Hour).AddDate(0, 0, -numberOfDays)
+}
@@ -34,6 +34,26 @@ func main() {
 					{Name: ad.AdClientId, Description: "The client ID for Azure Active Directory", Mandatory: true},
 					{Name: ad.AdSecret, Description: "The secret to connect to Azure Active Directory", Mandatory: true},
 					{Name: global.AzSubscriptionId, Description: "The Azure Subscription ID", Mandatory: true},
+					{Name: global.AzStateDirectory, Description: "The directory where the plugin keeps its local state (e.g. checkpoints of interrupted operations) between runs. Defaults to a directory in the user cache directory.", Mandatory: false},
+					{Name: global.AzDataSourceInventory, Description: "If set to true, the folders and files of a storage account are read from the latest report of its Azure Blob Inventory policy instead of listing all paths. Only CSV reports are supported. Storage accounts without a completed CSV report are listed as usual.", Mandatory: false},
+					{Name: global.AzDataSourceMaxFolderDepth, Description: "The number of folder levels below a container that are synced. Deeper folders and the files in them are skipped, and are not listed at all when no inventory report is used. By default, all folders are synced.", Mandatory: false},
+					{Name: global.AzDataSourceIncludeFiles, Description: "If set to false, only folders are synced, not the files in them. Defaults to true.", Mandatory: false},
+					{Name: global.AzDataSourceMaxFilesPerFolder, Description: "The maximum number of files that are synced per folder (or container). Other files are skipped. By default, all files are synced.", Mandatory: false},
+					{Name: global.AzDataSourceChangeFeed, Description: "If set to true, only the changes in the blob change feed since the previous sync are read for storage accounts with the change feed enabled. The folders and files of the previous sync are kept in the state directory. A full sync is done when there is no previous sync or when the change feed no longer contains its checkpoint.", Mandatory: false},
+					{Name: global.AzAclBatchSize, Description: "The number of paths that are handled per batch when ACLs are updated or removed recursively. Maximum (and default) 2000.", Mandatory: false},
+					{Name: global.AzAclMaxBatches, Description: "The maximum number of batches per recursive ACL operation in a single run. When reached, the operation is resumed during the next run. 0 (default) means no limit.", Mandatory: false},
+					{Name: global.AzAclGroupAdvisor, Description: "If set to true, a warning is added to access providers that add many user entries to an ACL that gets close to the limit of 32 entries, suggesting to grant access to groups instead.", Mandatory: false},
+					{Name: global.AzAclImportFiles, Description: "If set to true, the ACL entries on individual files are imported as access providers. Disabled by default. Importing them lists the paths of all storage accounts within the folder depth and file limits of the data source sync, the ACL is only read for files with named entries.", Mandatory: false},
+					{Name: global.AzUsageMaxFileSize, Description: "The maximum size (in MB) of the data usage file. When reached, no more usage statements are added and reading the logs stops. Must be a positive number and defaults to 2048.", Mandatory: false},
+					{Name: global.AzUsageAggregation, Description: "Merges the usage statements of the same user on the same data object per time bucket, to reduce the number of statements. Possible values: 'none' (default), 'hourly' or 'daily'.", Mandatory: false},
+					{Name: global.AzUsageRollupDepth, Description: "If set, usage is reported on the folder at this depth below the container instead of on the individual files. 0 reports usage on the container level. By default, usage is reported on the files themselves.", Mandatory: false},
+					{Name: global.AzUsageActivityLog, Description: "If set to true, management operations in the Activity Log of the subscription (e.g. listing keys, changing network rules or creating role assignments) are reported as admin usage on the subscription, resource groups, storage accounts and containers. Disabled by default.", Mandatory: false},
+					{Name: global.AzAutoEnableUsageLogs, Description: "How to handle storage accounts without a diagnostic setting that sends read logs to Azure Monitor. Possible values: 'off' (default), 'report' to list these storage accounts in the logs, or 'enable' to create a diagnostic setting that sends the read, write and delete logs of their blob service to the workspace in azure-auto-enable-usage-logs-workspace.", Mandatory: false},
+					{Name: global.AzAutoEnableUsageLogsWorkspace, Description: "The resource ID of the Log Analytics workspace to send the logs to when azure-auto-enable-usage-logs is set to 'enable'.", Mandatory: false},
+					{Name: global.AzUsageQuery, Description: "A KQL query template to fetch the storage logs for data usage, e.g. to exclude known service accounts or to query a custom schema. The placeholders {{.OperationFilter}}, {{.ResourceFilter}}, {{.Columns}}, {{.TimeRange}}, {{.StartTime}} and {{.EndTime}} can be used. If the time range placeholders are not used, a filter on TimeGenerated is appended. Defaults to 'StorageBlobLogs | where {{.OperationFilter}} and {{.ResourceFilter}} | project {{.Columns}}'.", Mandatory: false},
+					{Name: global.AzUsageQueryFile, Description: "The path to a file containing the KQL query template to fetch the storage logs for data usage. Can be used instead of azure-usage-query.", Mandatory: false},
+					{Name: global.AzUsageQueryColumns, Description: "A comma separated list of mappings from log columns to the result columns of the usage query, in the form <log column>=<result column>, e.g. 'RequesterObjectId=CallerId,ObjectKey=Path'. Only needed when the query returns another schema than StorageBlobLogs.", Mandatory: false},
+					{Name: global.AzSqlAuditWorkspace, Description: "The resource ID of the Log Analytics workspace that Azure SQL auditing sends its records to. If set, the Azure SQL servers with their databases, schemas and tables are synced as data objects (which requires read access to the SQL servers), and the statements in the SQL Security Audit Events are reported as usage on the referenced tables. Audit logs in .xel files in a storage account are not supported.", Mandatory: false},
 				},
 			},
 		})